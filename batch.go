@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gopaint/batch"
+	"gopaint/format"
+	"gopaint/raster"
+	. "gopaint/reza"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The batch mode runs without creating any window:
+//
+//	gopaint batch (-o dir | -overwrite) [-r] -op <operation> [-op <operation>...] <file|dir|pattern>...
+const batchCommand = "batch"
+
+const batchUsage = `Usage: gopaint batch (-o dir | -overwrite) [-r] -op <operation> [-op <operation>...] <file|dir|pattern>...
+
+Operations are applied in the given order:
+  resize=WxH        resize to the given size, leave W or H empty to keep the aspect ratio
+  resize=N%         resize by percentage
+  crop=X,Y,W,H      keep only the given rectangle
+  rotate=90|180|270 rotate clockwise by the given degrees
+  flip=h|v          flip horizontally or vertically
+  fill=#RRGGBB[AA]  fill the transparent areas with the given color
+  trim[=T[,P]]      cut off the borders of the top left corner color, up to T (0-255)
+                    different, keeping P pixels of padding
+  trim=transparent[,P]
+                    cut off the fully transparent borders, keeping P pixels of padding
+  invert            invert the colors
+  convert=EXT       write the result in another format (png, jpg, bmp...)
+
+Options:
+`
+
+// batchOperation is a single step applied on every image
+type batchOperation struct {
+	name  string
+	apply func(img *BGRA) (*BGRA, error)
+}
+
+// batchOperations collects the -op flags
+type batchOperations struct {
+	list []batchOperation
+	// Extension of the output format, empty keeps the input format
+	convertTo string
+}
+
+func (ops *batchOperations) String() string {
+	names := make([]string, len(ops.list))
+	for i, op := range ops.list {
+		names[i] = op.name
+	}
+	return strings.Join(names, ",")
+}
+
+func (ops *batchOperations) Set(value string) error {
+	name, arg := value, ""
+	if i := strings.Index(value, "="); i >= 0 {
+		name, arg = value[:i], value[i+1:]
+	}
+	var apply func(img *BGRA) (*BGRA, error)
+	var err error
+	switch strings.ToLower(name) {
+	case "resize":
+		apply, err = parseResizeOperation(arg)
+	case "crop":
+		apply, err = parseCropOperation(arg)
+	case "rotate":
+		apply, err = parseRotateOperation(arg)
+	case "flip":
+		apply, err = parseFlipOperation(arg)
+	case "fill":
+		apply, err = parseFillOperation(arg)
+	case "trim":
+		apply, err = parseTrimOperation(arg)
+	case "invert":
+		apply = func(img *BGRA) (*BGRA, error) {
+			raster.Invert(img, img.Rect)
+			return img, nil
+		}
+	case "convert":
+		ext := "." + strings.TrimPrefix(strings.ToLower(arg), ".")
+		fileFormat := format.FindFormatFromExt(ext)
+		if fileFormat == nil || !fileFormat.Encodable {
+			return fmt.Errorf("can't convert to '%s'", arg)
+		}
+		ops.convertTo = ext
+		return nil
+	default:
+		return fmt.Errorf("unknown operation '%s'", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	ops.list = append(ops.list, batchOperation{name: value, apply: apply})
+	return nil
+}
+
+func parseResizeOperation(arg string) (func(img *BGRA) (*BGRA, error), error) {
+	if strings.HasSuffix(arg, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(arg, "%"), 64)
+		if err != nil || percent <= 0 {
+			return nil, fmt.Errorf("invalid percentage '%s'", arg)
+		}
+		return func(img *BGRA) (*BGRA, error) {
+			width := Max(1, int(float64(img.Rect.Dx())*percent/100+0.5))
+			height := Max(1, int(float64(img.Rect.Dy())*percent/100+0.5))
+			return resizeImage(img, width, height), nil
+		}, nil
+	}
+	parts := strings.Split(strings.ToLower(arg), "x")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid size '%s'", arg)
+	}
+	width, height := 0, 0
+	var err error
+	if len(parts[0]) > 0 {
+		if width, err = strconv.Atoi(parts[0]); err != nil || width < 0 {
+			return nil, fmt.Errorf("invalid width '%s'", parts[0])
+		}
+	}
+	if len(parts[1]) > 0 {
+		if height, err = strconv.Atoi(parts[1]); err != nil || height < 0 {
+			return nil, fmt.Errorf("invalid height '%s'", parts[1])
+		}
+	}
+	if width == 0 && height == 0 {
+		return nil, errors.New("width or height is required")
+	}
+	return func(img *BGRA) (*BGRA, error) {
+		w, h := width, height
+		// Keep the aspect ratio for the missing side
+		if w == 0 {
+			w = Max(1, img.Rect.Dx()*h/img.Rect.Dy())
+		}
+		if h == 0 {
+			h = Max(1, img.Rect.Dy()*w/img.Rect.Dx())
+		}
+		return resizeImage(img, w, h), nil
+	}, nil
+}
+
+// resizeImage scales the whole image with Lanczos, the sharpest of the filters
+func resizeImage(img *BGRA, width, height int) *BGRA {
+	return raster.TransformImage(img, raster.ResizeTransform(img.Rect, width, height, 0, 0), raster.FilterLanczos)
+}
+
+func parseCropOperation(arg string) (func(img *BGRA) (*BGRA, error), error) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("expected X,Y,W,H but got '%s'", arg)
+	}
+	values := make([]int, 4)
+	for i, part := range parts {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", part)
+		}
+		values[i] = value
+	}
+	rect := image.Rect(values[0], values[1], values[0]+values[2], values[1]+values[3])
+	if rect.Empty() {
+		return nil, errors.New("empty rectangle")
+	}
+	return func(img *BGRA) (*BGRA, error) {
+		if rect.Intersect(img.Rect).Empty() {
+			return nil, errors.New("crop rectangle is outside of the image")
+		}
+		return raster.Crop(img, rect), nil
+	}, nil
+}
+
+func parseRotateOperation(arg string) (func(img *BGRA) (*BGRA, error), error) {
+	switch arg {
+	case "90", "-270":
+		return func(img *BGRA) (*BGRA, error) { return raster.RotateRight(img), nil }, nil
+	case "180", "-180":
+		return func(img *BGRA) (*BGRA, error) { return raster.Rotate180(img), nil }, nil
+	case "270", "-90":
+		return func(img *BGRA) (*BGRA, error) { return raster.RotateLeft(img), nil }, nil
+	}
+	return nil, fmt.Errorf("unsupported angle '%s'", arg)
+}
+
+func parseFlipOperation(arg string) (func(img *BGRA) (*BGRA, error), error) {
+	switch strings.ToLower(arg) {
+	case "h", "horizontal":
+		return func(img *BGRA) (*BGRA, error) { return raster.FlipHorizontal(img), nil }, nil
+	case "v", "vertical":
+		return func(img *BGRA) (*BGRA, error) { return raster.FlipVertical(img), nil }, nil
+	}
+	return nil, fmt.Errorf("unknown direction '%s'", arg)
+}
+
+func parseFillOperation(arg string) (func(img *BGRA) (*BGRA, error), error) {
+	c, err := format.ParseHexColor(arg)
+	if err != nil {
+		return nil, err
+	}
+	return func(img *BGRA) (*BGRA, error) {
+		filled := NewBGRA(img.Rect)
+		raster.Fill(filled, filled.Rect, c)
+		raster.Composite(filled, img, img.Rect, 255, raster.BlendNormal, false)
+		return filled, nil
+	}, nil
+}
+
+func parseTrimOperation(arg string) (func(img *BGRA) (*BGRA, error), error) {
+	options := raster.TrimOptions{}
+	parts := strings.Split(arg, ",")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("expected T,P but got '%s'", arg)
+	}
+	if parts[0] == "transparent" {
+		options.Transparent = true
+	} else if len(parts[0]) > 0 {
+		tolerance, err := strconv.Atoi(parts[0])
+		if err != nil || tolerance < 0 || tolerance > 255 {
+			return nil, fmt.Errorf("invalid tolerance '%s'", parts[0])
+		}
+		options.Tolerance = tolerance
+	}
+	if len(parts) == 2 {
+		padding, err := strconv.Atoi(parts[1])
+		if err != nil || padding < 0 {
+			return nil, fmt.Errorf("invalid padding '%s'", parts[1])
+		}
+		options.Padding = padding
+	}
+	return func(img *BGRA) (*BGRA, error) {
+		rect := raster.TrimBounds(img, options)
+		if rect.Empty() {
+			// All border, nothing to keep
+			return img, nil
+		}
+		return raster.Crop(img, rect), nil
+	}, nil
+}
+
+func loadBatchImage(path string) (*BGRA, error) {
+	img, warning, err := format.DecodeImageFile(path)
+	if len(warning) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	return img, err
+}
+
+// processBatchFile applies the operations to the input and writes the result to output
+func processBatchFile(input, output string, ops *batchOperations, options format.EncodeOptions) error {
+	img, err := loadBatchImage(input)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops.list {
+		if img, err = op.apply(img); err != nil {
+			return fmt.Errorf("%s: %v", op.name, err)
+		}
+	}
+	// The sub directories of the input show up in the output directory too
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	return format.EncodeImageFile(output, img, options)
+}
+
+// runBatch runs the batch mode and returns the process exit code
+func runBatch(args []string) int {
+	flags := flag.NewFlagSet(batchCommand, flag.ContinueOnError)
+	ops := &batchOperations{}
+	outputDir := flags.String("o", "", "output directory, keeps the sub directories of the inputs")
+	overwrite := flags.Bool("overwrite", false, "write the results over the input files, instead of -o")
+	recursive := flags.Bool("r", false, "look into the sub directories too")
+	options := format.DefaultEncodeOptions
+	flags.IntVar(&options.Gif.Colors, "gif-colors", options.Gif.Colors, "palette size of the GIF files we write (2-256)")
+	flags.BoolVar(&options.Gif.Dither, "gif-dither", options.Gif.Dither, "use Floyd-Steinberg dithering for the GIF files we write")
+	flags.Var(ops, "op", "operation to apply, can be given multiple times")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), batchUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	// Replacing the originals must be asked for
+	if len(*outputDir) == 0 && !*overwrite {
+		fmt.Fprintln(os.Stderr, "either give an output directory with -o or -overwrite to replace the input files")
+		return 2
+	}
+	if len(*outputDir) > 0 && *overwrite {
+		fmt.Fprintln(os.Stderr, "-o and -overwrite can't be used together")
+		return 2
+	}
+	files, err := batch.ExpandInputs(flags.Args(), *recursive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// Nothing gets written if any two results would end up in the same file
+	outputs, err := batch.OutputPaths(files, *outputDir, ops.convertTo)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	failed := 0
+	for i, file := range files {
+		if err := processBatchFile(file.Path, outputs[i], ops, options); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file.Path, err)
+			failed++
+		} else {
+			fmt.Printf("%s: done\n", file.Path)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d files failed\n", failed, len(files))
+		return 1
+	}
+	return 0
+}
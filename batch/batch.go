@@ -0,0 +1,99 @@
+// Package batch finds the files the batch mode works on and where their results go,
+// without touching any pixels
+package batch
+
+import (
+	"fmt"
+	"gopaint/format"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Input is a file to process, Name is its path relative to the directory it was found
+// in and also where its result goes in the output directory
+type Input struct {
+	Path string
+	Name string
+}
+
+// ExpandInputs turns the arguments (files, directories or glob patterns) into a list
+// of files we know how to decode. A file found twice is only listed once
+func ExpandInputs(args []string, recursive bool) ([]Input, error) {
+	files := make([]Input, 0)
+	seen := make(map[string]bool)
+	add := func(input Input) {
+		if key := filepath.Clean(input.Path); !seen[key] {
+			seen[key] = true
+			files = append(files, input)
+		}
+	}
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern '%s': %v", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no such file '%s'", arg)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(Input{match, filepath.Base(match)})
+				continue
+			}
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					if path != match && !recursive {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if format.FindFormatFromExt(filepath.Ext(path)) != nil {
+					name, err := filepath.Rel(match, path)
+					if err != nil {
+						return err
+					}
+					add(Input{path, name})
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// OutputPaths returns where the result of each input goes: under outputDir with the
+// name of the input, or over the input itself when outputDir is empty. A convertTo
+// extension replaces the one of the input. Two inputs ending up in the same file is an
+// error, the later one would silently replace the earlier one
+func OutputPaths(inputs []Input, outputDir, convertTo string) ([]string, error) {
+	outputs := make([]string, len(inputs))
+	// Windows doesn't tell upper and lower case apart in file names
+	taken := make(map[string]string)
+	for i, input := range inputs {
+		output := input.Path
+		if len(outputDir) > 0 {
+			output = filepath.Join(outputDir, input.Name)
+		}
+		if len(convertTo) > 0 {
+			output = strings.TrimSuffix(output, filepath.Ext(output)) + convertTo
+		}
+		key := strings.ToLower(filepath.Clean(output))
+		if other, found := taken[key]; found {
+			return nil, fmt.Errorf("'%s' and '%s' would both be written to '%s'", other, input.Path, output)
+		}
+		taken[key] = input.Path
+		outputs[i] = output
+	}
+	return outputs, nil
+}
@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createFiles makes empty files at the paths relative to dir
+func createFiles(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func inputNames(inputs []Input) []string {
+	names := make([]string, len(inputs))
+	for i, input := range inputs {
+		names[i] = filepath.ToSlash(input.Name)
+	}
+	return names
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.png", "b.jpg", "notes.txt", "sub/c.gif", "sub/deeper/d.bmp")
+	tests := []struct {
+		name      string
+		args      []string
+		recursive bool
+		want      string
+	}{
+		{"directory", []string{dir}, false, "a.png,b.jpg"},
+		{"recursive", []string{dir}, true, "a.png,b.jpg,sub/c.gif,sub/deeper/d.bmp"},
+		{"file", []string{filepath.Join(dir, "sub", "c.gif")}, false, "c.gif"},
+		{"pattern", []string{filepath.Join(dir, "*.png")}, false, "a.png"},
+		{"the same file twice", []string{filepath.Join(dir, "a.png"), dir}, false, "a.png,b.jpg"},
+	}
+	for _, test := range tests {
+		inputs, err := ExpandInputs(test.args, test.recursive)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := strings.Join(inputNames(inputs), ","); got != test.want {
+			t.Errorf("%s: found %s, want %s", test.name, got, test.want)
+		}
+	}
+	if _, err := ExpandInputs([]string{filepath.Join(dir, "missing.png")}, false); err == nil {
+		t.Error("a missing file got no error")
+	}
+}
+
+func TestOutputPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputs    []Input
+		outputDir string
+		convertTo string
+		want      []string
+	}{
+		{"output directory", []Input{{"in/a.png", "a.png"}, {"in/sub/b.png", "sub/b.png"}}, "out", "",
+			[]string{"out/a.png", "out/sub/b.png"}},
+		{"converted", []Input{{"in/a.png", "a.png"}}, "out", ".gif", []string{"out/a.gif"}},
+		{"overwrite", []Input{{"in/a.png", "a.png"}, {"b.jpg", "b.jpg"}}, "", "", []string{"in/a.png", "b.jpg"}},
+		{"overwrite converted", []Input{{"in/a.png", "a.png"}}, "", ".bmp", []string{"in/a.bmp"}},
+		{"same name in other directories", []Input{{"x/a.png", "a.png"}, {"y/a.png", "a.png"}}, "", "",
+			[]string{"x/a.png", "y/a.png"}},
+	}
+	for _, test := range tests {
+		for i := range test.inputs {
+			test.inputs[i].Path = filepath.FromSlash(test.inputs[i].Path)
+			test.inputs[i].Name = filepath.FromSlash(test.inputs[i].Name)
+		}
+		outputs, err := OutputPaths(test.inputs, test.outputDir, test.convertTo)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for i, output := range outputs {
+			if filepath.ToSlash(output) != test.want[i] {
+				t.Errorf("%s: %s goes to %s, want %s", test.name, test.inputs[i].Path, output, test.want[i])
+			}
+		}
+	}
+}
+
+func TestOutputPathsCollisions(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputs    []Input
+		outputDir string
+		convertTo string
+	}{
+		{"same base name", []Input{{"x/a.png", "a.png"}, {"y/a.png", "a.png"}}, "out", ""},
+		{"upper and lower case", []Input{{"x/a.png", "a.png"}, {"y/A.PNG", "A.PNG"}}, "out", ""},
+		{"converted to the same", []Input{{"a.png", "a.png"}, {"a.jpg", "a.jpg"}}, "out", ".gif"},
+		{"overwrite converted to the same", []Input{{"a.png", "a.png"}, {"a.jpg", "a.jpg"}}, "", ".gif"},
+	}
+	for _, test := range tests {
+		_, err := OutputPaths(test.inputs, test.outputDir, test.convertTo)
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+		} else if !strings.Contains(err.Error(), test.inputs[0].Path) || !strings.Contains(err.Error(), test.inputs[1].Path) {
+			t.Errorf("%s: error %q doesn't name both inputs", test.name, err)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"gopaint/format"
+	"gopaint/raster"
 	. "gopaint/reza"
 	"image"
+	"image/color"
 	"image/draw"
-	"image/jpeg"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -17,6 +20,18 @@ import (
 	win "github.com/lxn/win"
 )
 
+// Control characters we receive for the undo/redo shortcuts (Ctrl+Z, Ctrl+Y)
+const keyCtrlZ = 0x1A
+const keyCtrlY = 0x19
+
+// and for the clipboard ones (Ctrl+X, Ctrl+C, Ctrl+V)
+const keyCtrlX = 0x18
+const keyCtrlC = 0x03
+const keyCtrlV = 0x16
+
+// The timer moving the marching ants of the selection outline
+const antsTimer = 1
+
 // DrawingCanvas is the main drawing canvas
 type DrawingCanvas struct {
 	// Embed the Window interface
@@ -28,7 +43,14 @@ type DrawingCanvas struct {
 	// Extras
 	gridPen *Pen
 	// Own data
-	image *DrawingImage
+	// The composited image, it also keeps the file infos of the document
+	image   *DrawingImage
+	layers  *LayerStack
+	history *raster.History
+	// How the image is zoomed and which part of it the window shows
+	view raster.View
+	// true while a mouse down/up span is being recorded for undo
+	mouseEditing bool
 	// test
 	firstMove bool
 	lastPt    Point
@@ -43,6 +65,8 @@ func NewDrawingCanvas(parent Window) *DrawingCanvas {
 func (canvas *DrawingCanvas) Init(parent Window) {
 	logInfo("initializing canvas...")
 	canvas.firstMove = true
+	canvas.view.Zoom = raster.ZoomActual
+	canvas.history = raster.NewHistory(defaultHistoryMemoryLimit)
 	canvas.gridPen = NewDashPen(1, NewRgb(120, 120, 120))
 	canvas.Create("", win.WS_CHILD|win.WS_VISIBLE|win.WS_CLIPCHILDREN, 10, 10, 10, 10, parent)
 	canvas.SetPaintEventHandler(canvas.Paint)
@@ -51,7 +75,9 @@ func (canvas *DrawingCanvas) Init(parent Window) {
 	canvas.SetMouseUpEventHandler(canvas.MouseUp)
 	canvas.SetMouseWheelEventHandler(func(e *MouseWheelEvent) {
 		work := mainWindow.workspace
-		if e.WheelDelta > 0 {
+		if e.VirtualKey&win.MK_CONTROL != 0 {
+			work.ZoomWheel(e.WheelDelta)
+		} else if e.WheelDelta > 0 {
 			work.ScrollUp()
 		} else {
 			work.ScrollDown()
@@ -62,12 +88,29 @@ func (canvas *DrawingCanvas) Init(parent Window) {
 		status.Update("")
 	})
 	canvas.SetKeyPressEventHandler(func(keycode int) {
+		switch keycode {
+		case keyCtrlZ:
+			canvas.Undo()
+			return
+		case keyCtrlY:
+			canvas.Redo()
+			return
+		case keyCtrlX:
+			mainWindow.Cut()
+			return
+		case keyCtrlC:
+			mainWindow.Copy()
+			return
+		case keyCtrlV:
+			mainWindow.Paste()
+			return
+		}
 		tool := mainWindow.tools.GetCurrentTool()
 		if tool != nil {
 			e := ToolKeyEvent{
 				keycode: keycode,
-				context: canvas.image.context,
-				image:   canvas.image,
+				context: canvas.ActiveImage().context,
+				image:   canvas.ActiveImage(),
 				canvas:  canvas,
 			}
 			tool.keyPressEvent(&e)
@@ -75,6 +118,12 @@ func (canvas *DrawingCanvas) Init(parent Window) {
 	})
 	canvas.SetSetCursorEventHandler(canvas.UpdateCursor)
 	canvas.SetResizeEventHandler(canvas.OnResize)
+	canvas.SetTimerEventHandler(func(id uintptr) {
+		if id == antsTimer {
+			mainWindow.tools.toolSelect.marchAnts()
+		}
+	})
+	canvas.StartTimer(antsTimer, antInterval)
 	logInfo("Done initializing canvas")
 }
 
@@ -83,6 +132,9 @@ func (canvas *DrawingCanvas) Dispose() {
 	if canvas.image != nil {
 		canvas.image.Dispose()
 	}
+	if canvas.layers != nil {
+		canvas.layers.Dispose()
+	}
 	if canvas.context != nil {
 		canvas.context.Dispose()
 	}
@@ -104,7 +156,7 @@ func (canvas *DrawingCanvas) UpdateCursor() bool {
 		var winpt win.POINT
 		win.GetCursorPos(&winpt)
 		win.ScreenToClient(canvas.GetHandle(), &winpt)
-		ptMouse := Point{X: int(winpt.X), Y: int(winpt.Y)}
+		ptMouse := canvas.ToImage(Point{X: int(winpt.X), Y: int(winpt.Y)})
 		toolCursor := tool.getCursor(&ptMouse)
 		win.SetCursor(toolCursor)
 	} else {
@@ -119,7 +171,11 @@ func (canvas *DrawingCanvas) NewImage(width, height int) {
 	newImage := NewDrawingImage(width, height)
 	logInfo("Clear...")
 	newImage.filepath = ""
-	newImage.Clear(gdiplus.NewColor(255, 255, 255, 255))
+	background := NewLayer("Background", width, height)
+	background.Background = true
+	background.ClearRect(background.surface.Bounds(), Rgb(255, 255, 255))
+	layers := NewLayerStack()
+	layers.Insert(0, background)
 	/*
 		pen := gdiplus.NewPen(gdiplus.NewColor(0, 0, 0, 255), 7)
 		newImage.context.DrawLine(pen, 10.0, 210.0, 160.0, 400.0)
@@ -134,17 +190,120 @@ func (canvas *DrawingCanvas) NewImage(width, height int) {
 		gc.Close()
 		gc.FillStroke()
 	*/
+	canvas.replaceDocument(newImage, layers)
+}
+
+// setDocument makes the given image and layers current and disposes the old ones
+func (canvas *DrawingCanvas) setDocument(newImage *DrawingImage, layers *LayerStack) {
 	if canvas.image != nil {
 		canvas.image.Dispose()
 	}
+	if canvas.layers != nil {
+		canvas.layers.Dispose()
+	}
 	canvas.image = newImage
-	canvas.SetSize(width, height)
+	canvas.layers = layers
+	canvas.UpdateStatus()
+	mainWindow.UpdateLayerControls()
+}
+
+// replaceDocument is like setDocument but it also records the change in the undo history
+func (canvas *DrawingCanvas) replaceDocument(newImage *DrawingImage, layers *LayerStack) {
+	if canvas.image == nil {
+		canvas.setDocument(newImage, layers)
+		return
+	}
+	// The selection belongs to the old document
+	mainWindow.tools.toolSelect.Deselect()
+	before := newDocumentSnapshot(canvas)
+	canvas.setDocument(newImage, layers)
+	canvas.pushSnapshot(before, newDocumentSnapshot(canvas))
+}
+
+// ChangeLayers runs a change on the layer stack (add, delete, reorder...) and records it
+// in the undo history
+func (canvas *DrawingCanvas) ChangeLayers(change func(layers *LayerStack)) {
+	mainWindow.tools.toolSelect.Deselect()
+	before := newDocumentSnapshot(canvas)
+	change(canvas.layers)
+	canvas.pushSnapshot(before, newDocumentSnapshot(canvas))
+	mainWindow.UpdateLayerControls()
+	canvas.Repaint()
+}
+
+// ChangeActiveLayer runs a change of the properties of the active layer and records it
+func (canvas *DrawingCanvas) ChangeActiveLayer(change func(layer *Layer)) {
+	layer := canvas.ActiveLayer()
+	before := getLayerProperties(layer)
+	change(layer)
+	if after := getLayerProperties(layer); after != before {
+		canvas.history.Push(&propertiesStep{canvas: canvas, layer: canvas.layers.ActiveIndex(), before: before, after: after})
+	}
+	mainWindow.UpdateLayerControls()
+	canvas.Repaint()
+}
+
+// ActiveLayer returns the layer the tools are drawing on
+func (canvas *DrawingCanvas) ActiveLayer() *Layer {
+	return canvas.layers.Active()
+}
+
+// ActiveImage returns the surface of the active layer
+func (canvas *DrawingCanvas) ActiveImage() *DrawingImage {
+	return canvas.layers.Active().surface
+}
+
+// FlattenImage blends all the visible layers into a new image, that's what we save to disk
+func (canvas *DrawingCanvas) FlattenImage() *BGRA {
+	flat := NewBGRA(canvas.image.Bounds())
+	canvas.layers.Composite(flat, flat.Rect, false)
+	return flat
+}
+
+// BeginEdit must be called before changing the pixels of the active layer outside of a
+// mouse down/up span so that the change can be undone. Every call needs a matching EndEdit
+func (canvas *DrawingCanvas) BeginEdit() {
+	canvas.history.Begin(canvas.layers.ActiveIndex(), &canvas.ActiveImage().BGRA)
+}
+
+func (canvas *DrawingCanvas) EndEdit() {
+	layer := canvas.layers.ActiveIndex()
+	if delta := canvas.history.End(layer, &canvas.ActiveImage().BGRA); delta != nil {
+		canvas.history.Push(&pixelStep{canvas: canvas, layer: layer, delta: delta})
+	}
+}
+
+func (canvas *DrawingCanvas) Undo() {
+	// A floating selection is not part of the image yet, so we drop it instead of pasting
+	// it back. A pasted one is all the undo does then
+	toolSelect := mainWindow.tools.toolSelect
+	floating := toolSelect.floating
+	toolSelect.discardSelection()
+	if raster.UndoFloating(canvas.history, floating) {
+		canvas.historyChanged()
+	} else if floating != nil {
+		canvas.Repaint()
+	}
+}
+
+func (canvas *DrawingCanvas) Redo() {
+	mainWindow.tools.toolSelect.discardSelection()
+	if canvas.history.Redo() {
+		canvas.historyChanged()
+	}
+}
+
+func (canvas *DrawingCanvas) historyChanged() {
 	canvas.UpdateStatus()
+	mainWindow.workspace.RequestLayout()
+	mainWindow.UpdateTitle()
+	mainWindow.UpdateLayerControls()
+	canvas.Repaint()
 }
 
 func (canvas *DrawingCanvas) Resize(width, height int) {
-	prevWidth := canvas.GetSize().Width
-	prevHeight := canvas.GetSize().Height
+	prevWidth := canvas.image.Width()
+	prevHeight := canvas.image.Height()
 	log.Printf("Resizing from (%d x %d) to (%d x %d)...\n", prevWidth, prevHeight, width, height)
 	if prevWidth == width && prevHeight == height {
 		return
@@ -156,39 +315,202 @@ func (canvas *DrawingCanvas) Resize(width, height int) {
 		log.Panicln("WHY is canvas image INVALID!!!")
 	}
 	// We allocate new data with given new size
-	// then we copy/draw the old data/image into it
+	// then we copy the old layers into it
 	newImage := NewDrawingImage(width, height)
-	color := GetColorBackground()
-	newImage.Clear(&color)
-
-	// Lets use BitBlt for copying. Faster than raw copy
-	g := newImage.context3
-	copyWidth := Min(prevWidth, width)
-	copyHeight := Min(prevHeight, height)
-	g.BitBlt(0, 0, copyWidth, copyHeight, canvas.image.memdc, 0, 0, win.SRCCOPY)
+	gcolor := GetColorBackground()
+	color := FromGdiplusColor(&gcolor)
+	copyRect := image.Rect(0, 0, Min(prevWidth, width), Min(prevHeight, height))
 
-	//rect2 := canvas.image.Bounds()
-	//draw.Draw(newImage, rect2, canvas.image, image.Point{}, draw.Src)
+	layers := NewLayerStack()
+	for i := 0; i < canvas.layers.Count(); i++ {
+		layer := canvas.layers.Get(i)
+		newLayer := layer.CloneEmpty(width, height)
+		newLayer.ClearRect(newLayer.surface.Bounds(), color)
+		raster.CopyRect(&newLayer.surface.BGRA, &layer.surface.BGRA, copyRect)
+		layers.Insert(i, newLayer)
+	}
+	layers.SetActive(canvas.layers.ActiveIndex())
 
 	// Reserve the additional infos
 	newImage.filepath = canvas.image.filepath
 	newImage.sizeOnDisk = canvas.image.sizeOnDisk
 	newImage.lastSaved = canvas.image.lastSaved
 
-	canvas.image.Dispose()
-	canvas.image = newImage
-
-	canvas.SetSize(width, height)
-	canvas.UpdateStatus()
+	canvas.replaceDocument(newImage, layers)
 	logInfo("Done resizing")
 }
 
-func (canvas *DrawingCanvas) OpenImage(filename string) bool {
+// Reframe makes the canvas cover rect, given in the coordinates of the current canvas,
+// without moving the pixels. The area it adds gets the fill color on the background
+// layer and stays transparent on the others, a fill that isn't opaque makes the
+// background layer an ordinary one
+func (canvas *DrawingCanvas) Reframe(rect image.Rectangle, fill color.NRGBA) {
+	width, height := rect.Dx(), rect.Dy()
+	if width < 1 || height < 1 {
+		log.Printf("INVALID CANVAS SIZE - (%d x %d)\n", width, height)
+		return
+	}
+	log.Printf("Reframing to %v...\n", rect)
+	newImage := NewDrawingImage(width, height)
+
+	layers := NewLayerStack()
+	for i := 0; i < canvas.layers.Count(); i++ {
+		layer := canvas.layers.Get(i)
+		newLayer := layer.CloneEmpty(width, height)
+		if layer.Background {
+			raster.Fill(&newLayer.surface.BGRA, newLayer.surface.Rect, fill)
+			newLayer.Background = fill.A == 255
+		}
+		// The old pixels placed where they land on the new canvas
+		moved := layer.surface.BGRA
+		moved.Rect = moved.Rect.Sub(rect.Min)
+		raster.CopyRect(&newLayer.surface.BGRA, &moved, moved.Rect)
+		layers.Insert(i, newLayer)
+	}
+	layers.SetActive(canvas.layers.ActiveIndex())
+
+	newImage.filepath = canvas.image.filepath
+	newImage.sizeOnDisk = canvas.image.sizeOnDisk
+	newImage.lastSaved = canvas.image.lastSaved
+
+	canvas.replaceDocument(newImage, layers)
+}
+
+// Scale resamples every layer to width x height with the filter, then skews them by the
+// angles in degrees. The canvas grows to hold the skewed image
+func (canvas *DrawingCanvas) Scale(width, height int, skewX, skewY float64, filter raster.Filter) {
+	if width < 1 || height < 1 {
+		log.Printf("INVALID SCALE SIZE - (%d x %d)\n", width, height)
+		return
+	}
+	log.Printf("Scaling to (%d x %d), skewed by (%g, %g) degrees...\n", width, height, skewX, skewY)
+	m := raster.ResizeTransform(canvas.image.Rect, width, height, degreesToRadians(skewX), degreesToRadians(skewY))
+	canvas.transformLayers(m, filter, true)
+	logInfo("Done scaling")
+}
+
+// Rotate turns every layer clockwise by the angle in degrees, the canvas grows to hold
+// the turned image. The uncovered corners get the background color unless transparent
+// is set
+func (canvas *DrawingCanvas) Rotate(degrees float64, transparent bool, filter raster.Filter) {
+	log.Printf("Rotating by %g degrees...\n", degrees)
+	m := raster.RotateTransform(canvas.image.Rect, degreesToRadians(degrees))
+	canvas.transformLayers(m, filter, !transparent)
+	logInfo("Done rotating")
+}
+
+// transformLayers maps every layer through m into a canvas holding the result. The
+// corners it uncovers get the background color on the background layer when fill is
+// set, else they stay transparent and the layer is no background anymore
+func (canvas *DrawingCanvas) transformLayers(m raster.Affine, filter raster.Filter, fill bool) {
+	bounds := m.Bounds(canvas.image.Rect)
+	newImage := NewDrawingImage(bounds.Dx(), bounds.Dy())
+	gcolor := GetColorBackground()
+	color := FromGdiplusColor(&gcolor)
+
+	layers := NewLayerStack()
+	for i := 0; i < canvas.layers.Count(); i++ {
+		layer := canvas.layers.Get(i)
+		newLayer := layer.CloneEmpty(bounds.Dx(), bounds.Dy())
+		if fill {
+			newLayer.ClearRect(newLayer.surface.Bounds(), color)
+		} else {
+			newLayer.Background = false
+		}
+		transformed := raster.TransformImage(&layer.surface.BGRA, m, filter)
+		raster.Composite(&newLayer.surface.BGRA, transformed, transformed.Rect, 255, raster.BlendNormal, false)
+		layers.Insert(i, newLayer)
+	}
+	layers.SetActive(canvas.layers.ActiveIndex())
+
+	newImage.filepath = canvas.image.filepath
+	newImage.sizeOnDisk = canvas.image.sizeOnDisk
+	newImage.lastSaved = canvas.image.lastSaved
+
+	canvas.replaceDocument(newImage, layers)
+}
+
+// Reorient turns or flips every layer with one of the lossless transforms like
+// raster.RotateRight, the canvas takes the size of the result
+func (canvas *DrawingCanvas) Reorient(turn func(src *BGRA) *BGRA) {
+	layers := NewLayerStack()
+	var size image.Point
+	for i := 0; i < canvas.layers.Count(); i++ {
+		layer := canvas.layers.Get(i)
+		turned := turn(&layer.surface.BGRA)
+		size = turned.Rect.Size()
+		newLayer := layer.CloneEmpty(size.X, size.Y)
+		raster.CopyRect(&newLayer.surface.BGRA, turned, turned.Rect)
+		layers.Insert(i, newLayer)
+	}
+	layers.SetActive(canvas.layers.ActiveIndex())
+
+	newImage := NewDrawingImage(size.X, size.Y)
+	newImage.filepath = canvas.image.filepath
+	newImage.sizeOnDisk = canvas.image.sizeOnDisk
+	newImage.lastSaved = canvas.image.lastSaved
+
+	canvas.replaceDocument(newImage, layers)
+}
+
+// AutoTrim crops the document to what is inside the uniform borders of the visible
+// layers, false if there is nothing to cut off
+func (canvas *DrawingCanvas) AutoTrim(options raster.TrimOptions) bool {
+	flat := NewBGRA(canvas.image.Rect)
+	canvas.layers.Composite(flat, flat.Rect, false)
+	rect := raster.TrimBounds(flat, options)
+	if rect.Empty() || rect == flat.Rect {
+		return false
+	}
+	canvas.Crop(rect, nil)
+	return true
+}
+
+// Crop cuts the document down to the rectangle. When a mask is given, the pixels it
+// doesn't cover get erased like deleting a selection does
+func (canvas *DrawingCanvas) Crop(rect image.Rectangle, mask *image.Alpha) {
+	rect = rect.Intersect(canvas.image.Rect)
+	if rect.Empty() {
+		return
+	}
+	width, height := rect.Dx(), rect.Dy()
+	newImage := NewDrawingImage(width, height)
+	gcolor := GetColorBackground()
+	color := FromGdiplusColor(&gcolor)
+	var outside *image.Alpha
+	if mask != nil {
+		// In the coordinates of the cropped image
+		outside = raster.InvertMask(mask, rect)
+		outside.Rect = outside.Rect.Sub(rect.Min)
+	}
+
+	layers := NewLayerStack()
+	for i := 0; i < canvas.layers.Count(); i++ {
+		layer := canvas.layers.Get(i)
+		newLayer := layer.CloneEmpty(width, height)
+		cropped := raster.Crop(&layer.surface.BGRA, rect)
+		raster.CopyRect(&newLayer.surface.BGRA, cropped, cropped.Rect)
+		if outside != nil {
+			newLayer.ClearMask(outside, color)
+		}
+		layers.Insert(i, newLayer)
+	}
+	layers.SetActive(canvas.layers.ActiveIndex())
+
+	newImage.filepath = canvas.image.filepath
+	newImage.sizeOnDisk = canvas.image.sizeOnDisk
+	newImage.lastSaved = canvas.image.lastSaved
+
+	canvas.replaceDocument(newImage, layers)
+}
+
+// OpenImage replaces the document with the image file, the returned error is a *format.FileError
+func (canvas *DrawingCanvas) OpenImage(filename string) error {
 	log.Printf("Open image '%s'...\n", filename)
 	catFile, err := os.Open(filename)
 	if err != nil {
 		log.Println(err)
-		return false
+		return format.NewFileError(format.FileErrorIO, err)
 	}
 	defer catFile.Close()
 
@@ -197,23 +519,48 @@ func (canvas *DrawingCanvas) OpenImage(filename string) bool {
 	if err != nil {
 		// Could not obtain stat, handle error
 		log.Println(err)
-		return false
+		return format.NewFileError(format.FileErrorIO, err)
 	}
 	filesize := fi.Size()
 	modDate := fi.ModTime().Format("01-Jan-01 1:00 PM")
 
-	log.Println("Decoding...")
-	var imageData image.Image
-	ext := filepath.Ext(filename)
-	if strings.EqualFold(ext, ".jpg") || strings.EqualFold(ext, ".jpeg") {
-		imageData, err = jpeg.Decode(catFile)
-
-	} else {
-		imageData, _, err = image.Decode(catFile)
+	fileFormat, warning := format.SniffFormat(catFile, filename)
+	if fileFormat == nil {
+		log.Printf("Unknown file format (%s)\n", filepath.Ext(filename))
+		return format.NewFileError(format.FileErrorUnknownFormat, nil)
+	}
+	if len(warning) > 0 {
+		log.Println(warning)
+		ShowWarning(mainWindow, app.Title, warning)
 	}
+	if fileFormat.IsLayered() {
+		project, err := fileFormat.ReadProject(catFile, filesize)
+		if err != nil {
+			log.Println(err)
+			return format.NewFileError(format.FileErrorCorrupt, err)
+		}
+		newImage := NewDrawingImage(project.Width, project.Height)
+		newImage.filepath = filename
+		newImage.sizeOnDisk = filesize
+		newImage.lastSaved = modDate
+		canvas.replaceDocument(newImage, projectLayers(project))
+		if project.Format == format.ProjectFormatName {
+			mainWindow.applyProjectSettings(project)
+		}
+		canvas.Repaint()
+		if len(project.Warnings) > 0 {
+			log.Println(project.Warnings)
+			ShowWarning(mainWindow, app.Title, strings.Join(project.Warnings, "\n"))
+		}
+		log.Println("Done opening project")
+		return nil
+	}
+
+	log.Printf("Decoding %s...\n", fileFormat.Title)
+	imageData, err := fileFormat.Function(catFile, nil, false)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		log.Println(err)
+		return format.NewFileError(format.FileErrorCorrupt, err)
 	}
 	log.Println("Done decoding!")
 
@@ -221,49 +568,70 @@ func (canvas *DrawingCanvas) OpenImage(filename string) bool {
 	width, height := bounds.Size().X, bounds.Size().Y
 
 	newImage := NewDrawingImage(width, height)
+	// Opaque images become a background layer, the rest keep their transparency
+	var layer *Layer
+	if opaque, ok := imageData.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		layer = NewLayer("Background", width, height)
+		layer.Background = true
+	} else {
+		layer = NewLayer("Layer 1", width, height)
+	}
 	logInfo("Copy image data into canvas image....")
-	draw.Draw(newImage, newImage.Bounds(), imageData, image.Point{}, draw.Src)
+	draw.Draw(layer.surface, layer.surface.Bounds(), imageData, bounds.Min, draw.Src)
+	layers := NewLayerStack()
+	layers.Insert(0, layer)
 
 	newImage.filepath = filename
 	newImage.sizeOnDisk = filesize
 	newImage.lastSaved = modDate
-	if canvas.image != nil {
-		canvas.image.Dispose()
-	}
-	canvas.image = newImage
-	canvas.SetSize(width, height)
-	canvas.UpdateStatus()
+	canvas.replaceDocument(newImage, layers)
 	canvas.Repaint()
 	log.Println("Done opening image")
-	return true
+	return nil
 }
 
-func (canvas *DrawingCanvas) SaveImage(filePath string) bool {
+// SaveImage writes the document in the format matching the file extension, with the
+// options for the formats that have any. The file is only replaced once the whole image
+// got written, the returned error is a *format.FileError
+func (canvas *DrawingCanvas) SaveImage(filePath string, options format.EncodeOptions) error {
 	log.Printf("Saving image '%s'...\n", filePath)
-	fd, err := os.Create(filePath)
-	if err != nil {
-		log.Println(err)
-		return false
-	}
-	defer fd.Close()
-
+	// Check the format before touching the file, we don't want to leave an empty file behind
 	ext := filepath.Ext(filePath)
-	format := FindFormatFromExt(ext)
-	if format != nil {
-		format.Function(fd, canvas.image, true)
+	fileFormat := format.FindFormatFromExt(ext)
+	if fileFormat == nil || !fileFormat.Encodable {
+		log.Printf("No encoder for the file format/extension (%s)\n", ext)
+		return format.NewFileError(format.FileErrorUnknownFormat, fmt.Errorf("no encoder for '%s' files", ext))
+	}
+
+	// A floating selection isn't part of the layer until it gets pasted back
+	canvas.BeginEdit()
+	mainWindow.tools.toolSelect.finalizeSelection()
+	canvas.EndEdit()
+
+	var err error
+	if fileFormat.IsLayered() {
+		project := canvas.NewProject()
+		err = format.WriteFileAtomic(filePath, func(w io.ReadWriter) error {
+			return fileFormat.WriteProject(w, project)
+		})
 	} else {
-		log.Printf("Unknown file format/extension (%s)\n", ext)
-		return false
+		err = format.EncodeImageFile(filePath, canvas.FlattenImage(), options)
+	}
+	if err != nil {
+		log.Println(err)
+		return err
 	}
 	log.Printf("Done Saving image\n")
-	return true
+	return nil
 }
 
 func (canvas *DrawingCanvas) UpdateStatus() {
-	size := canvas.GetSize()
 	scz := mainWindow.statusCanvasSize
 	if scz != nil {
-		scz.Update(strconv.Itoa(size.Width) + " x " + strconv.Itoa(size.Height) + "px")
+		scz.Update(strconv.Itoa(canvas.image.Width()) + " x " + strconv.Itoa(canvas.image.Height()) + "px")
+	}
+	if szoom := mainWindow.statusZoom; szoom != nil {
+		szoom.Update(canvas.view.Zoom.String())
 	}
 	sfz := mainWindow.statusFileSize
 	imageSize, available := canvas.image.SizeOnDisk()
@@ -281,56 +649,75 @@ func (canvas *DrawingCanvas) UpdateMousePosStatus() {
 	ptScreen := app.GetCursorPos()
 	if status != nil {
 		if wndRect.IsPointInside(&ptScreen) {
-			status.Update(strconv.Itoa(ptScreen.X) + ", " + strconv.Itoa(ptScreen.Y) + "px")
+			pt := canvas.ToImage(Point{X: ptScreen.X - wndRect.Left, Y: ptScreen.Y - wndRect.Top})
+			status.Update(strconv.Itoa(pt.X) + ", " + strconv.Itoa(pt.Y) + "px")
 		} else {
 			status.Update("")
 		}
 	}
 }
 
-func (canvas *DrawingCanvas) MouseDown(pt *Point, mbutton int) {
+func (canvas *DrawingCanvas) MouseDown(mousepoint *Point, mbutton int) {
+	pt := canvas.ToImage(*mousepoint)
 	win.SetCapture(canvas.GetHandle())
+	// Grab the keyboard focus too for the shortcuts
+	win.SetFocus(canvas.GetHandle())
+	if !canvas.mouseEditing {
+		canvas.BeginEdit()
+		canvas.mouseEditing = true
+	}
 	tool := mainWindow.tools.GetCurrentTool()
 	if canvas.firstMove {
-		canvas.lastPt = *pt
+		canvas.lastPt = pt
 		canvas.firstMove = false
 	}
 
 	e := ToolMouseEvent{
-		pt:      *pt,
+		pt:      pt,
 		lastPt:  canvas.lastPt,
 		mbutton: mbutton,
-		context: canvas.image.context,
-		image:   canvas.image,
+		context: canvas.ActiveImage().context,
+		image:   canvas.ActiveImage(),
 		canvas:  canvas,
 	}
-	tool.mouseDownEvent(&e)
+	if !canvas.isToolBlocked(tool) {
+		tool.mouseDownEvent(&e)
+		canvas.clipToSelection(tool, &e)
+	}
 	canvas.Repaint()
-	canvas.lastPt = *pt
+	canvas.lastPt = pt
 }
 
-func (canvas *DrawingCanvas) MouseUp(pt *Point, mbutton int) {
+func (canvas *DrawingCanvas) MouseUp(mousepoint *Point, mbutton int) {
+	pt := canvas.ToImage(*mousepoint)
 	tool := mainWindow.tools.GetCurrentTool()
 	if canvas.firstMove {
-		canvas.lastPt = *pt
+		canvas.lastPt = pt
 		canvas.firstMove = false
 	}
 	e := ToolMouseEvent{
-		pt:      *pt,
+		pt:      pt,
 		lastPt:  canvas.lastPt,
 		mbutton: mbutton,
-		context: canvas.image.context,
-		image:   canvas.image,
+		context: canvas.ActiveImage().context,
+		image:   canvas.ActiveImage(),
 		canvas:  canvas,
 	}
-	tool.mouseUpEvent(&e)
+	if !canvas.isToolBlocked(tool) {
+		tool.mouseUpEvent(&e)
+		canvas.clipToSelection(tool, &e)
+	}
+	if canvas.mouseEditing {
+		canvas.EndEdit()
+		canvas.mouseEditing = false
+	}
 	canvas.RepaintVisible()
-	canvas.lastPt = *pt
+	canvas.lastPt = pt
 	win.ReleaseCapture()
 }
 
 func (canvas *DrawingCanvas) MouseMove(mousepoint *Point, mbutton int) {
-	pt := *mousepoint
+	pt := canvas.ToImage(*mousepoint)
 	tool := mainWindow.tools.GetCurrentTool()
 	if canvas.firstMove {
 		canvas.lastPt = pt
@@ -340,16 +727,49 @@ func (canvas *DrawingCanvas) MouseMove(mousepoint *Point, mbutton int) {
 		pt:      pt,
 		lastPt:  canvas.lastPt,
 		mbutton: mbutton,
-		context: canvas.image.context,
-		image:   canvas.image,
+		context: canvas.ActiveImage().context,
+		image:   canvas.ActiveImage(),
 		canvas:  canvas,
 	}
-	tool.mouseMoveEvent(&e)
+	if !canvas.isToolBlocked(tool) {
+		tool.mouseMoveEvent(&e)
+		canvas.clipToSelection(tool, &e)
+	}
 	canvas.UpdateMousePosStatus()
 	canvas.RepaintVisible()
 	canvas.lastPt = pt
 }
 
+// clipToSelection takes back what a painting tool did outside of the selection with the
+// mouse event. Tools painting along the mouse path only get the pixels of the last
+// segment checked, for the others we go over the whole layer
+func (canvas *DrawingCanvas) clipToSelection(tool Tool, e *ToolMouseEvent) {
+	selection := mainWindow.tools.toolSelect
+	if tool == selection || tool == mainWindow.tools.toolPickColor || selection.mask == nil {
+		return
+	}
+	before := canvas.history.Before()
+	if before == nil {
+		return
+	}
+	img := &canvas.ActiveImage().BGRA
+	rect := img.Rect
+	if stroke, ok := tool.(strokeTool); ok {
+		rect = stroke.strokeBounds(e)
+	}
+	raster.ClipToMask(img, before, selection.mask, rect)
+}
+
+// A locked or hidden layer can't be painted on, only the color picker and the magnifier
+// still work
+func (canvas *DrawingCanvas) isToolBlocked(tool Tool) bool {
+	layer := canvas.ActiveLayer()
+	if !layer.Locked && layer.Visible {
+		return false
+	}
+	return tool != mainWindow.tools.toolPickColor && tool != mainWindow.tools.toolMagnifier
+}
+
 func (canvas *DrawingCanvas) OnResize(rect *Rect) {
 	logInfo("canvas resize...")
 	if canvas.mhdc != 0 {
@@ -358,7 +778,8 @@ func (canvas *DrawingCanvas) OnResize(rect *Rect) {
 	if canvas.mbitmap != 0 {
 		win.DeleteObject(win.HGDIOBJ(canvas.mbitmap))
 	}
-	rcVisible := *rect ///canvas.GetVisibleRect()
+	// The window only covers the visible part of the image, so does the buffer
+	rcVisible := *rect
 
 	hdc := win.GetDC(canvas.GetHandle())
 	canvas.mhdc = win.CreateCompatibleDC(hdc)
@@ -376,61 +797,44 @@ func (canvas *DrawingCanvas) OnResize(rect *Rect) {
 	//canvas.context.SetSmoothingMode(gdiplus.SmoothingModeHighSpeed)
 }
 
-// This returns only the visible area of the canvas, not the whole client rect
-func (canvas *DrawingCanvas) GetVisibleRect() Rect {
-	work := mainWindow.workspace
-	if work == nil {
-		return canvas.GetClientRect()
-	}
-	// Get Screen Space Rects
-	rcWork := work.GetWindowRect()
-	rcCanvas := canvas.GetWindowRect()
-
-	// See if some portion of the left or top side of the canvas is hidden/we scrolled
-	// the width and height of workspace area should be enough
-	// ---(that just also includes the workspace scrollbars sizes too which is not a big deal, i hope :)
+// ToImage returns the image pixel under a point of the canvas window, every mouse event
+// goes through it so the tools always work in image coordinates
+func (canvas *DrawingCanvas) ToImage(pt Point) Point {
+	p := canvas.view.ToImage(image.Pt(pt.X, pt.Y))
+	return Point{X: p.X, Y: p.Y}
+}
 
-	canvasTotalWidth := rcCanvas.Width() + (canvasMargin * 2)   // mul by 2 for both sides
-	canvasTotalHeight := rcCanvas.Height() + (canvasMargin * 2) // mul by 2 for both sides
+// ViewSize returns the size of the whole image at the current zoom
+func (canvas *DrawingCanvas) ViewSize() Size {
+	size := canvas.view.Zoom.Size(canvas.image.Rect.Size())
+	return Size{Width: size.X, Height: size.Y}
+}
 
-	var rcVisible Rect
-	// If the whole width fits the workspace we just assign the original width with left being 0
-	if canvasTotalWidth <= rcWork.Width() {
-		rcVisible.Right = rcCanvas.Width()
-	} else {
-		if rcCanvas.Left < rcWork.Left {
-			rcVisible.Left = rcWork.Left - rcCanvas.Left
-		}
-		rcVisible.Right = rcVisible.Left + rcWork.Width()
-	}
-	// If the whole height fits the workspace we just assign the original height with top being 0
-	if canvasTotalHeight <= rcWork.Height() {
-		rcVisible.Bottom = rcCanvas.Height()
-	} else {
-		if rcCanvas.Top < rcWork.Left {
-			rcVisible.Top = rcWork.Top - rcCanvas.Top
-		}
-		rcVisible.Bottom = rcVisible.Top + rcWork.Height()
-	}
-	return rcVisible
+// This returns the part of the image the window shows, in image coordinates
+func (canvas *DrawingCanvas) GetVisibleRect() Rect {
+	client := canvas.GetClientRect()
+	rect := canvas.view.RectToImage(client.AsImageRect()).Intersect(canvas.image.Rect)
+	return Rect{Left: rect.Min.X, Top: rect.Min.Y, Right: rect.Max.X, Bottom: rect.Max.Y}
 }
 
 func (canvas *DrawingCanvas) RepaintVisible() {
-	rect := canvas.GetVisibleRect()
-	canvas.InvalidateRect(&rect, false)
+	canvas.InvalidateRect(nil, false)
 }
 
+// DrawGridLines draws a line every 10 image pixels, as long as they don't get too close
 func (canvas *DrawingCanvas) DrawGridLines(g *Graphics, rect *Rect, rcVisible *Rect) {
+	const spacing = 10
+	if canvas.view.Zoom.Scale(spacing) < 4 {
+		return
+	}
 	g.SelectObject(canvas.gridPen)
-	for x := 10; x <= rect.Right; x += 10 {
-		if x > rcVisible.Left && x < rcVisible.Right {
-			g.DrawLineOnly(x, 0, x, rect.Bottom)
-		}
+	for x := (rcVisible.Left/spacing + 1) * spacing; x < rcVisible.Right; x += spacing {
+		wx := canvas.view.ToWindow(image.Pt(x, 0)).X
+		g.DrawLineOnly(wx, rect.Top, wx, rect.Bottom)
 	}
-	for y := 10; y <= rect.Bottom; y += 10 {
-		if y > rcVisible.Top && y < rcVisible.Bottom {
-			g.DrawLineOnly(0, y, rect.Right, y)
-		}
+	for y := (rcVisible.Top/spacing + 1) * spacing; y < rcVisible.Bottom; y += spacing {
+		wy := canvas.view.ToWindow(image.Pt(0, y)).Y
+		g.DrawLineOnly(rect.Left, wy, rect.Right, wy)
 	}
 }
 
@@ -442,39 +846,55 @@ func (canvas *DrawingCanvas) Paint(g *Graphics, rect *Rect) {
 	if image == nil {
 		return
 	}
+	client := canvas.GetClientRect()
 	rcVisible := canvas.GetVisibleRect()
-	clip := CreateRectRgn(int32(rcVisible.Left), int32(rcVisible.Top), int32(rcVisible.Right), int32(rcVisible.Bottom))
-	SelectClipRgn(canvas.mhdc, clip)
-
-	gmem := NewGraphics(canvas.mhdc)
-
-	gmem.BitBlt(rcVisible.Left, rcVisible.Top,
-		rcVisible.Width(), rcVisible.Height(), image.memdc,
-		rcVisible.Left, rcVisible.Top, win.SRCCOPY)
-	//gmem.AlphaBlend(rcVisible.Left, rcVisible.Top, rcVisible.Width(), rcVisible.Height(),
-	//image.memdc, rcVisible.Left, rcVisible.Top, rcVisible.Width(), rcVisible.Height())
-
-	if mainWindow.bShowGridlines.IsToggled() {
-		canvas.DrawGridLines(gmem, rect, &rcVisible)
+	// Only the invalidated part needs to be drawn again, the buffer keeps the rest
+	var clip win.RECT
+	if GetClipBox(g.GetHDC(), &clip) != win.NULLREGION {
+		clipRect := FromRECT(&clip)
+		dirty := canvas.view.RectToImage(clipRect.AsImageRect()).Intersect(rcVisible.AsImageRect())
+		rcVisible = Rect{Left: dirty.Min.X, Top: dirty.Min.Y, Right: dirty.Max.X, Bottom: dirty.Max.Y}
 	}
 
+	// Blend the layers into the canvas image, only the visible part
+	canvas.layers.Composite(&image.BGRA, rcVisible.AsImageRect(), true)
+
+	// The tools draw their previews over it in image coordinates too
 	var winpt win.POINT
 	win.GetCursorPos(&winpt)
 	win.ScreenToClient(canvas.GetHandle(), &winpt)
-	ptMouse := Point{X: int(winpt.X), Y: int(winpt.Y)}
+	ptMouse := canvas.ToImage(Point{X: int(winpt.X), Y: int(winpt.Y)})
 	tool := mainWindow.tools.GetCurrentTool()
 	if tool != nil {
 		e := ToolDrawEvent{
-			gdi32:    gmem,
-			graphics: canvas.context,
+			gdi32:    image.context3,
+			graphics: image.context,
 			mouse:    ptMouse,
 		}
 		tool.draw(&e)
+		// The selection stays while the other tools paint inside it
+		if selection := mainWindow.tools.toolSelect; tool != selection {
+			selection.drawOutline(image.context3)
+		}
 	}
 
-	g.BitBlt(rcVisible.Left, rcVisible.Top,
-		rcVisible.Width(), rcVisible.Height(),
-		canvas.mhdc, rcVisible.Left, rcVisible.Top, win.SRCCOPY)
+	// Then it gets zoomed into the buffer, with big square pixels when zoomed in
+	dst := canvas.view.RectToWindow(rcVisible.AsImageRect())
+	if canvas.view.Zoom.Shrinks() {
+		win.SetStretchBltMode(canvas.mhdc, win.HALFTONE)
+		win.SetBrushOrgEx(canvas.mhdc, 0, 0, nil)
+	} else {
+		win.SetStretchBltMode(canvas.mhdc, win.COLORONCOLOR)
+	}
+	win.StretchBlt(canvas.mhdc, int32(dst.Min.X), int32(dst.Min.Y), int32(dst.Dx()), int32(dst.Dy()),
+		image.memdc, int32(rcVisible.Left), int32(rcVisible.Top), int32(rcVisible.Width()), int32(rcVisible.Height()),
+		win.SRCCOPY)
+
+	gmem := NewGraphics(canvas.mhdc)
+	if mainWindow.bShowGridlines.IsToggled() {
+		canvas.DrawGridLines(gmem, &client, &rcVisible)
+	}
 
-	win.DeleteObject(win.HGDIOBJ(clip))
+	g.BitBlt(client.Left, client.Top, client.Width(), client.Height(),
+		canvas.mhdc, client.Left, client.Top, win.SRCCOPY)
 }
@@ -1,15 +1,75 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"gopaint/format"
+	"gopaint/raster"
 	. "gopaint/reza"
+	"image"
+	"image/color"
 	"log"
+	"math"
 	"strconv"
 )
 
 type ResizeDialog struct {
 	Dialog
+	wholeImage Button
+	selection  Button
+	percentage Button
+	pixels     Button
+	horizontal TextBox
+	vertical   TextBox
+	keepAspect Button
+	skewX      TextBox
+	skewY      TextBox
+	filters    []Button
 }
 
+// Palette sizes offered by the GIF dialog
+var gifPaletteSizes = [4]int{256, 128, 64, 16}
+
+type GifDialog struct {
+	Dialog
+	colors [4]Button
+	dither Button
+}
+
+type RotateDialog struct {
+	Dialog
+	angle       TextBox
+	background  Button
+	transparent Button
+}
+
+type CanvasSizeDialog struct {
+	Dialog
+	units       [4]Button
+	dpi         TextBox
+	width       TextBox
+	height      TextBox
+	anchors     [9]Button
+	padding     [4]TextBox
+	background  Button
+	transparent Button
+	custom      Button
+	customColor TextBox
+	// The unit the lengths in the text boxes are in
+	unit int
+}
+
+// Units the canvas size dialog takes lengths in
+const (
+	unitPixels = iota
+	unitPercent
+	unitCentimeters
+	unitInches
+)
+
+// The canvas size dialog doesn't make canvases larger than this on either side
+const maxCanvasSize = 32768
+
 type PropertiesDialog struct {
 	Dialog
 	lastSaved  Label
@@ -26,28 +86,485 @@ func NewResizeDialog(parent Window) *ResizeDialog {
 
 func (dlg *ResizeDialog) Init(parent Window) {
 	logInfo("Initialize Resize dialog...")
-	dlg.Dialog.Initialize(parent, "Resize", 300, 320)
+	dlg.Dialog.Initialize(parent, "Resize and Skew", 300, 560)
+
+	dlg.filters = make([]Button, raster.GetFilterCount())
+	filterButtons := []Widget{}
+	for i := range dlg.filters {
+		filterButtons = append(filterButtons, &WRadioButton{Text: raster.Filter(i).String(),
+			Margins: Margins{Right: 20, Bottom: 10}, AssignTo: &dlg.filters[i]})
+	}
 
 	dlg.AddWidgets([]Widget{
-		&WGroup{Text: "Resize", DockType: DockFill,
-			Margins: Margins{Left: 10, Top: 10, Right: 10, Bottom: 10}, Widgets: []Widget{
+		&WGroup{Text: "Apply to", DockType: DockTop, Height: 70,
+			Margins: Margins{Left: 10, Top: 10, Right: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 5}, Widgets: []Widget{
+						&WRadioButton{Text: "Image", Margins: Margins{Right: 20}, Checked: true, AssignTo: &dlg.wholeImage},
+						&WRadioButton{Text: "Selection", Margins: Margins{Right: 20}, AssignTo: &dlg.selection},
+					}},
+			}},
+		&WGroup{Text: "Resize", DockType: DockTop, Height: 190,
+			Margins: Margins{Left: 10, Top: 10, Right: 10}, Widgets: []Widget{
 				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
 					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 10}, Widgets: []Widget{
 						&WLabel{Text: "By:\t"},
-						&WRadioButton{Text: "Parcentage", Margins: Margins{Right: 20}},
-						&WRadioButton{Text: "Pixels", Margins: Margins{Right: 20, Bottom: 20}, Checked: true},
+						&WRadioButton{Text: "Percentage", Margins: Margins{Right: 20}, Checked: true, AssignTo: &dlg.percentage},
+						&WRadioButton{Text: "Pixels", Margins: Margins{Right: 20, Bottom: 20}, AssignTo: &dlg.pixels},
 
 						&WImageViewer{Path: ".\\icons\\horizintal.png", Margins: Margins{Right: 30, Bottom: 20}},
 						&WLabel{Text: "Horizintal:\t", Margins: Margins{Top: 5}},
-						&WTextBox{Text: "100", Width: 60, Height: 24, Margins: Margins{Right: 20}},
+						&WTextBox{Text: "100", Width: 60, Height: 24, Margins: Margins{Right: 20}, AssignTo: &dlg.horizontal},
 
 						&WImageViewer{Path: ".\\icons\\vertical.png", Margins: Margins{Right: 30, Bottom: 20}},
 						&WLabel{Text: "Vertical:\t\t", Margins: Margins{Top: 5}},
-						&WTextBox{Text: "100", Width: 60, Height: 24, Margins: Margins{Right: 20}},
+						&WTextBox{Text: "100", Width: 60, Height: 24, Margins: Margins{Right: 20}, AssignTo: &dlg.vertical},
+
+						&WCheckButton{Text: "Maintain aspect ratio", Checked: true, AssignTo: &dlg.keepAspect},
+					}},
+			}},
+		&WGroup{Text: "Skew (Degrees)", DockType: DockTop, Height: 130,
+			Margins: Margins{Left: 10, Top: 10, Right: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 10}, Widgets: []Widget{
+						&WImageViewer{Path: ".\\icons\\horizintal.png", Margins: Margins{Right: 30, Bottom: 20}},
+						&WLabel{Text: "Horizintal:\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, Margins: Margins{Right: 20}, AssignTo: &dlg.skewX},
 
-						&WCheckButton{Text: "Maintain aspect ratio", Checked: true},
+						&WImageViewer{Path: ".\\icons\\vertical.png", Margins: Margins{Right: 30, Bottom: 20}},
+						&WLabel{Text: "Vertical:\t\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, Margins: Margins{Right: 20}, AssignTo: &dlg.skewY},
 					}},
 			}},
+		&WGroup{Text: "Resampling", DockType: DockFill,
+			Margins: Margins{Left: 10, Top: 10, Right: 10, Bottom: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 10}, Widgets: filterButtons},
+			}},
+	})
+}
+
+// Show asks how to resize and skew the selection, or the whole image, and applies it.
+// The selection is the default when there is one
+func (dlg *ResizeDialog) Show() {
+	canvas := mainWindow.workspace.canvas
+	tool := mainWindow.tools.toolSelect
+	hasSelection := tool.TransformSize() != image.Point{}
+	dlg.wholeImage.SetChecked(!hasSelection)
+	dlg.selection.SetChecked(hasSelection)
+	dlg.percentage.SetChecked(true)
+	dlg.pixels.SetChecked(false)
+	dlg.horizontal.SetText("100")
+	dlg.vertical.SetText("100")
+	dlg.skewX.SetText("0")
+	dlg.skewY.SetText("0")
+	for i, button := range dlg.filters {
+		button.SetChecked(raster.Filter(i) == tool.filter)
+	}
+	dlg.Dialog.ShowChecked(true, func() bool {
+		filter := raster.FilterNearest
+		for i, button := range dlg.filters {
+			if button.IsChecked() {
+				filter = raster.Filter(i)
+			}
+		}
+		skewX, err := strconv.ParseFloat(dlg.skewX.GetText(), 64)
+		if err != nil {
+			return invalidInput(dlg.Dialog, "Enter a number for the horizontal skew.")
+		}
+		skewY, err := strconv.ParseFloat(dlg.skewY.GetText(), 64)
+		if err != nil {
+			return invalidInput(dlg.Dialog, "Enter a number for the vertical skew.")
+		}
+		if math.Abs(skewX) > 89 || math.Abs(skewY) > 89 {
+			return invalidInput(dlg.Dialog, "Enter a skew between -89 and 89 degrees.")
+		}
+		onSelection := hasSelection && dlg.selection.IsChecked()
+		size := image.Pt(canvas.image.Width(), canvas.image.Height())
+		if onSelection {
+			size = tool.TransformSize()
+		}
+		width, height, err := dlg.targetSize(size)
+		if err != nil {
+			return invalidInput(dlg.Dialog, err.Error())
+		}
+		if onSelection {
+			mainWindow.SetCurrentTool(tool)
+			mainWindow.SetResampling(filter)
+			tool.Transform(width, height, skewX, skewY)
+		} else {
+			tool.Deselect()
+			canvas.Scale(width, height, skewX, skewY, filter)
+			mainWindow.workspace.RequestLayout()
+		}
+		return true
+	})
+}
+
+// invalidInput tells what is wrong with a field of the dialog, returns false so the
+// dialog stays open
+func invalidInput(dlg Dialog, text string) bool {
+	ShowError(dlg, "Invalid value", text)
+	return false
+}
+
+// targetSize reads the new size from the text boxes, in percent of size or in pixels.
+// When the aspect ratio is kept the vertical box is left out
+func (dlg *ResizeDialog) targetSize(size image.Point) (int, int, error) {
+	horizontal, err := strconv.ParseFloat(dlg.horizontal.GetText(), 64)
+	if err != nil {
+		return 0, 0, errors.New("Enter a number for the horizontal size.")
+	}
+	vertical, err := strconv.ParseFloat(dlg.vertical.GetText(), 64)
+	if err != nil {
+		return 0, 0, errors.New("Enter a number for the vertical size.")
+	}
+	keepAspect := dlg.keepAspect.IsChecked()
+	var width, height float64
+	if dlg.percentage.IsChecked() {
+		if keepAspect {
+			vertical = horizontal
+		}
+		width = float64(size.X) * horizontal / 100
+		height = float64(size.Y) * vertical / 100
+	} else {
+		width, height = horizontal, vertical
+		if keepAspect {
+			height = width * float64(size.Y) / float64(size.X)
+		}
+	}
+	w, h := int(math.Round(width)), int(math.Round(height))
+	if w < 1 || h < 1 {
+		return 0, 0, errors.New("Enter a size of at least 1 pixel.")
+	}
+	return w, h, nil
+}
+
+func NewGifDialog(parent Window) *GifDialog {
+	dlg := &GifDialog{Dialog: NewDialog()}
+	dlg.Init(parent)
+	return dlg
+}
+
+func (dlg *GifDialog) Init(parent Window) {
+	logInfo("Initialize GIF dialog...")
+	dlg.Dialog.Initialize(parent, "GIF Options", 300, 240)
+
+	dlg.AddWidgets([]Widget{
+		&WGroup{Text: "Palette", DockType: DockFill,
+			Margins: Margins{Left: 10, Top: 10, Right: 10, Bottom: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 10}, Widgets: []Widget{
+						&WLabel{Text: "Colors:	"},
+						&WRadioButton{Text: "256", Margins: Margins{Right: 10}, Checked: true, AssignTo: &dlg.colors[0]},
+						&WRadioButton{Text: "128", Margins: Margins{Right: 10}, AssignTo: &dlg.colors[1]},
+						&WRadioButton{Text: "64", Margins: Margins{Right: 10}, AssignTo: &dlg.colors[2]},
+						&WRadioButton{Text: "16", Margins: Margins{Right: 10, Bottom: 20}, AssignTo: &dlg.colors[3]},
+						&WCheckButton{Text: "Dithering (Floyd-Steinberg)", Checked: true, AssignTo: &dlg.dither},
+					}},
+			}},
+	})
+}
+
+// Show asks for the GIF options and runs fOnAccept with them
+func (dlg *GifDialog) Show(fOnAccept func(options format.GifOptions)) {
+	dlg.Dialog.Show(true, func() {
+		options := format.DefaultEncodeOptions.Gif
+		for i, button := range dlg.colors {
+			if button.IsChecked() {
+				options.Colors = gifPaletteSizes[i]
+			}
+		}
+		options.Dither = dlg.dither.IsChecked()
+		fOnAccept(options)
+	})
+}
+
+func NewRotateDialog(parent Window) *RotateDialog {
+	dlg := &RotateDialog{Dialog: NewDialog()}
+	dlg.Init(parent)
+	return dlg
+}
+
+func (dlg *RotateDialog) Init(parent Window) {
+	logInfo("Initialize Rotate dialog...")
+	dlg.Dialog.Initialize(parent, "Rotate", 300, 260)
+
+	dlg.AddWidgets([]Widget{
+		&WGroup{Text: "Angle", DockType: DockTop, Height: 80,
+			Margins: Margins{Left: 10, Top: 10, Right: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 5}, Widgets: []Widget{
+						&WLabel{Text: "Degrees (clockwise):\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, AssignTo: &dlg.angle},
+					}},
+			}},
+		&WGroup{Text: "Fill the corners with", DockType: DockFill,
+			Margins: Margins{Left: 10, Top: 10, Right: 10, Bottom: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 10}, Widgets: []Widget{
+						&WRadioButton{Text: "Background color", Margins: Margins{Right: 20}, Checked: true, AssignTo: &dlg.background},
+						&WRadioButton{Text: "Transparency", AssignTo: &dlg.transparent},
+					}},
+			}},
+	})
+}
+
+// Show asks for the angle to turn the floating selection, or the whole image, by and
+// turns it. The corner fill only matters for the image
+func (dlg *RotateDialog) Show() {
+	dlg.angle.SetText("0")
+	dlg.Dialog.ShowChecked(true, func() bool {
+		degrees, err := strconv.ParseFloat(dlg.angle.GetText(), 64)
+		if err != nil {
+			return invalidInput(dlg.Dialog, "Enter the angle in degrees.")
+		}
+		tool := mainWindow.tools.toolSelect
+		if tool.IsFloating() {
+			tool.Rotate(degrees)
+			return true
+		}
+		tool.Deselect()
+		mainWindow.workspace.canvas.Rotate(degrees, dlg.transparent.IsChecked(), tool.filter)
+		mainWindow.workspace.RequestLayout()
+		return true
+	})
+}
+
+func NewCanvasSizeDialog(parent Window) *CanvasSizeDialog {
+	dlg := &CanvasSizeDialog{Dialog: NewDialog()}
+	dlg.Init(parent)
+	return dlg
+}
+
+func (dlg *CanvasSizeDialog) Init(parent Window) {
+	logInfo("Initialize Canvas Size dialog...")
+	dlg.Dialog.Initialize(parent, "Canvas Size", 360, 620)
+
+	anchorNames := [9]string{"Top left", "Top", "Top right", "Left", "Center", "Right",
+		"Bottom left", "Bottom", "Bottom right"}
+	anchorButtons := []Widget{}
+	for i := range dlg.anchors {
+		anchorButtons = append(anchorButtons, &WRadioButton{Text: anchorNames[i], Width: 95, Height: 24,
+			Margins: Margins{Bottom: 5}, Checked: i == 4, AssignTo: &dlg.anchors[i]})
+	}
+
+	dlg.AddWidgets([]Widget{
+		&WGroup{Text: "Units", DockType: DockTop, Height: 110,
+			Margins: Margins{Left: 10, Top: 10, Right: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 5}, Widgets: []Widget{
+						&WRadioButton{Text: "Pixels", Margins: Margins{Right: 10}, Checked: true, AssignTo: &dlg.units[unitPixels]},
+						&WRadioButton{Text: "Percent", Margins: Margins{Right: 10}, AssignTo: &dlg.units[unitPercent]},
+						&WRadioButton{Text: "Centimeters", Margins: Margins{Right: 10}, AssignTo: &dlg.units[unitCentimeters]},
+						&WRadioButton{Text: "Inches", Margins: Margins{Right: 10, Bottom: 10}, AssignTo: &dlg.units[unitInches]},
+						&WLabel{Text: "Resolution (DPI):\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "96", Width: 60, Height: 24, AssignTo: &dlg.dpi},
+					}},
+			}},
+		&WGroup{Text: "New size", DockType: DockTop, Height: 80,
+			Margins: Margins{Left: 10, Top: 10, Right: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 5}, Widgets: []Widget{
+						&WLabel{Text: "Width:\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, Margins: Margins{Right: 20}, AssignTo: &dlg.width},
+						&WLabel{Text: "Height:\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, AssignTo: &dlg.height},
+					}},
+			}},
+		&WGroup{Text: "Anchor", DockType: DockTop, Height: 130,
+			Margins: Margins{Left: 10, Top: 10, Right: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 5}, Widgets: anchorButtons},
+			}},
+		&WGroup{Text: "Padding", DockType: DockTop, Height: 110,
+			Margins: Margins{Left: 10, Top: 10, Right: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 5}, Widgets: []Widget{
+						&WLabel{Text: "Left:\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, Margins: Margins{Right: 20, Bottom: 10}, AssignTo: &dlg.padding[0]},
+						&WLabel{Text: "Top:\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, Margins: Margins{Bottom: 10}, AssignTo: &dlg.padding[1]},
+						&WLabel{Text: "Right:\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, Margins: Margins{Right: 20}, AssignTo: &dlg.padding[2]},
+						&WLabel{Text: "Bottom:\t", Margins: Margins{Top: 5}},
+						&WTextBox{Text: "0", Width: 60, Height: 24, AssignTo: &dlg.padding[3]},
+					}},
+			}},
+		&WGroup{Text: "Fill", DockType: DockFill,
+			Margins: Margins{Left: 10, Top: 10, Right: 10, Bottom: 10}, Widgets: []Widget{
+				&WFlowContainer{FlowDirection: FlowLeftToRight, DockType: DockFill,
+					Margins: Margins{Left: 20, Top: 30, Right: 10, Bottom: 5}, Widgets: []Widget{
+						&WRadioButton{Text: "Background color", Margins: Margins{Right: 10}, Checked: true, AssignTo: &dlg.background},
+						&WRadioButton{Text: "Transparent", Margins: Margins{Right: 10, Bottom: 10}, AssignTo: &dlg.transparent},
+						&WRadioButton{Text: "Custom:", Margins: Margins{Right: 10}, AssignTo: &dlg.custom},
+						&WTextBox{Text: "#FFFFFF", Width: 80, Height: 24, AssignTo: &dlg.customColor},
+					}},
+			}},
+	})
+	for i, button := range dlg.units {
+		unit := i
+		button.SetClickEventHandler(func(sender Button) {
+			dlg.changeUnit(unit)
+		})
+	}
+}
+
+// toPixels converts a length in the unit to pixels, percentages are of reference
+func toPixels(value float64, unit int, dpi float64, reference int) int {
+	return int(math.Round(unitsToPixels(value, unit, dpi, reference)))
+}
+
+// unitsToPixels converts a length in the unit to a fractional number of pixels
+func unitsToPixels(value float64, unit int, dpi float64, reference int) float64 {
+	switch unit {
+	case unitPercent:
+		value = value * float64(reference) / 100
+	case unitCentimeters:
+		value = value / 2.54 * dpi
+	case unitInches:
+		value *= dpi
+	}
+	return value
+}
+
+// pixelsToUnits converts a length in pixels to the unit, the reverse of unitsToPixels
+func pixelsToUnits(pixels float64, unit int, dpi float64, reference int) float64 {
+	switch unit {
+	case unitPercent:
+		return pixels * 100 / float64(reference)
+	case unitCentimeters:
+		return pixels / dpi * 2.54
+	case unitInches:
+		return pixels / dpi
+	}
+	return pixels
+}
+
+// formatLength writes a length the way it is typed, whole pixels and two decimals
+// for the other units
+func formatLength(value float64, unit int) string {
+	if unit == unitPixels {
+		return strconv.Itoa(int(math.Round(value)))
+	}
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
+
+// changeUnit converts the lengths in the text boxes to the unit, what can't be read
+// is left as it is
+func (dlg *CanvasSizeDialog) changeUnit(unit int) {
+	if unit == dlg.unit {
+		return
+	}
+	dpi, err := strconv.ParseFloat(dlg.dpi.GetText(), 64)
+	if err != nil || dpi <= 0 {
+		ShowError(dlg.Dialog, "Invalid value", "Enter a valid resolution before changing the unit.")
+		for i, button := range dlg.units {
+			button.SetChecked(i == dlg.unit)
+		}
+		return
+	}
+	size := mainWindow.workspace.canvas.image.Bounds().Size()
+	boxes := []TextBox{dlg.width, dlg.height, dlg.padding[0], dlg.padding[1], dlg.padding[2], dlg.padding[3]}
+	// Horizontal lengths are percentages of the width, vertical ones of the height
+	references := []int{size.X, size.Y, size.X, size.Y, size.X, size.Y}
+	for i, box := range boxes {
+		value, err := strconv.ParseFloat(box.GetText(), 64)
+		if err != nil {
+			continue
+		}
+		pixels := unitsToPixels(value, dlg.unit, dpi, references[i])
+		box.SetText(formatLength(pixelsToUnits(pixels, unit, dpi, references[i]), unit))
+	}
+	dlg.unit = unit
+}
+
+// anchoredFrame returns where a canvas of width x height goes over one of the given
+// size, anchored at one of the nine points (0 is the top left, 8 the bottom right) and
+// grown by the padding on the left, top, right and bottom
+func anchoredFrame(size image.Point, width, height, anchor int, padding [4]int) image.Rectangle {
+	x := (size.X - width) * (anchor % 3) / 2
+	y := (size.Y - height) * (anchor / 3) / 2
+	return image.Rect(x-padding[0], y-padding[1], x+width+padding[2], y+height+padding[3])
+}
+
+// Show asks for the new canvas size, where the image goes on it and how the added area
+// gets filled, then changes the canvas
+func (dlg *CanvasSizeDialog) Show() {
+	canvas := mainWindow.workspace.canvas
+	size := canvas.image.Bounds().Size()
+	for i, button := range dlg.units {
+		button.SetChecked(i == unitPixels)
+	}
+	dlg.unit = unitPixels
+	dlg.width.SetText(strconv.Itoa(size.X))
+	dlg.height.SetText(strconv.Itoa(size.Y))
+	for _, box := range dlg.padding {
+		box.SetText("0")
+	}
+	dlg.Dialog.ShowChecked(true, func() bool {
+		unit := dlg.unit
+		dpi, err := strconv.ParseFloat(dlg.dpi.GetText(), 64)
+		if err != nil || dpi <= 0 {
+			return invalidInput(dlg.Dialog, "Enter a valid resolution.")
+		}
+		// Horizontal lengths are percentages of the width, vertical ones of the height
+		length := func(box TextBox, name string, reference int) (int, error) {
+			value, err := strconv.ParseFloat(box.GetText(), 64)
+			if err != nil {
+				return 0, fmt.Errorf("Enter a number for the %s.", name)
+			}
+			return toPixels(value, unit, dpi, reference), nil
+		}
+		width, err := length(dlg.width, "width", size.X)
+		if err != nil {
+			return invalidInput(dlg.Dialog, err.Error())
+		}
+		height, err := length(dlg.height, "height", size.Y)
+		if err != nil {
+			return invalidInput(dlg.Dialog, err.Error())
+		}
+		var padding [4]int
+		paddingNames := [4]string{"left padding", "top padding", "right padding", "bottom padding"}
+		for i, box := range dlg.padding {
+			reference := size.X
+			if i%2 == 1 {
+				reference = size.Y
+			}
+			if padding[i], err = length(box, paddingNames[i], reference); err != nil {
+				return invalidInput(dlg.Dialog, err.Error())
+			}
+		}
+		anchor := 4
+		for i, button := range dlg.anchors {
+			if button.IsChecked() {
+				anchor = i
+			}
+		}
+		var fill color.NRGBA
+		switch {
+		case dlg.background.IsChecked():
+			gcolor := GetColorBackground()
+			background := FromGdiplusColor(&gcolor)
+			fill = background.AsNRGBA()
+		case dlg.custom.IsChecked():
+			fill, err = format.ParseHexColor(dlg.customColor.GetText())
+			if err != nil {
+				return invalidInput(dlg.Dialog, "Enter the custom color as #RRGGBB or #RRGGBBAA.")
+			}
+		}
+		rect := anchoredFrame(size, width, height, anchor, padding)
+		if rect.Dx() < 1 || rect.Dy() < 1 {
+			return invalidInput(dlg.Dialog, "Enter a canvas size of at least 1 pixel.")
+		}
+		if rect.Dx() > maxCanvasSize || rect.Dy() > maxCanvasSize {
+			return invalidInput(dlg.Dialog, fmt.Sprintf("The canvas can't be larger than %d pixels on a side, it would be %d x %d pixels.",
+				maxCanvasSize, rect.Dx(), rect.Dy()))
+		}
+		mainWindow.tools.toolSelect.Deselect()
+		canvas.Reframe(rect, fill)
+		mainWindow.workspace.RequestLayout()
+		return true
 	})
 }
 
@@ -12,6 +12,9 @@ import (
 	win "github.com/lxn/win"
 )
 
+// DrawingImage puts GDI, GDI+ and gg drawing surfaces on top of the raster pixels.
+// The pixel work itself belongs to the raster package, the surfaces are only a
+// thin adapter for showing the pixels and for drawing text and shapes
 type DrawingImage struct {
 	BGRA
 	hbitmap    win.HBITMAP
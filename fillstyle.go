@@ -0,0 +1,112 @@
+package main
+
+import (
+	"gopaint/raster"
+	. "gopaint/reza"
+	"image"
+	"image/color"
+)
+
+// FillKind tells what the bucket and the shapes fill with
+type FillKind int
+
+const (
+	FillSolid FillKind = iota
+	FillGradient
+	FillPattern
+)
+
+// GradientColors picks the stops of a gradient from the current colors
+type GradientColors int
+
+const (
+	GradientForeToBack GradientColors = iota
+	GradientForeToTransparent
+	GradientForeBackFore
+	GradientRainbow
+)
+
+var gradientColorsNames = [...]string{
+	"Color 1 to color 2",
+	"Color 1 to transparent",
+	"Color 1, color 2, color 1",
+	"Rainbow",
+}
+
+func (colors GradientColors) String() string {
+	return gradientColorsNames[colors]
+}
+
+func GetGradientColorsCount() int {
+	return len(gradientColorsNames)
+}
+
+// FillStyle holds the gradient and pattern settings the bucket and the shapes share
+type FillStyle struct {
+	Gradient raster.GradientKind
+	Colors   GradientColors
+	// Tile of the pattern fills, nil until one gets loaded
+	Pattern *BGRA
+}
+
+// colorsForeBack returns the color of the mouse button first and the other one second
+func colorsForeBack(mbutton int) (first, second color.NRGBA) {
+	c1 := mainWindow.color1.GetColor()
+	c2 := mainWindow.color2.GetColor()
+	if mbutton == MouseButtonRight {
+		c1, c2 = c2, c1
+	}
+	return c1.AsNRGBA(), c2.AsNRGBA()
+}
+
+func (style *FillStyle) gradientStops(mbutton int) []raster.GradientStop {
+	first, second := colorsForeBack(mbutton)
+	switch style.Colors {
+	case GradientForeToTransparent:
+		transparent := first
+		transparent.A = 0
+		return []raster.GradientStop{{Offset: 0, Color: first}, {Offset: 1, Color: transparent}}
+	case GradientForeBackFore:
+		return []raster.GradientStop{{Offset: 0, Color: first}, {Offset: 0.5, Color: second}, {Offset: 1, Color: first}}
+	case GradientRainbow:
+		hues := []color.NRGBA{
+			{255, 0, 0, 255}, {255, 255, 0, 255}, {0, 255, 0, 255}, {0, 255, 255, 255},
+			{0, 0, 255, 255}, {255, 0, 255, 255}, {255, 0, 0, 255},
+		}
+		stops := make([]raster.GradientStop, len(hues))
+		for i, hue := range hues {
+			stops[i] = raster.GradientStop{Offset: float64(i) / float64(len(hues)-1), Color: hue}
+		}
+		return stops
+	default:
+		return []raster.GradientStop{{Offset: 0, Color: first}, {Offset: 1, Color: second}}
+	}
+}
+
+// NewPaint returns what to fill with for the mouse button. Gradients run from start to
+// end, a pattern fill without a pattern falls back to the solid color
+func (style *FillStyle) NewPaint(kind FillKind, mbutton int, start, end image.Point) raster.Paint {
+	switch {
+	case kind == FillGradient:
+		return &raster.Gradient{Kind: style.Gradient, Start: start, End: end, Stops: style.gradientStops(mbutton)}
+	case kind == FillPattern && style.Pattern != nil:
+		return &raster.Pattern{Image: style.Pattern}
+	}
+	first, _ := colorsForeBack(mbutton)
+	return raster.NewSolidPaint(first)
+}
+
+// gradientLine returns the start and end of a gradient spreading over the bounds when
+// the user didn't drag one, left to right or from the center outwards
+func gradientLine(kind raster.GradientKind, bounds image.Rectangle) (start, end image.Point) {
+	center := image.Pt((bounds.Min.X+bounds.Max.X)/2, (bounds.Min.Y+bounds.Max.Y)/2)
+	switch kind {
+	case raster.GradientLinear:
+		return image.Pt(bounds.Min.X, center.Y), image.Pt(bounds.Max.X, center.Y)
+	case raster.GradientAngular, raster.GradientDiamond:
+		return center, image.Pt(bounds.Max.X, center.Y)
+	default:
+		// Reach the corners
+		return center, bounds.Max
+	}
+}
@@ -0,0 +1,296 @@
+// Package format reads and writes the image files and projects GoPaint knows
+package format
+
+import (
+	"fmt"
+	"gopaint/raster"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+// GifOptions controls how images get reduced to a palette when saving GIF files
+type GifOptions struct {
+	// Palette size, at most 256. One entry goes to transparency if the image has any
+	Colors int
+	// Spread the color error with Floyd-Steinberg dithering
+	Dither bool
+}
+
+// EncodeOptions hold the settings of the formats which have any
+type EncodeOptions struct {
+	Gif GifOptions
+}
+
+// DefaultEncodeOptions are the settings files get saved with unless asked otherwise
+var DefaultEncodeOptions = EncodeOptions{Gif: GifOptions{Colors: 256, Dither: true}}
+
+// SupportedFormat describes a file format, Function decodes or encodes the flattened image
+type SupportedFormat struct {
+	Title      string
+	Extensions []string
+	// Signatures found at the start of the files, '?' matches any byte
+	Magic     []string
+	Function  func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error)
+	Encodable bool
+	// Formats with settings of their own encode with the given ones here, Function
+	// takes the default ones
+	EncodeWith func(w io.Writer, image image.Image, options EncodeOptions) error
+	// Formats keeping the layers read and write the whole document as a Project, the
+	// canvas uses these instead of Function which only deals with the flattened image
+	ReadProject  func(r io.ReaderAt, size int64) (*Project, error)
+	WriteProject func(w io.Writer, project *Project) error
+}
+
+// IsLayered tells whether the format keeps the layers of the document
+func (format *SupportedFormat) IsLayered() bool {
+	return format.ReadProject != nil && format.WriteProject != nil
+}
+
+var formats []SupportedFormat = []SupportedFormat{
+	{Title: "Bitmap Files", Extensions: []string{".bmp"},
+		Magic: []string{"BM"},
+		Function: func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error) {
+			if encode {
+				return image, bmp.Encode(w, image)
+			} else {
+				return bmp.Decode(w)
+			}
+		}, Encodable: true},
+	{Title: "PNG", Extensions: []string{".png"},
+		Magic: []string{"\x89PNG\r\n\x1a\n"},
+		Function: func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error) {
+			if encode {
+				return image, png.Encode(w, image)
+			} else {
+				return png.Decode(w)
+			}
+		}, Encodable: true},
+	{Title: "JPEG", Extensions: []string{".jpg", ".jpeg"},
+		Magic: []string{"\xff\xd8"},
+		Function: func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error) {
+			if encode {
+				return image, jpeg.Encode(w, image, &jpeg.Options{Quality: 100})
+			} else {
+				return jpeg.Decode(w)
+			}
+		}, Encodable: true},
+	{Title: "TIFF", Extensions: []string{".tif", ".tiff"},
+		Magic: []string{"II*\x00", "MM\x00*"},
+		Function: func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error) {
+			if encode {
+				return image, tiff.Encode(w, image, &tiff.Options{Compression: tiff.Deflate})
+			} else {
+				return tiff.Decode(w)
+			}
+		}, Encodable: true},
+	{Title: "WEBP", Extensions: []string{".webp"},
+		Magic: []string{"RIFF????WEBPVP8"},
+		Function: func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error) {
+			if encode {
+				return image, raster.EncodeWebP(w, image)
+			} else {
+				return webp.Decode(w)
+			}
+		}, Encodable: true},
+	{Title: "GIF", Extensions: []string{".gif"},
+		Magic: []string{"GIF87a", "GIF89a"},
+		Function: func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error) {
+			if encode {
+				return encodeGIF(w, image, DefaultEncodeOptions.Gif)
+			} else {
+				return gif.Decode(w)
+			}
+		}, Encodable: true,
+		EncodeWith: func(w io.Writer, image image.Image, options EncodeOptions) error {
+			_, err := encodeGIF(w, image, options.Gif)
+			return err
+		}},
+	{Title: "GoPaint Project", Extensions: []string{ProjectExtension},
+		Magic: []string{zipMagic(projectManifestFile)},
+		Function: func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error) {
+			if encode {
+				return image, WriteProject(w, NewProjectFromImage(image))
+			} else {
+				project, err := readProjectFrom(w)
+				if err != nil {
+					return nil, err
+				}
+				return project.Flatten(), nil
+			}
+		}, Encodable: true, ReadProject: ReadProject, WriteProject: WriteProject},
+	{Title: "OpenRaster", Extensions: []string{".ora"},
+		Magic: []string{zipMagic("mimetype" + oraMimeType)},
+		Function: func(w io.ReadWriter, image image.Image, encode bool) (image.Image, error) {
+			if encode {
+				return image, WriteOpenRaster(w, NewProjectFromImage(image))
+			} else {
+				return readOpenRasterMerged(w)
+			}
+		}, Encodable: true, ReadProject: ReadOpenRaster, WriteProject: WriteOpenRaster},
+}
+
+// encodeGIF reduces the image to a palette with the options and writes it as a GIF
+func encodeGIF(w io.Writer, img image.Image, options GifOptions) (*image.Paletted, error) {
+	paletted := raster.Palettize(raster.FromImage(img), options.Colors, options.Dither)
+	return paletted, gif.Encode(w, paletted, &gif.Options{NumColors: len(paletted.Palette)})
+}
+
+// Encode writes the image in the format, with the options for formats that have any
+func (format *SupportedFormat) Encode(w io.ReadWriter, img image.Image, options EncodeOptions) error {
+	if format.EncodeWith != nil {
+		return format.EncodeWith(w, img, options)
+	}
+	_, err := format.Function(w, img, true)
+	return err
+}
+
+// zipMagic is the signature of a zip file whose first entry has the given name. For
+// stored entries the name can go on with the first bytes of the content
+func zipMagic(firstEntry string) string {
+	return "PK\x03\x04" + strings.Repeat("?", 26) + firstEntry
+}
+
+// Number of bytes we read from a file to find its format
+const sniffLength = 64
+
+func matchMagic(magic string, header []byte) bool {
+	if len(header) < len(magic) {
+		return false
+	}
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && magic[i] != header[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DetectFormat finds the format from the first bytes of a file, nil if no format knows them
+func DetectFormat(header []byte) *SupportedFormat {
+	for i := range formats {
+		for _, magic := range formats[i].Magic {
+			if matchMagic(magic, header) {
+				return &formats[i]
+			}
+		}
+	}
+	return nil
+}
+
+// SniffFormat finds the format of a file from its content and falls back to the file
+// extension when the content doesn't tell. If both disagree the content wins and a
+// warning explains the mismatch
+func SniffFormat(r io.ReaderAt, filename string) (format *SupportedFormat, warning string) {
+	header := make([]byte, sniffLength)
+	n, _ := r.ReadAt(header, 0)
+	sniffed := DetectFormat(header[:n])
+	byExtension := FindFormatFromExt(filepath.Ext(filename))
+	if sniffed == nil {
+		return byExtension, ""
+	}
+	if byExtension != nil && byExtension != sniffed {
+		warning = fmt.Sprintf("'%s' is a %s file, not %s as its extension says",
+			filepath.Base(filename), sniffed.Title, byExtension.Title)
+	}
+	return sniffed, warning
+}
+
+func FindFormatFromExt(extension string) *SupportedFormat {
+	for i := range formats {
+		for _, ext := range formats[i].Extensions {
+			if strings.EqualFold(ext, extension) {
+				return &formats[i]
+			}
+		}
+	}
+	return nil
+}
+
+func FindFormatIndexFromExt(extension string) int {
+	for i := range formats {
+		for _, ext := range formats[i].Extensions {
+			if strings.EqualFold(ext, extension) {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// FindEncodableFormatIndexFromExt is like FindFormatIndexFromExt but only counts the
+// formats we can save to, the way they are listed in the save dialog
+func FindEncodableFormatIndexFromExt(extension string) int {
+	index := 0
+	for i := range formats {
+		if !formats[i].Encodable {
+			continue
+		}
+		for _, ext := range formats[i].Extensions {
+			if strings.EqualFold(ext, extension) {
+				return index
+			}
+		}
+		index++
+	}
+	return 0
+}
+
+func GetFormatCount() int {
+	return len(formats)
+}
+
+func GetDialogFilters(onlyEncodable bool) string {
+	filter := ""
+	for _, format := range formats {
+		if onlyEncodable && !format.Encodable {
+			continue
+		}
+		filter += format.Title + " (*"
+		for j, ext := range format.Extensions {
+			if j != 0 {
+				filter += ",  *"
+			}
+			filter += ext
+		}
+		filter += ")|*"
+		for j, ext := range format.Extensions {
+			if j != 0 {
+				filter += ";*"
+			}
+			filter += ext
+		}
+		filter += "|"
+	}
+	return filter
+}
+
+func GetSaveFileDialogFilters() string {
+	return GetDialogFilters(true)
+}
+
+func GetOpenFileDialogFilters() string {
+	filter := GetDialogFilters(false)
+	filter += "All Picture Files|*"
+	for i, format := range formats {
+		if i != 0 {
+			filter += ";*"
+		}
+		for j, ext := range format.Extensions {
+			if j != 0 {
+				filter += ";*"
+			}
+			filter += ext
+		}
+	}
+	filter += "|All Files|*.*|"
+	return filter
+}
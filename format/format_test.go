@@ -0,0 +1,93 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormatOfEncodedFiles(t *testing.T) {
+	// Every format has to recognize the files it writes itself
+	for i := range formats {
+		format := &formats[i]
+		var buf bytes.Buffer
+		if _, err := format.Function(&buf, testImage(), true); err != nil {
+			t.Fatalf("%s: %v", format.Title, err)
+		}
+		if got := DetectFormat(buf.Bytes()[:sniffLength]); got != format {
+			t.Errorf("%s file detected as %v", format.Title, got)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"BM\x36\x00\x0c\x00", "Bitmap Files"},
+		{"\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR", "PNG"},
+		{"\xff\xd8\xff\xe0\x00\x10JFIF", "JPEG"},
+		{"II*\x00\x08\x00\x00\x00", "TIFF"},
+		{"MM\x00*\x00\x00\x00\x08", "TIFF"},
+		{"RIFF\x24\x00\x00\x00WEBPVP8 ", "WEBP"},
+		{"RIFF\x24\x00\x00\x00WEBPVP8L", "WEBP"},
+		{"RIFF\x24\x00\x00\x00WEBPVP8X", "WEBP"},
+		{"GIF87a\x04\x00", "GIF"},
+		{"GIF89a\x04\x00", "GIF"},
+		{zipMagic(projectManifestFile) + "{", "GoPaint Project"},
+		{zipMagic("mimetype" + oraMimeType), "OpenRaster"},
+		// Cut short before the end of the signature
+		{"\x89PNG\r\n", ""},
+		{"II*", ""},
+		{"RIFF\x24\x00\x00\x00WEBP", ""},
+		{"GIF8", ""},
+		{zipMagic("manifest"), ""},
+		{"B", ""},
+		{"", ""},
+		// Close but not quite
+		{"RIFF\x24\x00\x00\x00WAVEfmt ", ""},
+		{"GIF88a", ""},
+		{"II+\x00", ""},
+		{zipMagic("readme.txt"), ""},
+		{"hello world", ""},
+		{"\x00\x00\x00\x00\x00\x00\x00\x00", ""},
+	}
+	for _, test := range tests {
+		got := DetectFormat([]byte(test.header))
+		title := ""
+		if got != nil {
+			title = got.Title
+		}
+		if title != test.want {
+			t.Errorf("header %q detected as %q, want %q", test.header, title, test.want)
+		}
+	}
+}
+
+func TestSniffFormat(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n"
+	tests := []struct {
+		content, filename string
+		want              string
+		warns             bool
+	}{
+		{png, "image.png", "PNG", false},
+		{png, "image.JPG", "PNG", true},
+		{png, "image", "PNG", false},
+		// Unknown or cut short content leaves it to the extension
+		{"\x89PN", "image.gif", "GIF", false},
+		{"", "image.bmp", "Bitmap Files", false},
+		{"hello world", "notes.txt", "", false},
+	}
+	for _, test := range tests {
+		format, warning := SniffFormat(strings.NewReader(test.content), test.filename)
+		title := ""
+		if format != nil {
+			title = format.Title
+		}
+		if title != test.want || (warning != "") != test.warns {
+			t.Errorf("%q in %s sniffed as %q with warning %q, want %q", test.content, test.filename, title, warning, test.want)
+		}
+	}
+}
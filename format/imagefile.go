@@ -0,0 +1,148 @@
+package format
+
+import (
+	"fmt"
+	"gopaint/raster"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileErrorKind tells why an image file couldn't be opened or saved
+type FileErrorKind int
+
+const (
+	// No format knows the file, or the format can't be written
+	FileErrorUnknownFormat FileErrorKind = iota
+	// The encoder failed to turn the image into the format
+	FileErrorEncode
+	// Reading or writing the file itself failed (missing file, access denied, disk full...)
+	FileErrorIO
+	// The file content is damaged or isn't what its format expects
+	FileErrorCorrupt
+)
+
+// FileError is returned by the functions opening and saving image files
+type FileError struct {
+	Kind FileErrorKind
+	Err  error
+}
+
+func (err *FileError) Error() string {
+	var reason string
+	switch err.Kind {
+	case FileErrorUnknownFormat:
+		reason = "unknown file format"
+	case FileErrorEncode:
+		reason = "the image could not be encoded"
+	case FileErrorIO:
+		reason = "the file could not be read or written"
+	case FileErrorCorrupt:
+		reason = "the file is damaged or not a valid image"
+	}
+	if err.Err != nil {
+		reason += ": " + err.Err.Error()
+	}
+	return reason
+}
+
+func (err *FileError) Unwrap() error {
+	return err.Err
+}
+
+// NewFileError wraps the error into a FileError of the given kind
+func NewFileError(kind FileErrorKind, err error) *FileError {
+	return &FileError{Kind: kind, Err: err}
+}
+
+// fileWriter remembers the first error of the underlying file, so we can tell a full
+// disk apart from an encoder giving up
+type fileWriter struct {
+	io.ReadWriter
+	err error
+}
+
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	n, err := fw.ReadWriter.Write(p)
+	if err != nil && fw.err == nil {
+		fw.err = err
+	}
+	return n, err
+}
+
+// writeEncoded runs the encoder on w and sorts its failure into an I/O or an encode error
+func writeEncoded(w io.ReadWriter, encode func(w io.ReadWriter) error) error {
+	fw := &fileWriter{ReadWriter: w}
+	if err := encode(fw); err != nil {
+		if fw.err != nil {
+			return NewFileError(FileErrorIO, fw.err)
+		}
+		return NewFileError(FileErrorEncode, err)
+	}
+	return nil
+}
+
+// WriteFileAtomic encodes into a temporary file next to path and moves it over path
+// once everything got written, a failed save never leaves a truncated file behind
+func WriteFileAtomic(path string, encode func(w io.ReadWriter) error) error {
+	fd, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return NewFileError(FileErrorIO, err)
+	}
+	tempPath := fd.Name()
+	if err = writeEncoded(fd, encode); err != nil {
+		fd.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err = fd.Close(); err != nil {
+		os.Remove(tempPath)
+		return NewFileError(FileErrorIO, err)
+	}
+	// The temporary file is only readable by us, the saved one keeps the mode of the
+	// file it replaces
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err = os.Chmod(tempPath, mode); err != nil {
+		os.Remove(tempPath)
+		return NewFileError(FileErrorIO, err)
+	}
+	if err = os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return NewFileError(FileErrorIO, err)
+	}
+	return nil
+}
+
+// EncodeImageFile saves the image in the format matching the extension of path
+func EncodeImageFile(path string, img image.Image, options EncodeOptions) error {
+	format := FindFormatFromExt(filepath.Ext(path))
+	if format == nil || !format.Encodable {
+		return NewFileError(FileErrorUnknownFormat, fmt.Errorf("no encoder for '%s' files", filepath.Ext(path)))
+	}
+	return WriteFileAtomic(path, func(w io.ReadWriter) error {
+		return format.Encode(w, img, options)
+	})
+}
+
+// DecodeImageFile reads the flattened image of a file in any format we know, the warning
+// tells when the extension of the file doesn't match its content
+func DecodeImageFile(path string) (img *raster.BGRA, warning string, err error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, "", NewFileError(FileErrorIO, err)
+	}
+	defer fd.Close()
+	format, warning := SniffFormat(fd, path)
+	if format == nil {
+		return nil, "", NewFileError(FileErrorUnknownFormat, fmt.Errorf("'%s'", filepath.Ext(path)))
+	}
+	decoded, err := format.Function(fd, nil, false)
+	if err != nil {
+		return nil, warning, NewFileError(FileErrorCorrupt, err)
+	}
+	return raster.FromImage(decoded), warning, nil
+}
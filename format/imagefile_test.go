@@ -0,0 +1,202 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"gopaint/raster"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+var errDiskFull = errors.New("no space left on device")
+
+// fullDisk takes the first limit bytes and fails every write after them
+type fullDisk struct {
+	bytes.Buffer
+	limit int
+}
+
+func (disk *fullDisk) Write(p []byte) (int, error) {
+	room := disk.limit - disk.Len()
+	if room <= 0 {
+		return 0, errDiskFull
+	}
+	if len(p) > room {
+		disk.Buffer.Write(p[:room])
+		return room, errDiskFull
+	}
+	return disk.Buffer.Write(p)
+}
+
+func testImage() *raster.BGRA {
+	img := raster.NewBGRA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			raster.Fill(img, image.Rect(x, y, x+1, y+1), color.NRGBA{uint8(x * 4), uint8(y * 5), uint8(x ^ y), uint8(128 + x)})
+		}
+	}
+	return img
+}
+
+func checkFileErrorKind(t *testing.T, err error, want FileErrorKind) {
+	t.Helper()
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("got %v, want a FileError", err)
+	}
+	if fileErr.Kind != want {
+		t.Errorf("error kind %d (%v), want %d", fileErr.Kind, err, want)
+	}
+}
+
+func TestWriteEncodedDiskFull(t *testing.T) {
+	err := writeEncoded(&fullDisk{limit: 100}, func(w io.ReadWriter) error {
+		return png.Encode(w, testImage())
+	})
+	checkFileErrorKind(t, err, FileErrorIO)
+	if !errors.Is(err, errDiskFull) {
+		t.Errorf("got %v, want the error of the disk", err)
+	}
+}
+
+func TestWriteEncodedEncoderError(t *testing.T) {
+	// The encoder giving up on its own isn't a problem of the disk
+	err := writeEncoded(&fullDisk{limit: 100}, func(w io.ReadWriter) error {
+		return png.Encode(w, image.NewRGBA(image.Rectangle{}))
+	})
+	checkFileErrorKind(t, err, FileErrorEncode)
+	if err := writeEncoded(&fullDisk{limit: 1 << 20}, func(w io.ReadWriter) error {
+		return png.Encode(w, testImage())
+	}); err != nil {
+		t.Errorf("writing with enough room failed: %v", err)
+	}
+}
+
+func TestEncodeDecodeTIFF(t *testing.T) {
+	dir := t.TempDir()
+	img := testImage()
+	for _, name := range []string{"image.tif", "image.tiff"} {
+		path := filepath.Join(dir, name)
+		if err := EncodeImageFile(path, img, DefaultEncodeOptions); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decoded, warning, err := DecodeImageFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(warning) > 0 {
+			t.Errorf("%s: unexpected warning %q", name, warning)
+		}
+		if decoded.Rect != img.Rect {
+			t.Fatalf("%s: bounds %v, want %v", name, decoded.Rect, img.Rect)
+		}
+		if !bytes.Equal(decoded.Pix, img.Pix) {
+			t.Errorf("%s: pixels changed in the round trip", name)
+		}
+	}
+}
+
+func TestDecodeTIFFWithWrongExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.png")
+	if err := WriteFileAtomic(path, func(w io.ReadWriter) error {
+		_, err := FindFormatFromExt(".tif").Function(w, testImage(), true)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, warning, err := DecodeImageFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warning) == 0 {
+		t.Error("no warning about the extension")
+	}
+	if decoded.Rect != testImage().Rect {
+		t.Errorf("bounds %v", decoded.Rect)
+	}
+}
+
+func TestDecodeCorruptTIFF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.tif")
+	if err := os.WriteFile(path, []byte("II*\x00\xff\xff\xff\xff"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := DecodeImageFile(path)
+	checkFileErrorKind(t, err, FileErrorCorrupt)
+}
+
+func TestEncodeUnknownExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.xyz")
+	checkFileErrorKind(t, EncodeImageFile(path, testImage(), DefaultEncodeOptions), FileErrorUnknownFormat)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("a file got written")
+	}
+	_, _, err := DecodeImageFile(filepath.Join(t.TempDir(), "missing.png"))
+	checkFileErrorKind(t, err, FileErrorIO)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "image.png")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A failed save keeps the old file and leaves no temporary file behind
+	err := WriteFileAtomic(path, func(w io.ReadWriter) error {
+		w.Write([]byte("half"))
+		return errors.New("encoder failed")
+	})
+	checkFileErrorKind(t, err, FileErrorEncode)
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("file holds %q after a failed save", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files in the directory after a failed save", len(entries))
+	}
+
+	if err := EncodeImageFile(path, testImage(), DefaultEncodeOptions); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Windows only knows about the read-only flag
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("mode %v, want the 0600 of the replaced file", info.Mode().Perm())
+	}
+}
+
+func TestEncodeGIFOptions(t *testing.T) {
+	dir := t.TempDir()
+	for _, colors := range []int{4, 64} {
+		path := filepath.Join(dir, "image.gif")
+		options := DefaultEncodeOptions
+		options.Gif = GifOptions{Colors: colors}
+		if err := EncodeImageFile(path, testImage(), options); err != nil {
+			t.Fatal(err)
+		}
+		fd, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := gif.Decode(fd)
+		fd.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(decoded.(*image.Paletted).Palette); got > colors {
+			t.Errorf("%d colors asked, the file has %d", colors, got)
+		}
+	}
+	if DefaultEncodeOptions.Gif.Colors != 256 {
+		t.Errorf("saving changed the default GIF options to %+v", DefaultEncodeOptions.Gif)
+	}
+}
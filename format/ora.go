@@ -0,0 +1,325 @@
+package format
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"gopaint/raster"
+	"image"
+	"image/png"
+	"io"
+	"strconv"
+)
+
+// OpenRaster (.ora) is a zip file with a stack.xml describing the layers, a PNG per
+// layer, the flattened mergedimage.png and a thumbnail of at most 256x256 pixels
+const (
+	oraFormatName    = "openraster"
+	oraMimeType      = "image/openraster"
+	oraVersion       = "0.0.5"
+	oraStackFile     = "stack.xml"
+	oraMergedFile    = "mergedimage.png"
+	oraThumbnailFile = "Thumbnails/thumbnail.png"
+	oraThumbnailSize = 256
+)
+
+// Composite operations of OpenRaster for our blend modes
+var oraCompositeOps = map[raster.BlendMode]string{
+	raster.BlendNormal:   "svg:src-over",
+	raster.BlendMultiply: "svg:multiply",
+	raster.BlendScreen:   "svg:screen",
+	raster.BlendOverlay:  "svg:overlay",
+	raster.BlendDarken:   "svg:darken",
+	raster.BlendLighten:  "svg:lighten",
+}
+
+// oraBlendMode finds the blend mode of a composite operation, layers without one are
+// blended normally
+func oraBlendMode(op string) (raster.BlendMode, bool) {
+	if len(op) == 0 {
+		return raster.BlendNormal, true
+	}
+	for mode, modeOp := range oraCompositeOps {
+		if op == modeOp {
+			return mode, true
+		}
+	}
+	return raster.BlendNormal, false
+}
+
+// oraNode is an element of stack.xml: the image, a stack or a layer
+type oraNode struct {
+	XMLName     xml.Name
+	Version     string    `xml:"version,attr,omitempty"`
+	Width       int       `xml:"w,attr,omitempty"`
+	Height      int       `xml:"h,attr,omitempty"`
+	Name        string    `xml:"name,attr,omitempty"`
+	Src         string    `xml:"src,attr,omitempty"`
+	X           int       `xml:"x,attr,omitempty"`
+	Y           int       `xml:"y,attr,omitempty"`
+	Opacity     string    `xml:"opacity,attr,omitempty"`
+	Visibility  string    `xml:"visibility,attr,omitempty"`
+	CompositeOp string    `xml:"composite-op,attr,omitempty"`
+	Locked      string    `xml:"edit-locked,attr,omitempty"`
+	Selected    string    `xml:"selected,attr,omitempty"`
+	Children    []oraNode `xml:",any"`
+}
+
+// WriteOpenRaster writes the layers of the project as an OpenRaster file, the editor
+// settings are not part of the format. Layers are cropped to their visible pixels
+func WriteOpenRaster(w io.Writer, project *Project) error {
+	zw := zip.NewWriter(w)
+	// The mime type must come first and uncompressed
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(fw, oraMimeType); err != nil {
+		return err
+	}
+	writePNG := func(name string, img image.Image) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		return png.Encode(fw, img)
+	}
+
+	stack := oraNode{XMLName: xml.Name{Local: "stack"}}
+	// The top most layer comes first in stack.xml
+	for i := len(project.Layers) - 1; i >= 0; i-- {
+		layer := project.Layers[i]
+		bounds := raster.VisibleBounds(layer.Pixels)
+		if bounds.Empty() {
+			bounds = image.Rect(0, 0, 1, 1)
+		}
+		node := oraNode{
+			XMLName:    xml.Name{Local: "layer"},
+			Name:       layer.Name,
+			Src:        fmt.Sprintf("data/layer%d.png", i),
+			X:          bounds.Min.X,
+			Y:          bounds.Min.Y,
+			Opacity:    strconv.FormatFloat(float64(layer.Opacity)/255, 'f', 3, 64),
+			Visibility: "visible",
+		}
+		if !layer.Visible {
+			node.Visibility = "hidden"
+		}
+		blend, _ := raster.ParseBlendMode(layer.Blend)
+		node.CompositeOp = oraCompositeOps[blend]
+		if layer.Locked {
+			node.Locked = "true"
+		}
+		if i == project.ActiveLayer {
+			node.Selected = "true"
+		}
+		if err := writePNG(node.Src, raster.Crop(layer.Pixels, bounds)); err != nil {
+			return err
+		}
+		stack.Children = append(stack.Children, node)
+	}
+	root := oraNode{
+		XMLName:  xml.Name{Local: "image"},
+		Version:  oraVersion,
+		Width:    project.Width,
+		Height:   project.Height,
+		Children: []oraNode{stack},
+	}
+	data, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	if fw, err = zw.Create(oraStackFile); err != nil {
+		return err
+	}
+	if _, err = io.WriteString(fw, xml.Header); err != nil {
+		return err
+	}
+	if _, err = fw.Write(data); err != nil {
+		return err
+	}
+
+	merged := project.Flatten()
+	if err := writePNG(oraMergedFile, merged); err != nil {
+		return err
+	}
+	width, height := project.Width, project.Height
+	if width > oraThumbnailSize || height > oraThumbnailSize {
+		if width > height {
+			width, height = oraThumbnailSize, height*oraThumbnailSize/width
+		} else {
+			width, height = width*oraThumbnailSize/height, oraThumbnailSize
+		}
+		// Very thin images still get one pixel across
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+	thumbnail := raster.TransformImage(merged, raster.ResizeTransform(merged.Rect, width, height, 0, 0), raster.FilterBicubic)
+	if err := writePNG(oraThumbnailFile, thumbnail); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// oraLayer is a layer found while walking stack.xml
+type oraLayer struct {
+	node    oraNode
+	x, y    int
+	opacity float64
+	visible bool
+	// The layer was inside a nested stack
+	nested bool
+}
+
+// collectOraLayers walks a stack from top to bottom. We have no layer groups, so the
+// layers of nested stacks are pulled up with the offset, opacity and visibility of their
+// stacks applied. Elements we don't know are an error, we never skip layers
+func collectOraLayers(stack oraNode, x, y int, opacity float64, visible, nested bool, layers []oraLayer) ([]oraLayer, error) {
+	for _, node := range stack.Children {
+		nodeOpacity := 1.0
+		if len(node.Opacity) > 0 {
+			value, err := strconv.ParseFloat(node.Opacity, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad opacity '%s'", node.Opacity)
+			}
+			nodeOpacity = raster.ClampFloat(value, 0, 1)
+		}
+		nodeVisible := visible && node.Visibility != "hidden"
+		switch node.XMLName.Local {
+		case "layer":
+			if len(node.Src) == 0 {
+				return nil, fmt.Errorf("layer '%s' has no image", node.Name)
+			}
+			layers = append(layers, oraLayer{node, x + node.X, y + node.Y, opacity * nodeOpacity, nodeVisible, nested})
+		case "stack":
+			var err error
+			layers, err = collectOraLayers(node, x+node.X, y+node.Y, opacity*nodeOpacity, nodeVisible, true, layers)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported element <%s> in the layer stack", node.XMLName.Local)
+		}
+	}
+	return layers, nil
+}
+
+func readZipPNG(zr *zip.Reader, name string) (image.Image, error) {
+	fr, err := openZipFile(zr, name)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+	return png.Decode(fr)
+}
+
+// ReadOpenRaster reads the layers of an OpenRaster file
+func ReadOpenRaster(r io.ReaderAt, size int64) (*Project, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("not an OpenRaster file")
+	}
+	fr, err := openZipFile(zr, oraStackFile)
+	if err != nil {
+		return nil, errors.New("not an OpenRaster file")
+	}
+	var root oraNode
+	err = xml.NewDecoder(fr).Decode(&root)
+	fr.Close()
+	if err != nil {
+		return nil, fmt.Errorf("bad %s: %v", oraStackFile, err)
+	}
+	if root.XMLName.Local != "image" || root.Width < 1 || root.Height < 1 {
+		return nil, fmt.Errorf("bad %s: no image size", oraStackFile)
+	}
+	var layers []oraLayer
+	for _, node := range root.Children {
+		if node.XMLName.Local == "stack" {
+			if layers, err = collectOraLayers(node, 0, 0, 1, true, false, layers); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(layers) == 0 {
+		return nil, errors.New("the OpenRaster file has no layers")
+	}
+
+	project := NewProject(root.Width, root.Height)
+	project.Format = oraFormatName
+	project.ActiveLayer = -1
+	canvasRect := image.Rect(0, 0, root.Width, root.Height)
+	flattened := false
+	unknownOps := map[string]bool{}
+	for i := len(layers) - 1; i >= 0; i-- {
+		found := layers[i]
+		img, err := readZipPNG(zr, found.node.Src)
+		if err != nil {
+			return nil, fmt.Errorf("layer '%s': %v", found.node.Name, err)
+		}
+		src := raster.FromImage(img)
+		src.Rect = src.Rect.Add(image.Pt(found.x, found.y))
+		pixels := raster.NewBGRA(canvasRect)
+		raster.CopyRect(pixels, src, src.Rect)
+
+		layer := &ProjectLayer{
+			Name:    found.node.Name,
+			Opacity: uint8(found.opacity*255 + 0.5),
+			Visible: found.visible,
+			Locked:  found.node.Locked == "true",
+			Blend:   raster.BlendNormal.String(),
+			Pixels:  pixels,
+		}
+		if len(layer.Name) == 0 {
+			layer.Name = "Layer " + strconv.Itoa(len(project.Layers)+1)
+		}
+		if blend, ok := oraBlendMode(found.node.CompositeOp); ok {
+			layer.Blend = blend.String()
+		} else if !unknownOps[found.node.CompositeOp] {
+			unknownOps[found.node.CompositeOp] = true
+			project.Warnings = append(project.Warnings, fmt.Sprintf("The blend mode '%s' is not supported, layers using it are blended normally.", found.node.CompositeOp))
+		}
+		flattened = flattened || found.nested
+		// An opaque bottom layer covering the whole canvas works as our background layer
+		if len(project.Layers) == 0 && src.Rect.Eq(canvasRect) && src.Opaque() {
+			layer.Background = true
+		}
+		if found.node.Selected == "true" {
+			project.ActiveLayer = len(project.Layers)
+		}
+		project.Layers = append(project.Layers, layer)
+	}
+	if project.ActiveLayer < 0 {
+		project.ActiveLayer = len(project.Layers) - 1
+	}
+	if flattened {
+		project.Warnings = append(project.Warnings, "Layer groups are not supported, their layers got moved out of them.")
+	}
+	return project, nil
+}
+
+// readOpenRasterMerged returns the flattened image of an OpenRaster file, this is the
+// mergedimage.png if there is one or else the layers blended together
+func readOpenRasterMerged(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("not an OpenRaster file")
+	}
+	if merged, err := readZipPNG(zr, oraMergedFile); err == nil {
+		return merged, nil
+	}
+	project, err := ReadOpenRaster(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return project.Flatten(), nil
+}
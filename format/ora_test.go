@@ -0,0 +1,140 @@
+package format
+
+import (
+	"archive/zip"
+	"bytes"
+	"gopaint/raster"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+// buildOpenRaster writes an OpenRaster file with the given stack.xml, every src in it
+// gets a 4x4 opaque red PNG
+func buildOpenRaster(t *testing.T, stack string, sources ...string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, write func(w io.Writer) error) {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := write(fw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("mimetype", func(w io.Writer) error {
+		_, err := io.WriteString(w, oraMimeType)
+		return err
+	})
+	add(oraStackFile, func(w io.Writer) error {
+		_, err := io.WriteString(w, stack)
+		return err
+	})
+	red := raster.NewBGRA(image.Rect(0, 0, 4, 4))
+	raster.Fill(red, red.Rect, color.NRGBA{255, 0, 0, 255})
+	for _, src := range sources {
+		add(src, func(w io.Writer) error {
+			return png.Encode(w, red)
+		})
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestOpenRasterRoundTrip(t *testing.T) {
+	project := NewProject(8, 6)
+	for i, blend := range []raster.BlendMode{raster.BlendNormal, raster.BlendMultiply} {
+		pixels := raster.NewBGRA(image.Rect(0, 0, 8, 6))
+		raster.Fill(pixels, image.Rect(i, i, 4+i, 3+i), color.NRGBA{0, 0, 255, 255})
+		project.Layers = append(project.Layers, &ProjectLayer{
+			Name: "Layer", Opacity: 128, Visible: i == 0, Locked: i == 1, Blend: blend.String(), Pixels: pixels,
+		})
+	}
+	project.ActiveLayer = 0
+	var buf bytes.Buffer
+	if err := WriteOpenRaster(&buf, project); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadOpenRaster(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Warnings) > 0 {
+		t.Errorf("warnings for our own file: %v", read.Warnings)
+	}
+	if read.Width != 8 || read.Height != 6 || len(read.Layers) != 2 || read.ActiveLayer != 0 {
+		t.Fatalf("read %dx%d with %d layers, active %d", read.Width, read.Height, len(read.Layers), read.ActiveLayer)
+	}
+	for i, layer := range read.Layers {
+		want := project.Layers[i]
+		if layer.Opacity != want.Opacity || layer.Visible != want.Visible || layer.Locked != want.Locked || layer.Blend != want.Blend {
+			t.Errorf("layer %d is %+v, want %+v", i, layer, want)
+		}
+		if !bytes.Equal(layer.Pixels.Pix, want.Pixels.Pix) {
+			t.Errorf("layer %d pixels changed", i)
+		}
+	}
+}
+
+func TestOpenRasterUnknownCompositeOp(t *testing.T) {
+	r := buildOpenRaster(t, `<image w="4" h="4"><stack>
+		<layer src="a.png" composite-op="svg:color-dodge"/>
+		<layer src="b.png" composite-op="svg:color-dodge"/>
+		<layer src="c.png" composite-op="svg:multiply"/>
+		<layer src="d.png"/>
+	</stack></image>`, "a.png", "b.png", "c.png", "d.png")
+	project, err := ReadOpenRaster(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(project.Warnings) != 1 || !strings.Contains(project.Warnings[0], "svg:color-dodge") {
+		t.Errorf("warnings %q, want one about svg:color-dodge", project.Warnings)
+	}
+	// Layers come bottom up
+	want := []raster.BlendMode{raster.BlendNormal, raster.BlendMultiply, raster.BlendNormal, raster.BlendNormal}
+	for i, layer := range project.Layers {
+		if layer.Blend != want[i].String() {
+			t.Errorf("layer %d blends with %s, want %v", i, layer.Blend, want[i])
+		}
+	}
+}
+
+func TestOpenRasterNestedStack(t *testing.T) {
+	r := buildOpenRaster(t, `<image w="8" h="8"><stack>
+		<stack x="2" y="3" opacity="0.5" visibility="hidden">
+			<layer src="a.png" x="1" opacity="0.5"/>
+		</stack>
+		<layer src="b.png"/>
+	</stack></image>`, "a.png", "b.png")
+	project, err := ReadOpenRaster(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(project.Warnings) != 1 || !strings.Contains(project.Warnings[0], "group") {
+		t.Errorf("warnings %q, want one about the flattened group", project.Warnings)
+	}
+	if len(project.Layers) != 2 {
+		t.Fatalf("%d layers, want 2", len(project.Layers))
+	}
+	nested := project.Layers[1]
+	if nested.Visible || nested.Opacity != 64 {
+		t.Errorf("nested layer visible %v with opacity %d, want hidden with 64", nested.Visible, nested.Opacity)
+	}
+	if got := raster.VisibleBounds(nested.Pixels); got != image.Rect(3, 3, 7, 7) {
+		t.Errorf("nested layer covers %v, want it moved by both offsets", got)
+	}
+}
+
+func TestOpenRasterUnknownElement(t *testing.T) {
+	r := buildOpenRaster(t, `<image w="4" h="4"><stack><text>hello</text></stack></image>`)
+	if _, err := ReadOpenRaster(r, r.Size()); err == nil {
+		t.Error("a stack with an unknown element got read")
+	}
+}
@@ -0,0 +1,318 @@
+package format
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopaint/raster"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The native project file (.gpaint) is a zip file holding a JSON manifest with the
+// document and editor settings, one PNG per layer and a flattened PNG for anything
+// that doesn't care about layers
+const (
+	ProjectExtension    = ".gpaint"
+	ProjectFormatName   = "gopaint"
+	projectManifestFile = "manifest.json"
+	projectMergedFile   = "merged.png"
+	projectMaskFile     = "selection.png"
+)
+
+// projectVersion is written into every project. Fields added in later versions must be
+// optional, so the files of older versions keep opening with the defaults of NewProject.
+// Files of a newer version are refused
+const projectVersion = 1
+
+// ProjectToolSettings are the tool options stored with a project
+type ProjectToolSettings struct {
+	// Name of the current tool, see ToolsManager.namedTools
+	Tool string `json:"tool"`
+	// Size chosen for every tool that has one, by tool name
+	Sizes   map[string]int `json:"sizes"`
+	Outline bool           `json:"outline"`
+	Fill    bool           `json:"fill"`
+}
+
+// ProjectLayer is a layer of a project, File is the name of its PNG inside the zip file
+type ProjectLayer struct {
+	Name       string       `json:"name"`
+	Opacity    uint8        `json:"opacity"`
+	Visible    bool         `json:"visible"`
+	Locked     bool         `json:"locked"`
+	Blend      string       `json:"blend"`
+	Background bool         `json:"background"`
+	File       string       `json:"file"`
+	Pixels     *raster.BGRA `json:"-"`
+}
+
+// ProjectSelection is the selected area of the canvas. Mask is the name of the PNG
+// holding how much of each pixel within the bounds is selected, files without one
+// select the whole rectangle
+type ProjectSelection struct {
+	X           int          `json:"x"`
+	Y           int          `json:"y"`
+	Width       int          `json:"width"`
+	Height      int          `json:"height"`
+	Rectangular bool         `json:"rectangular"`
+	Mask        string       `json:"mask,omitempty"`
+	Pixels      *image.Alpha `json:"-"`
+}
+
+// Project is the whole document as it is stored in a project file. Colors are written
+// as #RRGGBBAA
+type Project struct {
+	Format       string              `json:"format"`
+	Version      int                 `json:"version"`
+	Width        int                 `json:"width"`
+	Height       int                 `json:"height"`
+	Tool         ProjectToolSettings `json:"tool"`
+	Color1       string              `json:"color1"`
+	Color2       string              `json:"color2"`
+	CustomColors []string            `json:"customColors"`
+	ShowGrid     bool                `json:"showGrid"`
+	Layers       []*ProjectLayer     `json:"layers"`
+	ActiveLayer  int                 `json:"activeLayer"`
+	Selection    *ProjectSelection   `json:"selection,omitempty"`
+	// What got lost or changed while reading a file of another program, for the user
+	Warnings []string `json:"-"`
+}
+
+// NewProject creates an empty project with the default settings of a new image
+func NewProject(width, height int) *Project {
+	project := &Project{
+		Format:  ProjectFormatName,
+		Version: projectVersion,
+		Width:   width,
+		Height:  height,
+		Tool: ProjectToolSettings{
+			Tool:    "select",
+			Sizes:   map[string]int{},
+			Outline: true,
+		},
+		Color1: FormatHexColor(color.NRGBA{A: 255}),
+		Color2: FormatHexColor(color.NRGBA{R: 255, G: 255, B: 255, A: 255}),
+		Layers: make([]*ProjectLayer, 0),
+	}
+	return project
+}
+
+// NewProjectFromImage creates a project with a single layer holding the image
+func NewProjectFromImage(img image.Image) *Project {
+	pixels := raster.FromImage(img)
+	project := NewProject(pixels.Rect.Dx(), pixels.Rect.Dy())
+	layer := &ProjectLayer{Name: "Layer 1", Opacity: 255, Visible: true, Blend: raster.BlendNormal.String(), Pixels: pixels}
+	if pixels.Opaque() {
+		layer.Name = "Background"
+		layer.Background = true
+	}
+	project.Layers = append(project.Layers, layer)
+	return project
+}
+
+// UnmarshalJSON fills in the defaults of a new layer for the fields the file leaves out
+func (layer *ProjectLayer) UnmarshalJSON(data []byte) error {
+	type plainLayer ProjectLayer
+	fields := plainLayer{Opacity: 255, Visible: true, Blend: raster.BlendNormal.String()}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*layer = ProjectLayer(fields)
+	return nil
+}
+
+// FormatHexColor writes the color as #RRGGBBAA
+func FormatHexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X%02X", c.R, c.G, c.B, c.A)
+}
+
+// ParseHexColor parses colors written as #RRGGBB or #RRGGBBAA
+func ParseHexColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 && len(s) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s'", s)
+	}
+	value, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s'", s)
+	}
+	if len(s) == 6 {
+		value = value<<8 | 0xFF
+	}
+	return color.NRGBA{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}, nil
+}
+
+// Flatten blends the visible layers of the project into a single image
+func (project *Project) Flatten() *raster.BGRA {
+	flat := raster.NewBGRA(image.Rect(0, 0, project.Width, project.Height))
+	for _, layer := range project.Layers {
+		if !layer.Visible || layer.Opacity == 0 {
+			continue
+		}
+		blend, _ := raster.ParseBlendMode(layer.Blend)
+		raster.Composite(flat, layer.Pixels, flat.Rect, layer.Opacity, blend, layer.Background)
+	}
+	return flat
+}
+
+// WriteProject writes the project as a zip file
+func WriteProject(w io.Writer, project *Project) error {
+	zw := zip.NewWriter(w)
+	writePNG := func(name string, img image.Image) error {
+		// PNG data is compressed already
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		return png.Encode(fw, img)
+	}
+	project.Format = ProjectFormatName
+	project.Version = projectVersion
+	for i, layer := range project.Layers {
+		layer.File = fmt.Sprintf("layers/%d.png", i)
+	}
+	selection := project.Selection
+	if selection != nil && selection.Pixels != nil {
+		selection.Mask = projectMaskFile
+	}
+	// The manifest comes first so the file can be recognized from its first bytes
+	manifest, err := json.MarshalIndent(project, "", "\t")
+	if err != nil {
+		return err
+	}
+	fw, err := zw.Create(projectManifestFile)
+	if err != nil {
+		return err
+	}
+	if _, err = fw.Write(manifest); err != nil {
+		return err
+	}
+	for _, layer := range project.Layers {
+		if err := writePNG(layer.File, layer.Pixels); err != nil {
+			return err
+		}
+	}
+	if selection != nil && selection.Pixels != nil {
+		// Written as a grayscale image, a PNG has no alpha only type
+		mask := selection.Pixels
+		if err := writePNG(selection.Mask, &image.Gray{Pix: mask.Pix, Stride: mask.Stride, Rect: mask.Rect}); err != nil {
+			return err
+		}
+	}
+	if err := writePNG(projectMergedFile, project.Flatten()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func openZipFile(zr *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, file := range zr.File {
+		if file.Name == name {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("'%s' is missing", name)
+}
+
+// ReadProject reads a project file with all its layers
+func ReadProject(r io.ReaderAt, size int64) (*Project, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("not a GoPaint project file")
+	}
+	fr, err := openZipFile(zr, projectManifestFile)
+	if err != nil {
+		return nil, errors.New("not a GoPaint project file")
+	}
+	project := NewProject(0, 0)
+	err = json.NewDecoder(fr).Decode(project)
+	fr.Close()
+	if err != nil {
+		return nil, fmt.Errorf("bad project manifest: %v", err)
+	}
+	if project.Format != ProjectFormatName {
+		return nil, errors.New("not a GoPaint project file")
+	}
+	if project.Version > projectVersion {
+		return nil, fmt.Errorf("the project was saved by a newer version of GoPaint (format version %d)", project.Version)
+	}
+	if project.Width < 1 || project.Height < 1 {
+		return nil, fmt.Errorf("bad project size %dx%d", project.Width, project.Height)
+	}
+	if len(project.Layers) == 0 {
+		return nil, errors.New("the project has no layers")
+	}
+	for _, layer := range project.Layers {
+		fr, err := openZipFile(zr, layer.File)
+		if err != nil {
+			return nil, fmt.Errorf("layer '%s': %v", layer.Name, err)
+		}
+		img, err := png.Decode(fr)
+		fr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("layer '%s': %v", layer.Name, err)
+		}
+		if img.Bounds().Dx() != project.Width || img.Bounds().Dy() != project.Height {
+			return nil, fmt.Errorf("layer '%s' doesn't match the canvas size", layer.Name)
+		}
+		layer.Pixels = raster.FromImage(img)
+	}
+	if project.ActiveLayer < 0 || project.ActiveLayer >= len(project.Layers) {
+		project.ActiveLayer = len(project.Layers) - 1
+	}
+	if selection := project.Selection; selection != nil {
+		if err := readSelectionMask(zr, selection); err != nil {
+			return nil, fmt.Errorf("selection: %v", err)
+		}
+	}
+	return project, nil
+}
+
+// readSelectionMask loads the mask of the selection, a selection without one covers
+// its whole rectangle
+func readSelectionMask(zr *zip.Reader, selection *ProjectSelection) error {
+	bounds := image.Rect(selection.X, selection.Y, selection.X+selection.Width, selection.Y+selection.Height)
+	if len(selection.Mask) == 0 {
+		selection.Rectangular = true
+		selection.Pixels = raster.RectMask(bounds)
+		return nil
+	}
+	fr, err := openZipFile(zr, selection.Mask)
+	if err != nil {
+		return err
+	}
+	img, err := png.Decode(fr)
+	fr.Close()
+	if err != nil {
+		return err
+	}
+	if img.Bounds().Size() != bounds.Size() {
+		return errors.New("the mask doesn't match the selection size")
+	}
+	mask := image.NewAlpha(bounds)
+	min := img.Bounds().Min
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			gray := color.GrayModel.Convert(img.At(min.X+x, min.Y+y)).(color.Gray)
+			mask.SetAlpha(bounds.Min.X+x, bounds.Min.Y+y, color.Alpha{A: gray.Y})
+		}
+	}
+	selection.Pixels = mask
+	return nil
+}
+
+// readProjectFrom is ReadProject for streams that can't seek
+func readProjectFrom(r io.Reader) (*Project, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ReadProject(bytes.NewReader(data), int64(len(data)))
+}
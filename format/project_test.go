@@ -0,0 +1,70 @@
+package format
+
+import (
+	"bytes"
+	"gopaint/raster"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func writeAndReadProject(t *testing.T, project *Project) *Project {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteProject(&buf, project); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadProject(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return read
+}
+
+func TestProjectSelectionMask(t *testing.T) {
+	project := NewProjectFromImage(image.NewNRGBA(image.Rect(0, 0, 10, 8)))
+	// A soft edged diagonal within (2,3)-(6,6)
+	mask := image.NewAlpha(image.Rect(2, 3, 6, 6))
+	for y := 3; y < 6; y++ {
+		for x := 2; x < 6; x++ {
+			if x-2 >= y-3 {
+				mask.SetAlpha(x, y, color.Alpha{A: uint8(60 * (x - 1))})
+			}
+		}
+	}
+	project.Selection = &ProjectSelection{X: 2, Y: 3, Width: 4, Height: 3, Pixels: mask}
+	read := writeAndReadProject(t, project)
+	selection := read.Selection
+	if selection == nil || selection.Pixels == nil {
+		t.Fatal("the selection got lost")
+	}
+	if selection.Rectangular {
+		t.Error("the mask came back as a rectangle")
+	}
+	if selection.Pixels.Rect != mask.Rect {
+		t.Fatalf("mask bounds %v, want %v", selection.Pixels.Rect, mask.Rect)
+	}
+	if !bytes.Equal(selection.Pixels.Pix, mask.Pix) {
+		t.Errorf("mask %v, want %v", selection.Pixels.Pix, mask.Pix)
+	}
+}
+
+func TestProjectRectangularSelection(t *testing.T) {
+	project := NewProjectFromImage(image.NewNRGBA(image.Rect(0, 0, 10, 8)))
+	project.Selection = &ProjectSelection{X: 1, Y: 2, Width: 3, Height: 4, Rectangular: true, Pixels: raster.RectMask(image.Rect(1, 2, 4, 6))}
+	read := writeAndReadProject(t, project)
+	if selection := read.Selection; selection == nil || !selection.Rectangular || selection.Pixels.Rect != image.Rect(1, 2, 4, 6) {
+		t.Errorf("selection %+v, want the rectangle back", selection)
+	}
+
+	// Files of the first version only have the bounds
+	project.Selection = &ProjectSelection{X: 1, Y: 2, Width: 3, Height: 4}
+	read = writeAndReadProject(t, project)
+	selection := read.Selection
+	if selection == nil || !selection.Rectangular || selection.Pixels == nil {
+		t.Fatalf("selection %+v, want a rectangle", selection)
+	}
+	if selection.Pixels.Rect != image.Rect(1, 2, 4, 6) || selection.Pixels.AlphaAt(3, 5).A != 255 {
+		t.Errorf("the bounds don't select the whole rectangle")
+	}
+}
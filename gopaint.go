@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 	"runtime"
 
 	"gopaint/reza"
@@ -30,6 +31,10 @@ func init() {
 }
 
 func main() {
+	// The batch mode works on files only, we don't create any window for it
+	if len(os.Args) > 1 && os.Args[1] == batchCommand {
+		os.Exit(runBatch(os.Args[2:]))
+	}
 	app = &Gopaint{
 		Application: reza.NewApplication(),
 		Title:       "GoPaint",
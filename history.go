@@ -0,0 +1,174 @@
+package main
+
+import (
+	"gopaint/raster"
+)
+
+// Default amount of memory (in bytes) the undo/redo history is allowed to hold
+const defaultHistoryMemoryLimit = 256 * 1024 * 1024
+
+// pixelStep is an edit that only changed the pixels of a single layer
+type pixelStep struct {
+	canvas *DrawingCanvas
+	layer  int
+	delta  *raster.TileDelta
+}
+
+// layerProperties are the settings of a layer that change without touching its pixels
+type layerProperties struct {
+	opacity uint8
+	visible bool
+	locked  bool
+	blend   raster.BlendMode
+}
+
+// propertiesStep is a change of the visibility, lock, opacity or blend mode of a layer
+type propertiesStep struct {
+	canvas *DrawingCanvas
+	layer  int
+	before layerProperties
+	after  layerProperties
+}
+
+// layerSnapshot is a complete copy of a layer
+type layerSnapshot struct {
+	name       string
+	opacity    uint8
+	visible    bool
+	locked     bool
+	blend      raster.BlendMode
+	background bool
+	pix        []uint8
+}
+
+// documentSnapshot is a complete copy of all the layers along with the file infos
+type documentSnapshot struct {
+	width      int
+	height     int
+	layers     []layerSnapshot
+	active     int
+	filepath   string
+	sizeOnDisk int64
+	lastSaved  string
+}
+
+// snapshotStep is an edit that replaced the whole document (new, open, resize, layer changes...)
+type snapshotStep struct {
+	canvas *DrawingCanvas
+	before *documentSnapshot
+	after  *documentSnapshot
+}
+
+func (step *pixelStep) Undo() {
+	canvas := step.canvas
+	step.delta.Revert(&canvas.layers.Get(step.layer).surface.BGRA)
+	canvas.layers.SetActive(step.layer)
+}
+
+func (step *pixelStep) Redo() {
+	canvas := step.canvas
+	step.delta.Apply(&canvas.layers.Get(step.layer).surface.BGRA)
+	canvas.layers.SetActive(step.layer)
+}
+
+func (step *pixelStep) MemorySize() int {
+	return step.delta.MemorySize()
+}
+
+func getLayerProperties(layer *Layer) layerProperties {
+	return layerProperties{opacity: layer.Opacity, visible: layer.Visible, locked: layer.Locked, blend: layer.Blend}
+}
+
+func (props layerProperties) apply(layer *Layer) {
+	layer.Opacity = props.opacity
+	layer.Visible = props.visible
+	layer.Locked = props.locked
+	layer.Blend = props.blend
+}
+
+func (step *propertiesStep) Undo() {
+	step.before.apply(step.canvas.layers.Get(step.layer))
+	step.canvas.layers.SetActive(step.layer)
+}
+
+func (step *propertiesStep) Redo() {
+	step.after.apply(step.canvas.layers.Get(step.layer))
+	step.canvas.layers.SetActive(step.layer)
+}
+
+func (step *propertiesStep) MemorySize() int {
+	return 0
+}
+
+// pushSnapshot records a change of the whole document, taken before and after it
+func (canvas *DrawingCanvas) pushSnapshot(before, after *documentSnapshot) {
+	canvas.history.Push(&snapshotStep{canvas: canvas, before: before, after: after})
+}
+
+func newDocumentSnapshot(canvas *DrawingCanvas) *documentSnapshot {
+	img := canvas.image
+	snapshot := &documentSnapshot{
+		width:      img.Width(),
+		height:     img.Height(),
+		layers:     make([]layerSnapshot, canvas.layers.Count()),
+		active:     canvas.layers.ActiveIndex(),
+		filepath:   img.filepath,
+		sizeOnDisk: img.sizeOnDisk,
+		lastSaved:  img.lastSaved,
+	}
+	for i := range snapshot.layers {
+		layer := canvas.layers.Get(i)
+		snapshot.layers[i] = layerSnapshot{
+			name:       layer.Name,
+			opacity:    layer.Opacity,
+			visible:    layer.Visible,
+			locked:     layer.Locked,
+			blend:      layer.Blend,
+			background: layer.Background,
+			pix:        make([]uint8, len(layer.surface.Pix)),
+		}
+		copy(snapshot.layers[i].pix, layer.surface.Pix)
+	}
+	return snapshot
+}
+
+func (snapshot *documentSnapshot) restore(canvas *DrawingCanvas) {
+	newImage := NewDrawingImage(snapshot.width, snapshot.height)
+	newImage.filepath = snapshot.filepath
+	newImage.sizeOnDisk = snapshot.sizeOnDisk
+	newImage.lastSaved = snapshot.lastSaved
+	layers := NewLayerStack()
+	for i := range snapshot.layers {
+		saved := &snapshot.layers[i]
+		layer := NewLayer(saved.name, snapshot.width, snapshot.height)
+		layer.Opacity = saved.opacity
+		layer.Visible = saved.visible
+		layer.Locked = saved.locked
+		layer.Blend = saved.blend
+		layer.Background = saved.background
+		copy(layer.surface.Pix, saved.pix)
+		layers.Insert(i, layer)
+	}
+	layers.SetActive(snapshot.active)
+	canvas.setDocument(newImage, layers)
+}
+
+func (snapshot *documentSnapshot) memorySize() int {
+	size := 0
+	for i := range snapshot.layers {
+		size += len(snapshot.layers[i].pix)
+	}
+	return size
+}
+
+func (step *snapshotStep) Undo() {
+	step.before.restore(step.canvas)
+}
+
+func (step *snapshotStep) Redo() {
+	step.after.restore(step.canvas)
+}
+
+func (step *snapshotStep) MemorySize() int {
+	return step.before.memorySize() + step.after.memorySize()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"gopaint/raster"
+	. "gopaint/reza"
+	"image"
+	"image/color"
+	"strconv"
+)
+
+// Layer is a single drawing surface of the layer stack
+type Layer struct {
+	Name    string
+	Opacity uint8
+	Visible bool
+	Locked  bool
+	Blend   raster.BlendMode
+	// A background layer has no transparency, its alpha is ignored while compositing
+	Background bool
+	surface    *DrawingImage
+}
+
+func NewLayer(name string, width, height int) *Layer {
+	layer := &Layer{
+		Name:    name,
+		Opacity: 255,
+		Visible: true,
+		Blend:   raster.BlendNormal,
+	}
+	layer.surface = NewDrawingImage(width, height)
+	return layer
+}
+
+// CloneEmpty creates a layer of the given size with the same properties but no pixels
+func (layer *Layer) CloneEmpty(width, height int) *Layer {
+	clone := NewLayer(layer.Name, width, height)
+	clone.Opacity = layer.Opacity
+	clone.Visible = layer.Visible
+	clone.Locked = layer.Locked
+	clone.Blend = layer.Blend
+	clone.Background = layer.Background
+	return clone
+}
+
+func (layer *Layer) Dispose() {
+	if layer.surface != nil {
+		layer.surface.Dispose()
+		layer.surface = nil
+	}
+}
+
+func (layer *Layer) GetImage() *DrawingImage {
+	return layer.surface
+}
+
+// ClearRect erases the given area, background layers get filled with the given
+// color and the rest becomes transparent
+func (layer *Layer) ClearRect(rect image.Rectangle, background Color) {
+	if layer.Background {
+		raster.Fill(&layer.surface.BGRA, rect, background.AsNRGBA())
+	} else {
+		raster.Fill(&layer.surface.BGRA, rect, color.NRGBA{})
+	}
+}
+
+// ClearMask erases the pixels the mask covers like ClearRect does, partly covered ones
+// only partly
+func (layer *Layer) ClearMask(mask *image.Alpha, background Color) {
+	raster.PaintMask(&layer.surface.BGRA, mask, raster.NewSolidPaint(layer.ClearColor(background)))
+}
+
+// ClearColor returns the color erased pixels get, the background color on the
+// background layer and transparency on the others
+func (layer *Layer) ClearColor(background Color) color.NRGBA {
+	if layer.Background {
+		return background.AsNRGBA()
+	}
+	return color.NRGBA{}
+}
+
+// LayerStack holds the layers ordered from bottom to top
+type LayerStack struct {
+	layers []*Layer
+	active int
+}
+
+func NewLayerStack() *LayerStack {
+	return &LayerStack{layers: make([]*Layer, 0)}
+}
+
+func (stack *LayerStack) Dispose() {
+	for _, layer := range stack.layers {
+		layer.Dispose()
+	}
+	stack.layers = nil
+}
+
+func (stack *LayerStack) Count() int {
+	return len(stack.layers)
+}
+
+func (stack *LayerStack) Get(index int) *Layer {
+	return stack.layers[index]
+}
+
+func (stack *LayerStack) Active() *Layer {
+	return stack.layers[stack.active]
+}
+
+func (stack *LayerStack) ActiveIndex() int {
+	return stack.active
+}
+
+func (stack *LayerStack) SetActive(index int) {
+	if index >= 0 && index < len(stack.layers) {
+		stack.active = index
+	}
+}
+
+// Insert puts the layer at the given position and makes it the active one
+func (stack *LayerStack) Insert(index int, layer *Layer) {
+	index = Max(0, Min(index, len(stack.layers)))
+	stack.layers = append(stack.layers, nil)
+	copy(stack.layers[index+1:], stack.layers[index:])
+	stack.layers[index] = layer
+	stack.active = index
+}
+
+// Remove takes out the layer from the stack without disposing it
+func (stack *LayerStack) Remove(index int) *Layer {
+	layer := stack.layers[index]
+	stack.layers = append(stack.layers[:index], stack.layers[index+1:]...)
+	if stack.active >= len(stack.layers) {
+		stack.active = len(stack.layers) - 1
+	}
+	return layer
+}
+
+func (stack *LayerStack) Move(from, to int) {
+	if from == to || to < 0 || to >= len(stack.layers) {
+		return
+	}
+	layer := stack.Remove(from)
+	stack.Insert(to, layer)
+}
+
+// MergeDown blends the layer into the one below it and removes it from the stack
+func (stack *LayerStack) MergeDown(index int) {
+	if index <= 0 || index >= len(stack.layers) {
+		return
+	}
+	upper := stack.layers[index]
+	lower := stack.layers[index-1]
+	if upper.Visible {
+		raster.Composite(&lower.surface.BGRA, &upper.surface.BGRA, lower.surface.Rect, upper.Opacity, upper.Blend, upper.Background)
+	}
+	stack.Remove(index).Dispose()
+	stack.active = index - 1
+}
+
+// NextLayerName returns a name that isn't used by any layer yet
+func (stack *LayerStack) NextLayerName() string {
+	for i := 1; ; i++ {
+		name := "Layer " + strconv.Itoa(i)
+		used := false
+		for _, layer := range stack.layers {
+			if layer.Name == name {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return name
+		}
+	}
+}
+
+// Composite blends all the visible layers into dst within the given rectangle.
+// Transparent areas show a checkerboard pattern if asked for
+func (stack *LayerStack) Composite(dst *BGRA, rect image.Rectangle, checkerboard bool) {
+	layers := make([]raster.CompositeLayer, len(stack.layers))
+	for i, layer := range stack.layers {
+		layers[i] = raster.CompositeLayer{
+			Pixels:  &layer.surface.BGRA,
+			Opacity: layer.Opacity,
+			Visible: layer.Visible,
+			Blend:   layer.Blend,
+			Opaque:  layer.Background,
+		}
+	}
+	raster.CompositeLayers(dst, layers, rect, checkerboard)
+}
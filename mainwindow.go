@@ -1,9 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"gopaint/format"
+	"gopaint/raster"
 	. "gopaint/reza"
-	"log"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	win "github.com/lxn/win"
 )
@@ -21,6 +25,7 @@ type MainWindow struct {
 	hCursorSizeNESW  win.HCURSOR
 	hCursorIBeam     win.HCURSOR
 	hCursorMove      win.HCURSOR
+	hCursorRotate    win.HCURSOR
 	ribbon           Ribbon
 	workspace        *Workspace
 	statusbar        Statusbar
@@ -28,23 +33,45 @@ type MainWindow struct {
 	statusSelSize    Status
 	statusCanvasSize Status
 	statusFileSize   Status
+	statusZoom       Status
 	color1           RibbonButton
 	color2           RibbonButton
-	bsize            RibbonButton
-	bsizeMenu        PopupSizeMenu
-	btnTools         []RibbonButton
-	buttonToolPairs  map[RibbonButton]Tool
-	menuNoOutline    PopupMenuItem
-	menuSolidOutline PopupMenuItem
-	menuNoFill       PopupMenuItem
-	menuSolidFill    PopupMenuItem
-	bShowGridlines   RibbonButton
-	tools            *ToolsManager
-	resizeDialog     *ResizeDialog
-	propertiesDialog *PropertiesDialog
-	initDone         bool
+	// The first custom colors live in the ribbon, the rest only in the color dialog
+	customColorButtons []RibbonButton
+	customColors       [16]Color
+	bsize              RibbonButton
+	bsizeMenu          PopupSizeMenu
+	btnTools           []RibbonButton
+	buttonToolPairs    map[RibbonButton]Tool
+	menuNoOutline      PopupMenuItem
+	menuSolidOutline   PopupMenuItem
+	menuNoFill         PopupMenuItem
+	menuSolidFill      PopupMenuItem
+	menuGradientFill   PopupMenuItem
+	menuPatternFill    PopupMenuItem
+	menuResampling     []PopupMenuItem
+	fillStyle          FillStyle
+	clipboard          *raster.Clip
+	trimOptions        raster.TrimOptions
+	bShowGridlines     RibbonButton
+	blayers            RibbonButton
+	blayersMenu        PopupMenu
+	blayerVisible      RibbonButton
+	blayerLocked       RibbonButton
+	bopacityMenu       PopupMenu
+	bblendMenu         PopupMenu
+	tools              *ToolsManager
+	resizeDialog       *ResizeDialog
+	propertiesDialog   *PropertiesDialog
+	rotateDialog       *RotateDialog
+	canvasSizeDialog   *CanvasSizeDialog
+	gifDialog          *GifDialog
+	initDone           bool
 }
 
+// Padding the auto trim menu offers to keep around the content, in pixels
+var trimPaddingSizes = [4]int{0, 4, 8, 16}
+
 const appWidth = 1300
 const appHeight = 840
 const newImageName = "Untitled"
@@ -82,15 +109,20 @@ func (window *MainWindow) Initialize() {
 	window.statusSelSize = statusbar.AddStatus(".\\icons\\selection-size.png", "")
 	window.statusCanvasSize = statusbar.AddStatus(".\\icons\\canvas-size.png", "")
 	window.statusFileSize = statusbar.AddStatus(".\\icons\\file-size.png", "")
+	window.statusZoom = statusbar.AddStatus(".\\icons\\zoom.png", "")
 	window.statusbar = statusbar
 
 	window.workspace = NewWorkspace(window)
 	window.workspace.SetDockType(DockFill)
+	window.UpdateLayerControls()
 
 	window.SetCurrentTool(window.tools.toolSelect)
 
 	window.resizeDialog = NewResizeDialog(window)
 	window.propertiesDialog = NewPropertiesDialog(window)
+	window.gifDialog = NewGifDialog(window)
+	window.rotateDialog = NewRotateDialog(window)
+	window.canvasSizeDialog = NewCanvasSizeDialog(window)
 
 	logInfo("Done initializing main window")
 	window.initDone = true
@@ -122,6 +154,7 @@ func (window *MainWindow) InitResources() {
 	window.hCursorSizeNESW = win.LoadCursor(0, win.MAKEINTRESOURCE(win.IDC_SIZENESW))
 	window.hCursorIBeam = win.LoadCursor(0, win.MAKEINTRESOURCE(win.IDC_IBEAM))
 	window.hCursorMove = win.LoadCursor(0, win.MAKEINTRESOURCE(win.IDC_SIZEALL))
+	window.hCursorRotate = win.LoadCursor(0, win.MAKEINTRESOURCE(win.IDC_HAND))
 }
 
 func (window *MainWindow) InitRibbonApplicationMenu() {
@@ -142,15 +175,20 @@ func (window *MainWindow) InitRibbonApplicationMenu() {
 	}
 
 	funcOpen := func(e *PopupItemEvent) {
-		filter := GetOpenFileDialogFilters()
+		filter := format.GetOpenFileDialogFilters()
 		filename, accepted := OpenFileDialog(window,
 			filter,
-			GetFormatCount()+1)
+			format.GetFormatCount()+1)
 		if accepted {
 			workspace := window.workspace
-			if workspace.canvas.OpenImage(filename) {
+			if err := workspace.canvas.OpenImage(filename); err != nil {
+				ShowError(window, app.Title, fmt.Sprintf("Could not open '%s', %v.", filepath.Base(filename), err))
+			} else {
 				workspace.RequestLayout()
-				fResetColors()
+				// Our own projects bring their colors along
+				if !strings.EqualFold(filepath.Ext(filename), format.ProjectExtension) {
+					fResetColors()
+				}
 				fileNameOnly := filepath.Base(filename)
 				window.SetText(fileNameOnly + " - " + app.Title)
 			}
@@ -159,15 +197,14 @@ func (window *MainWindow) InitRibbonApplicationMenu() {
 
 	fSaveAs := func(filename string) {
 		ext := filepath.Ext(filename)
-		filterIndex := FindFormatIndexFromExt(ext) + 1 // dialog filter indices are 1 based
-		filter := GetSaveFileDialogFilters()
+		filterIndex := format.FindEncodableFormatIndexFromExt(ext) + 1 // dialog filter indices are 1 based
+		filter := format.GetSaveFileDialogFilters()
 		newfilepath, accepted := SaveFileDialog(window, filename, filter, filterIndex)
 		if accepted {
-			workspace := window.workspace
-			workspace.canvas.SaveImage(newfilepath)
-			workspace.Repaint()
-			fileNameOnly := filepath.Base(newfilepath)
-			window.SetText(fileNameOnly + " - " + app.Title)
+			window.SaveImage(newfilepath, func() {
+				fileNameOnly := filepath.Base(newfilepath)
+				window.SetText(fileNameOnly + " - " + app.Title)
+			})
 		}
 	}
 
@@ -178,7 +215,7 @@ func (window *MainWindow) InitRibbonApplicationMenu() {
 		// If we already have a path
 		if image.HasFilePath() {
 			// We just simply overwrite the previous file
-			canvas.SaveImage(image.filepath)
+			window.SaveImage(image.filepath, nil)
 		} else {
 			fSaveAs("Untitled.png")
 		}
@@ -202,6 +239,13 @@ func (window *MainWindow) InitRibbonApplicationMenu() {
 		{Text: "Open", IconPath: ".\\icons\\big-open.png", OnClick: funcOpen},
 		{Text: "Save", IconPath: ".\\icons\\big-save.png", OnClick: fMenuSave},
 		{Text: "Save as", IconPath: ".\\icons\\big-save-as.png", OnClick: fMenuSaveAs},
+		{Sperator: true},
+		{Text: "Undo", OnClick: func(e *PopupItemEvent) {
+			window.workspace.canvas.Undo()
+		}},
+		{Text: "Redo", OnClick: func(e *PopupItemEvent) {
+			window.workspace.canvas.Redo()
+		}},
 		//{Sperator: true},
 		//{Text: "Print", IconPath: ".\\icons\\big-print.png"},
 		//{Sperator: true},
@@ -241,47 +285,87 @@ func (window *MainWindow) InitRibbon() {
 	var mpaste, mpasteFrom PopupMenuItem
 
 	bpasteMenu := NewPopupMenu(ribbon, []MenuItemInfo{
-		{Text: "Paste", IconPath: ".\\icons\\paste-small.png", AssignTo: &mpaste},
-		{Text: "Paste from", IconPath: ".\\icons\\paste-from-small.png", AssignTo: &mpasteFrom},
+		{Text: "Paste", IconPath: ".\\icons\\paste-small.png", AssignTo: &mpaste,
+			OnClick: func(e *PopupItemEvent) {
+				window.Paste()
+			}},
+		{Text: "Paste from", IconPath: ".\\icons\\paste-from-small.png", AssignTo: &mpasteFrom,
+			OnClick: func(e *PopupItemEvent) {
+				window.PasteFrom()
+			}},
 	})
 	bpaste.SetDropdownMenu(bpasteMenu, true)
-	bpaste.SetEnabled(false)
-	mpaste.SetEnabled(false)
-	mpasteFrom.SetEnabled(false)
+	bpaste.SetClickEvent(func(e *RibbonButtonEvent) {
+		window.Paste()
+	})
 
 	bcut := clipboard.AddImageButton("Cut", ".\\icons\\cut.png", RibbonButtonSizeMedium)
 	bcopy := clipboard.AddImageButton("Copy", ".\\icons\\copy.png", RibbonButtonSizeMedium)
 
-	bcut.SetEnabled(false)
-	bcopy.SetEnabled(false)
+	bcut.SetClickEvent(func(e *RibbonButtonEvent) {
+		window.Cut()
+	})
+	bcopy.SetClickEvent(func(e *RibbonButtonEvent) {
+		window.Copy()
+	})
 
 	imagesec := home.AddSection("Image")
 
 	selectIcon, _ := CreateBitmapImage(".\\icons\\select.png", false)
 	lassoIcon, _ := CreateBitmapImage(".\\icons\\select-lasso.png", false)
+	wandIcon, _ := CreateBitmapImage(".\\icons\\select-wand.png", false)
 
 	bselect := imagesec.AddImageButton("Select", ".\\icons\\select.png", RibbonButtonSizeBig)
 	window.btnTools = append(window.btnTools, bselect)
 
 	bselect.SetIcon(selectIcon)
 
-	var regularSel, lassoSel PopupMenuItem
-	bselectMenu := NewPopupMenu(ribbon, []MenuItemInfo{
+	var regularSel, lassoSel, wandSel PopupMenuItem
+	var wandContiguous, wandGlobal PopupMenuItem
+	var transparentSel PopupMenuItem
+	fselectMode := func(mode int, icon *BitmapImage) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			bselect.SetIcon(icon)
+			regularSel.SetToggled(mode == SelectModeRectangle)
+			lassoSel.SetToggled(mode == SelectModeFreeForm)
+			wandSel.SetToggled(mode == SelectModeMagicWand)
+			window.tools.toolSelect.mode = mode
+			window.SetCurrentTool(window.tools.toolSelect)
+		}
+	}
+	fwandMode := func(all bool) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			window.tools.toolSelect.wandOptions.Global = all
+			wandContiguous.SetToggled(!all)
+			wandGlobal.SetToggled(all)
+		}
+	}
+	ffilter := func(filter raster.Filter) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			window.SetResampling(filter)
+		}
+	}
+	window.menuResampling = make([]PopupMenuItem, raster.GetFilterCount())
+	resamplingItems := []MenuItemInfo{{Text: "Resampling", Sperator: true}}
+	for i := range window.menuResampling {
+		filter := raster.Filter(i)
+		resamplingItems = append(resamplingItems, MenuItemInfo{Text: filter.String(),
+			AssignTo: &window.menuResampling[i], OnClick: ffilter(filter)})
+	}
+	wandTolerances, selectWandTolerance := toleranceMenu("Magic wand tolerance", &window.tools.toolSelect.wandOptions.Tolerance, nil)
+	selectItems := []MenuItemInfo{
 		{Text: "Selection shapes", Sperator: true},
 		{Text: "Rectangular selection", IconPath: ".\\icons\\select-small.png", AssignTo: &regularSel,
-			OnClick: func(e *PopupItemEvent) {
-				bselect.SetIcon(selectIcon)
-				regularSel.SetToggled(true)
-				lassoSel.SetToggled(false)
-				window.SetCurrentTool(window.tools.toolSelect)
-			}},
+			OnClick: fselectMode(SelectModeRectangle, selectIcon)},
 		{Text: "Free-form selection", IconPath: ".\\icons\\select-lasso-small.png", AssignTo: &lassoSel,
-			OnClick: func(e *PopupItemEvent) {
-				bselect.SetIcon(lassoIcon)
-				regularSel.SetToggled(false)
-				lassoSel.SetToggled(true)
-				window.SetCurrentTool(window.tools.toolSelect)
-			}},
+			OnClick: fselectMode(SelectModeFreeForm, lassoIcon)},
+		{Text: "Magic wand", IconPath: ".\\icons\\select-wand-small.png", AssignTo: &wandSel,
+			OnClick: fselectMode(SelectModeMagicWand, wandIcon)},
+	}
+	selectItems = append(selectItems, wandTolerances...)
+	selectItems = append(selectItems, []MenuItemInfo{
+		{Text: "Contiguous", AssignTo: &wandContiguous, OnClick: fwandMode(false)},
+		{Text: "All matching pixels", AssignTo: &wandGlobal, OnClick: fwandMode(true)},
 		{Text: "Selection options", Sperator: true},
 		{Text: "Select all", IconPath: ".\\icons\\select-all-small.png",
 			OnClick: func(e *PopupItemEvent) {
@@ -292,34 +376,118 @@ func (window *MainWindow) InitRibbon() {
 			window.SetCurrentTool(window.tools.toolSelect)
 			window.tools.toolSelect.Deselect()
 		}},
-		{Text: "Invert selection", IconPath: ".\\icons\\select-invert-small.png"},
+		{Text: "Invert selection", IconPath: ".\\icons\\select-invert-small.png",
+			OnClick: func(e *PopupItemEvent) {
+				window.SetCurrentTool(window.tools.toolSelect)
+				window.tools.toolSelect.InvertSelection()
+			}},
+		{Text: "Select color 1", OnClick: func(e *PopupItemEvent) {
+			window.SetCurrentTool(window.tools.toolSelect)
+			c := window.color1.GetColor()
+			window.tools.toolSelect.SelectColor(c.AsNRGBA())
+		}},
 		{Text: "Delete", IconPath: ".\\icons\\delete-small.png",
 			OnClick: func(e *PopupItemEvent) {
 				window.SetCurrentTool(window.tools.toolSelect)
 				window.tools.toolSelect.DeleteSelection()
 			}},
-		//{Text: "Transparent selection"},
-	})
+		{Text: "Transparent selection", AssignTo: &transparentSel, OnClick: func(e *PopupItemEvent) {
+			tool := window.tools.toolSelect
+			tool.transparent = !tool.transparent
+			transparentSel.SetToggled(tool.transparent)
+			window.workspace.canvas.Repaint()
+		}},
+		{Text: "Resize and skew...", OnClick: func(e *PopupItemEvent) {
+			window.resizeDialog.Show()
+		}},
+	}...)
+	bselectMenu := NewPopupMenu(ribbon, append(selectItems, resamplingItems...))
 	bselect.SetDropdownMenu(bselectMenu, true)
 	regularSel.SetToggled(true)
+	selectWandTolerance(1)
+	wandContiguous.SetToggled(true)
+	window.SetResampling(raster.FilterNearest)
 
 	bcrop := imagesec.AddImageButton("Crop", ".\\icons\\crop.png", RibbonButtonSizeMedium)
-	bcrop.SetEnabled(false)
+	bcrop.SetClickEvent(func(e *RibbonButtonEvent) {
+		window.tools.toolSelect.CropToSelection()
+	})
 
 	imagesec.AddImageButton("Resize", ".\\icons\\resize.png", RibbonButtonSizeMedium).SetClickEvent(func(e *RibbonButtonEvent) {
-		window.resizeDialog.Show(true, func() {
-			log.Println("Implement resizing!")
-		})
+		window.resizeDialog.Show()
+	})
+
+	imagesec.AddImageButton("Canvas size", ".\\icons\\canvas.png", RibbonButtonSizeMedium).SetClickEvent(func(e *RibbonButtonEvent) {
+		window.canvasSizeDialog.Show()
+	})
+
+	btrim := imagesec.AddImageButton("Auto trim", ".\\icons\\trim.png", RibbonButtonSizeMedium)
+	btrim.SetClickEvent(func(e *RibbonButtonEvent) {
+		window.tools.toolSelect.Deselect()
+		if window.workspace.canvas.AutoTrim(window.trimOptions) {
+			window.workspace.RequestLayout()
+		}
 	})
+	var trimColor, trimTransparent PopupMenuItem
+	var trimPaddings [len(trimPaddingSizes)]PopupMenuItem
+	ftrimMode := func(transparent bool) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			window.trimOptions.Transparent = transparent
+			trimColor.SetToggled(!transparent)
+			trimTransparent.SetToggled(transparent)
+		}
+	}
+	ftrimPadding := func(index int) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			window.trimOptions.Padding = trimPaddingSizes[index]
+			for i, item := range trimPaddings {
+				item.SetToggled(i == index)
+			}
+		}
+	}
+	trimTolerances, selectTrimTolerance := toleranceMenu("Corner color tolerance", &window.trimOptions.Tolerance, nil)
+	trimItems := []MenuItemInfo{
+		{Text: "Trim borders of", Sperator: true},
+		{Text: "Corner color", AssignTo: &trimColor, OnClick: ftrimMode(false)},
+		{Text: "Transparency", AssignTo: &trimTransparent, OnClick: ftrimMode(true)},
+	}
+	trimItems = append(trimItems, trimTolerances...)
+	trimItems = append(trimItems, []MenuItemInfo{
+		{Text: "Padding", Sperator: true},
+		{Text: "None", AssignTo: &trimPaddings[0], OnClick: ftrimPadding(0)},
+		{Text: "4px", AssignTo: &trimPaddings[1], OnClick: ftrimPadding(1)},
+		{Text: "8px", AssignTo: &trimPaddings[2], OnClick: ftrimPadding(2)},
+		{Text: "16px", AssignTo: &trimPaddings[3], OnClick: ftrimPadding(3)},
+	}...)
+	btrim.SetDropdownMenu(NewPopupMenu(ribbon, trimItems), true)
+	ftrimMode(false)(nil)
+	selectTrimTolerance(1)
+	ftrimPadding(0)(nil)
 
 	brotate := imagesec.AddImageButton("Rotate", ".\\icons\\rotate.png", RibbonButtonSizeMedium)
 
+	// The floating selection turns if there is one, else the whole image
+	freorient := func(turn func(src *BGRA) *BGRA, quarter, mirrored bool) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			tool := window.tools.toolSelect
+			if tool.IsFloating() {
+				tool.Reorient(turn, quarter, mirrored)
+				return
+			}
+			tool.Deselect()
+			window.workspace.canvas.Reorient(turn)
+			window.workspace.RequestLayout()
+		}
+	}
 	brotateMenu := NewPopupMenu(ribbon, []MenuItemInfo{
-		{Text: "Rotate right 90", IconPath: ".\\icons\\rotate-right-small.png"},
-		{Text: "Rotate left 90", IconPath: ".\\icons\\rotate-left-small.png"},
-		{Text: "Rotate 180", IconPath: ".\\icons\\rotate-180-small.png"},
-		{Text: "Flip vertical", IconPath: ".\\icons\\rotate-v-small.png"},
-		{Text: "Flip horizontal", IconPath: ".\\icons\\rotate-h-small.png"},
+		{Text: "Rotate right 90", IconPath: ".\\icons\\rotate-right-small.png", OnClick: freorient(raster.RotateRight, true, false)},
+		{Text: "Rotate left 90", IconPath: ".\\icons\\rotate-left-small.png", OnClick: freorient(raster.RotateLeft, true, false)},
+		{Text: "Rotate 180", IconPath: ".\\icons\\rotate-180-small.png", OnClick: freorient(raster.Rotate180, false, false)},
+		{Text: "Flip vertical", IconPath: ".\\icons\\rotate-v-small.png", OnClick: freorient(raster.FlipVertical, false, true)},
+		{Text: "Flip horizontal", IconPath: ".\\icons\\rotate-h-small.png", OnClick: freorient(raster.FlipHorizontal, false, true)},
+		{Text: "Rotate by angle...", OnClick: func(e *PopupItemEvent) {
+			window.rotateDialog.Show()
+		}},
 	})
 	brotate.SetDropdownMenu(brotateMenu, false)
 
@@ -331,14 +499,16 @@ func (window *MainWindow) InitRibbon() {
 	bbucket := tools.AddImageButton("Fill with color", ".\\icons\\fill.png", RibbonButtonSizeSmall)
 	bpickcolor := tools.AddImageButton("Color picker", ".\\icons\\pick.png", RibbonButtonSizeSmall)
 	btext := tools.AddImageButton("Text", ".\\icons\\text.png", RibbonButtonSizeSmall)
-	//bzoom := tools.AddImageButton("Magnifier", ".\\icons\\zoom.png", RibbonButtonSizeSmall)
+	bzoom := tools.AddImageButton("Magnifier", ".\\icons\\zoom.png", RibbonButtonSizeSmall)
+
+	window.InitBucketMenu(bbucket)
 
 	window.btnTools = append(window.btnTools, bpencil)
 	window.btnTools = append(window.btnTools, beraser)
 	window.btnTools = append(window.btnTools, bbucket)
 	window.btnTools = append(window.btnTools, bpickcolor)
 	window.btnTools = append(window.btnTools, btext)
-	//window.btnTools = append(window.btnTools, bzoom)
+	window.btnTools = append(window.btnTools, bzoom)
 
 	brushsec := home.AddSection("")
 
@@ -387,6 +557,8 @@ func (window *MainWindow) InitRibbon() {
 			window.buttonToolPairs[btn] = window.tools.toolText
 		case bselect:
 			window.buttonToolPairs[btn] = window.tools.toolSelect
+		case bzoom:
+			window.buttonToolPairs[btn] = window.tools.toolMagnifier
 		// Shapes
 		case bline:
 			window.buttonToolPairs[btn] = window.tools.toolShapeLine
@@ -441,21 +613,32 @@ func (window *MainWindow) InitRibbon() {
 
 	bfill := shapes.AddImageButton("Fill", ".\\icons\\fill-type.png", RibbonButtonSizeMedium)
 
-	bfillMenu := NewPopupMenu(ribbon, []MenuItemInfo{
+	fillItems := []MenuItemInfo{
 		{Text: "No fill", IconPath: ".\\icons\\no-fill-small.png", AssignTo: &window.menuNoFill},
 		{Text: "Solid color", IconPath: ".\\icons\\solid-color-small.png", AssignTo: &window.menuSolidFill},
-	})
+		{Text: "Gradient", AssignTo: &window.menuGradientFill},
+		{Text: "Pattern", AssignTo: &window.menuPatternFill},
+	}
+	styleItems, toggleStyleItems := window.fillStyleMenuItems()
+	bfillMenu := NewPopupMenu(ribbon, append(fillItems, styleItems...))
 	window.menuNoFill.SetToggled(true)
+	toggleStyleItems()
 	bfill.SetDropdownMenu(bfillMenu, false)
 
-	window.menuNoFill.SetClickEvent(func(e *PopupItemEvent) {
-		window.menuNoFill.SetToggled(true)
-		window.menuSolidFill.SetToggled(false)
-	})
-	window.menuSolidFill.SetClickEvent(func(e *PopupItemEvent) {
-		window.menuSolidFill.SetToggled(true)
-		window.menuNoFill.SetToggled(false)
-	})
+	fillKinds := []PopupMenuItem{window.menuNoFill, window.menuSolidFill, window.menuGradientFill, window.menuPatternFill}
+	ffillKind := func(selected PopupMenuItem) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			if selected == window.menuPatternFill && window.fillStyle.Pattern == nil && !window.LoadPattern() {
+				return
+			}
+			for _, item := range fillKinds {
+				item.SetToggled(item == selected)
+			}
+		}
+	}
+	for _, item := range fillKinds {
+		item.SetClickEvent(ffillKind(item))
+	}
 
 	sizesec := home.AddSection("")
 
@@ -483,13 +666,21 @@ func (window *MainWindow) InitRibbon() {
 	// init all the color buttons
 	window.InitRibbonColorSection(home)
 
+	window.InitRibbonLayersTab()
+
 	// view
 	view := ribbon.AddTab("View")
 	szoom := view.AddSection("Zoom")
 
-	szoom.AddImageButton("Zoom\nin", ".\\icons\\zoom-in.png", RibbonButtonSizeBig).SetEnabled(false)
-	szoom.AddImageButton("Zoom\nout", ".\\icons\\zoom-out.png", RibbonButtonSizeBig).SetEnabled(false)
-	szoom.AddImageButton("100\n%", ".\\icons\\zoom-100.png", RibbonButtonSizeBig)
+	szoom.AddImageButton("Zoom\nin", ".\\icons\\zoom-in.png", RibbonButtonSizeBig).SetClickEvent(func(e *RibbonButtonEvent) {
+		window.workspace.ZoomCentered(window.workspace.canvas.view.Zoom.In())
+	})
+	szoom.AddImageButton("Zoom\nout", ".\\icons\\zoom-out.png", RibbonButtonSizeBig).SetClickEvent(func(e *RibbonButtonEvent) {
+		window.workspace.ZoomCentered(window.workspace.canvas.view.Zoom.Out())
+	})
+	szoom.AddImageButton("100\n%", ".\\icons\\zoom-100.png", RibbonButtonSizeBig).SetClickEvent(func(e *RibbonButtonEvent) {
+		window.workspace.ZoomCentered(raster.ZoomActual)
+	})
 
 	shideshow := view.AddSection("Show or hide")
 
@@ -517,6 +708,426 @@ func (window *MainWindow) InitRibbon() {
 	ribbon.ResumeRepaint()
 }
 
+func (window *MainWindow) InitRibbonLayersTab() {
+	ribbon := window.ribbon
+	canvas := func() *DrawingCanvas {
+		return window.workspace.canvas
+	}
+
+	layersTab := ribbon.AddTab("Layers")
+	slayers := layersTab.AddSection("Layers")
+
+	window.blayers = slayers.AddImageButton("Layers", ".\\icons\\layers.png", RibbonButtonSizeBig)
+	window.blayersMenu = NewPopupMenu(ribbon, nil)
+	window.blayers.SetDropdownMenu(window.blayersMenu, false)
+
+	slayers.AddImageButton("Add layer", ".\\icons\\layer-add.png", RibbonButtonSizeMedium).SetClickEvent(func(e *RibbonButtonEvent) {
+		canvas().ChangeLayers(func(layers *LayerStack) {
+			size := canvas().image.Bounds().Size()
+			layers.Insert(layers.ActiveIndex()+1, NewLayer(layers.NextLayerName(), size.X, size.Y))
+		})
+	})
+	slayers.AddImageButton("Duplicate", ".\\icons\\layer-duplicate.png", RibbonButtonSizeMedium).SetClickEvent(func(e *RibbonButtonEvent) {
+		canvas().ChangeLayers(func(layers *LayerStack) {
+			active := layers.Active()
+			size := canvas().image.Bounds().Size()
+			layer := active.CloneEmpty(size.X, size.Y)
+			layer.Name = active.Name + " copy"
+			layer.Background = false
+			copy(layer.surface.Pix, active.surface.Pix)
+			layers.Insert(layers.ActiveIndex()+1, layer)
+		})
+	})
+	slayers.AddImageButton("Delete", ".\\icons\\layer-delete.png", RibbonButtonSizeMedium).SetClickEvent(func(e *RibbonButtonEvent) {
+		// We always keep at least one layer around
+		if canvas().layers.Count() > 1 {
+			canvas().ChangeLayers(func(layers *LayerStack) {
+				layers.Remove(layers.ActiveIndex()).Dispose()
+			})
+		}
+	})
+	slayers.AddImageButton("Merge down", ".\\icons\\layer-merge.png", RibbonButtonSizeMedium).SetClickEvent(func(e *RibbonButtonEvent) {
+		if canvas().layers.ActiveIndex() > 0 {
+			canvas().ChangeLayers(func(layers *LayerStack) {
+				layers.MergeDown(layers.ActiveIndex())
+			})
+		}
+	})
+	slayers.AddImageButton("Move up", ".\\icons\\layer-up.png", RibbonButtonSizeMedium).SetClickEvent(func(e *RibbonButtonEvent) {
+		if canvas().layers.ActiveIndex() < canvas().layers.Count()-1 {
+			canvas().ChangeLayers(func(layers *LayerStack) {
+				layers.Move(layers.ActiveIndex(), layers.ActiveIndex()+1)
+			})
+		}
+	})
+	slayers.AddImageButton("Move down", ".\\icons\\layer-down.png", RibbonButtonSizeMedium).SetClickEvent(func(e *RibbonButtonEvent) {
+		if canvas().layers.ActiveIndex() > 0 {
+			canvas().ChangeLayers(func(layers *LayerStack) {
+				layers.Move(layers.ActiveIndex(), layers.ActiveIndex()-1)
+			})
+		}
+	})
+
+	sproperties := layersTab.AddSection("Properties")
+
+	window.blayerVisible = sproperties.AddCheckButton("Visible", true)
+	window.blayerVisible.SetClickEvent(func(e *RibbonButtonEvent) {
+		visible := window.blayerVisible.IsToggled()
+		canvas().ChangeActiveLayer(func(layer *Layer) {
+			layer.Visible = visible
+		})
+	})
+	window.blayerLocked = sproperties.AddCheckButton("Locked", false)
+	window.blayerLocked.SetClickEvent(func(e *RibbonButtonEvent) {
+		locked := window.blayerLocked.IsToggled()
+		canvas().ChangeActiveLayer(func(layer *Layer) {
+			layer.Locked = locked
+		})
+	})
+
+	fopacity := func(opacity uint8) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			canvas().ChangeActiveLayer(func(layer *Layer) {
+				layer.Opacity = opacity
+			})
+		}
+	}
+	bopacity := sproperties.AddImageButton("Opacity", ".\\icons\\opacity.png", RibbonButtonSizeMedium)
+	window.bopacityMenu = NewPopupMenu(ribbon, []MenuItemInfo{
+		{Text: "100%", OnClick: fopacity(255)},
+		{Text: "75%", OnClick: fopacity(191)},
+		{Text: "50%", OnClick: fopacity(128)},
+		{Text: "25%", OnClick: fopacity(64)},
+	})
+	bopacity.SetDropdownMenu(window.bopacityMenu, false)
+
+	bblend := sproperties.AddImageButton("Blend mode", ".\\icons\\blend.png", RibbonButtonSizeMedium)
+	blendItems := make([]MenuItemInfo, raster.GetBlendModeCount())
+	for i := range blendItems {
+		mode := raster.BlendMode(i)
+		blendItems[i] = MenuItemInfo{Text: mode.String(), OnClick: func(e *PopupItemEvent) {
+			canvas().ChangeActiveLayer(func(layer *Layer) {
+				layer.Blend = mode
+			})
+		}}
+	}
+	window.bblendMenu = NewPopupMenu(ribbon, blendItems)
+	bblend.SetDropdownMenu(window.bblendMenu, false)
+}
+
+// InitBucketMenu puts the flood fill options into the dropdown of the bucket button
+func (window *MainWindow) InitBucketMenu(bbucket RibbonButton) {
+	bucket := window.tools.toolBucket
+	var contiguous4, contiguous8, global, sampleLayer, sampleAll, antialias PopupMenuItem
+	var gaps [len(bucketGapSizes)]PopupMenuItem
+	var fillKinds [3]PopupMenuItem
+	fmode := func(diagonal, all bool) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			bucket.options.Diagonal = diagonal
+			bucket.options.Global = all
+			contiguous4.SetToggled(!diagonal && !all)
+			contiguous8.SetToggled(diagonal && !all)
+			global.SetToggled(all)
+			window.SetCurrentTool(bucket)
+		}
+	}
+	fgaps := func(index int) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			bucket.options.GapSize = bucketGapSizes[index]
+			for i, item := range gaps {
+				item.SetToggled(i == index)
+			}
+			window.SetCurrentTool(bucket)
+		}
+	}
+	ffillKind := func(kind FillKind) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			if kind == FillPattern && window.fillStyle.Pattern == nil && !window.LoadPattern() {
+				return
+			}
+			bucket.fillKind = kind
+			for i, item := range fillKinds {
+				item.SetToggled(FillKind(i) == kind)
+			}
+			window.SetCurrentTool(bucket)
+		}
+	}
+	fsample := func(allLayers bool) func(e *PopupItemEvent) {
+		return func(e *PopupItemEvent) {
+			bucket.sampleAllLayers = allLayers
+			sampleLayer.SetToggled(!allLayers)
+			sampleAll.SetToggled(allLayers)
+			window.SetCurrentTool(bucket)
+		}
+	}
+	tolerances, selectTolerance := toleranceMenu("Tolerance", &bucket.options.Tolerance, func() {
+		window.SetCurrentTool(bucket)
+	})
+	bucketItems := []MenuItemInfo{
+		{Text: "Fill with", Sperator: true},
+		{Text: "Solid color", AssignTo: &fillKinds[FillSolid], OnClick: ffillKind(FillSolid)},
+		{Text: "Gradient", AssignTo: &fillKinds[FillGradient], OnClick: ffillKind(FillGradient)},
+		{Text: "Pattern", AssignTo: &fillKinds[FillPattern], OnClick: ffillKind(FillPattern)},
+	}
+	bucketItems = append(bucketItems, tolerances...)
+	bucketItems = append(bucketItems, []MenuItemInfo{
+		{Text: "Fill mode", Sperator: true},
+		{Text: "Contiguous, 4 neighbours", AssignTo: &contiguous4, OnClick: fmode(false, false)},
+		{Text: "Contiguous, 8 neighbours", AssignTo: &contiguous8, OnClick: fmode(true, false)},
+		{Text: "All matching pixels", AssignTo: &global, OnClick: fmode(false, true)},
+		{Text: "Close gaps", Sperator: true},
+		{Text: "Don't close gaps", AssignTo: &gaps[0], OnClick: fgaps(0)},
+		{Text: "Small gaps (2 px)", AssignTo: &gaps[1], OnClick: fgaps(1)},
+		{Text: "Medium gaps (4 px)", AssignTo: &gaps[2], OnClick: fgaps(2)},
+		{Text: "Large gaps (8 px)", AssignTo: &gaps[3], OnClick: fgaps(3)},
+		{Text: "Edges", Sperator: true},
+		{Text: "Anti-aliased fill", AssignTo: &antialias, OnClick: func(e *PopupItemEvent) {
+			bucket.options.Antialias = !bucket.options.Antialias
+			antialias.SetToggled(bucket.options.Antialias)
+			window.SetCurrentTool(bucket)
+		}},
+		{Text: "Sample", Sperator: true},
+		{Text: "Current layer", AssignTo: &sampleLayer, OnClick: fsample(false)},
+		{Text: "All layers", AssignTo: &sampleAll, OnClick: fsample(true)},
+	}...)
+	bbucket.SetDropdownMenu(NewPopupMenu(window.ribbon, bucketItems), true)
+	fillKinds[FillSolid].SetToggled(true)
+	selectTolerance(0)
+	contiguous4.SetToggled(true)
+	gaps[0].SetToggled(true)
+	sampleLayer.SetToggled(true)
+}
+
+// toleranceMenu returns the menu items choosing one of the color tolerances into tolerance,
+// changed gets called after a click. Call the returned function once the items are
+// created to pick the initial tolerance
+func toleranceMenu(title string, tolerance *int, changed func()) ([]MenuItemInfo, func(index int)) {
+	names := [len(bucketTolerances)]string{"Exact color", "Low (10%)", "Medium (25%)", "High (50%)"}
+	toleranceItems := make([]PopupMenuItem, len(bucketTolerances))
+	selectTolerance := func(index int) {
+		*tolerance = bucketTolerances[index]
+		for i, item := range toleranceItems {
+			item.SetToggled(i == index)
+		}
+	}
+	items := []MenuItemInfo{{Text: title, Sperator: true}}
+	for i := range toleranceItems {
+		index := i
+		items = append(items, MenuItemInfo{Text: names[i], AssignTo: &toleranceItems[i], OnClick: func(e *PopupItemEvent) {
+			selectTolerance(index)
+			if changed != nil {
+				changed()
+			}
+		}})
+	}
+	return items, selectTolerance
+}
+
+// fillStyleMenuItems returns the menu items choosing the gradient and the pattern, call
+// the returned function once they're created to mark the current choices
+func (window *MainWindow) fillStyleMenuItems() ([]MenuItemInfo, func()) {
+	style := &window.fillStyle
+	kindItems := make([]PopupMenuItem, raster.GetGradientKindCount())
+	colorsItems := make([]PopupMenuItem, GetGradientColorsCount())
+	items := []MenuItemInfo{{Text: "Gradient shape", Sperator: true}}
+	for i := range kindItems {
+		kind := raster.GradientKind(i)
+		items = append(items, MenuItemInfo{Text: kind.String(), AssignTo: &kindItems[i], OnClick: func(e *PopupItemEvent) {
+			style.Gradient = kind
+			for j, item := range kindItems {
+				item.SetToggled(raster.GradientKind(j) == kind)
+			}
+		}})
+	}
+	items = append(items, MenuItemInfo{Text: "Gradient colors", Sperator: true})
+	for i := range colorsItems {
+		colors := GradientColors(i)
+		items = append(items, MenuItemInfo{Text: colors.String(), AssignTo: &colorsItems[i], OnClick: func(e *PopupItemEvent) {
+			style.Colors = colors
+			for j, item := range colorsItems {
+				item.SetToggled(GradientColors(j) == colors)
+			}
+		}})
+	}
+	items = append(items,
+		MenuItemInfo{Text: "Pattern", Sperator: true},
+		MenuItemInfo{Text: "Load pattern...", OnClick: func(e *PopupItemEvent) {
+			window.LoadPattern()
+		}},
+		MenuItemInfo{Text: "Pattern from selection", OnClick: func(e *PopupItemEvent) {
+			window.PatternFromSelection()
+		}},
+	)
+	return items, func() {
+		kindItems[style.Gradient].SetToggled(true)
+		colorsItems[style.Colors].SetToggled(true)
+	}
+}
+
+// LoadPattern asks for an image file to fill with, false if none got loaded
+func (window *MainWindow) LoadPattern() bool {
+	pattern := window.chooseImageFile()
+	if pattern == nil {
+		return false
+	}
+	window.fillStyle.Pattern = pattern
+	return true
+}
+
+// chooseImageFile asks for an image file and decodes it, nil if none got opened
+func (window *MainWindow) chooseImageFile() *BGRA {
+	filename, accepted := OpenFileDialog(window, format.GetOpenFileDialogFilters(), format.GetFormatCount()+1)
+	if !accepted {
+		return nil
+	}
+	img, warning, err := format.DecodeImageFile(filename)
+	if err != nil {
+		ShowError(window, app.Title, fmt.Sprintf("Could not open '%s', %v.", filepath.Base(filename), err))
+		return nil
+	}
+	if len(warning) > 0 {
+		ShowWarning(window, app.Title, warning)
+	}
+	return img
+}
+
+// Cut moves the selected pixels to the clipboard
+func (window *MainWindow) Cut() {
+	window.tools.toolSelect.Cut()
+	window.workspace.canvas.Repaint()
+}
+
+// Copy puts a copy of the selected pixels on the clipboard
+func (window *MainWindow) Copy() {
+	window.tools.toolSelect.Copy()
+}
+
+// Paste puts what the clipboard holds on the canvas as a floating selection
+func (window *MainWindow) Paste() {
+	if window.clipboard == nil {
+		return
+	}
+	window.SetCurrentTool(window.tools.toolSelect)
+	window.tools.toolSelect.PasteClip(window.clipboard)
+	window.workspace.canvas.Repaint()
+}
+
+// PasteFrom pastes an image file as a floating selection
+func (window *MainWindow) PasteFrom() {
+	img := window.chooseImageFile()
+	if img == nil {
+		return
+	}
+	window.SetCurrentTool(window.tools.toolSelect)
+	window.tools.toolSelect.PasteClip(raster.NewImageClip(img))
+	window.workspace.canvas.Repaint()
+}
+
+// PatternFromSelection makes the selected pixels of the active layer the fill pattern
+func (window *MainWindow) PatternFromSelection() bool {
+	tool := window.tools.toolSelect
+	if tool.selection.IsEmpty() {
+		ShowWarning(window, app.Title, "Select the area to use as a pattern first.")
+		return false
+	}
+	canvas := window.workspace.canvas
+	canvas.BeginEdit()
+	tool.finalizeSelection()
+	canvas.EndEdit()
+	rect := tool.selection.GetRect()
+	pattern := raster.Crop(&canvas.ActiveImage().BGRA, rect.AsImageRect())
+	if pattern.Rect.Empty() {
+		return false
+	}
+	window.fillStyle.Pattern = pattern
+	return true
+}
+
+// UpdateLayerControls brings the layers tab in sync with the layers of the canvas
+func (window *MainWindow) UpdateLayerControls() {
+	if window.blayersMenu == nil || window.workspace == nil || window.workspace.canvas == nil {
+		return
+	}
+	layers := window.workspace.canvas.layers
+	if layers == nil {
+		return
+	}
+	// The top most layer comes first in the menu
+	window.blayersMenu.ClearItems()
+	items := make([]MenuItemInfo, layers.Count())
+	for i := range items {
+		index := layers.Count() - 1 - i
+		items[i] = MenuItemInfo{Text: layers.Get(index).Name, OnClick: func(e *PopupItemEvent) {
+			// The floating pixels go back into the layer they were lifted from
+			canvas := window.workspace.canvas
+			canvas.BeginEdit()
+			window.tools.toolSelect.finalizeSelection()
+			canvas.EndEdit()
+			layers.SetActive(index)
+			window.UpdateLayerControls()
+			canvas.Repaint()
+		}}
+	}
+	window.blayersMenu.AddItems(items)
+	for i, item := range window.blayersMenu.GetItems() {
+		item.(PopupMenuItem).SetToggled(layers.Count()-1-i == layers.ActiveIndex())
+	}
+
+	active := layers.Active()
+	window.blayerVisible.SetToggled(active.Visible)
+	window.blayerLocked.SetToggled(active.Locked)
+	opacity := strconv.Itoa((int(active.Opacity)*100+127)/255) + "%"
+	for _, item := range window.bopacityMenu.GetItems() {
+		menuitem := item.(PopupMenuItem)
+		menuitem.SetToggled(menuitem.GetText() == opacity)
+	}
+	for i, item := range window.bblendMenu.GetItems() {
+		item.(PopupMenuItem).SetToggled(raster.BlendMode(i) == active.Blend)
+	}
+	window.ribbon.Repaint()
+}
+
+// SaveImage writes the image to the given file, asking for the format options first
+// where the format has any. fOnSaved runs once the image got saved
+func (window *MainWindow) SaveImage(filePath string, fOnSaved func()) {
+	options := format.DefaultEncodeOptions
+	save := func() {
+		workspace := window.workspace
+		if err := workspace.canvas.SaveImage(filePath, options); err != nil {
+			ShowError(window, app.Title, fmt.Sprintf("Could not save '%s', %v.", filepath.Base(filePath), err))
+		} else if fOnSaved != nil {
+			fOnSaved()
+		}
+		workspace.Repaint()
+	}
+	if strings.EqualFold(filepath.Ext(filePath), ".gif") {
+		window.gifDialog.Show(func(gif format.GifOptions) {
+			options.Gif = gif
+			save()
+		})
+	} else {
+		save()
+	}
+}
+
+// UpdateTitle shows the name of the current image file in the title bar
+func (window *MainWindow) UpdateTitle() {
+	image := window.workspace.canvas.image
+	if image.HasFilePath() {
+		window.SetText(filepath.Base(image.filepath) + " - " + app.Title)
+	} else {
+		window.SetText(newImageName + " - " + app.Title)
+	}
+}
+
+// SetResampling chooses how the transformed selection gets resampled when it is pasted
+func (window *MainWindow) SetResampling(filter raster.Filter) {
+	window.tools.toolSelect.filter = filter
+	for i, item := range window.menuResampling {
+		item.SetToggled(raster.Filter(i) == filter)
+	}
+}
+
 func (window *MainWindow) SetCurrentTool(newTool Tool) {
 	if window.tools.GetCurrentTool() == newTool {
 		return
@@ -613,26 +1224,24 @@ func (window *MainWindow) InitRibbonColorSection(home *RibbonTab) {
 
 	beditcolors := colors.AddImageButton("Edit\ncolors", ".\\icons\\edit-colors.png", RibbonButtonSizeBig)
 
-	customColorButtons := make([]RibbonButton, 0)
+	window.customColorButtons = make([]RibbonButton, 0)
 	for _, button := range colorbuttons {
 		if button.GetText() == "Custom" {
 			button.SetEnabled(false)
-			customColorButtons = append(customColorButtons, button)
+			window.customColorButtons = append(window.customColorButtons, button)
 		}
 	}
+	customColorButtons := window.customColorButtons
+	// The ones that don't fit into the ribbon start white
+	for i := len(customColorButtons); i < len(window.customColors); i++ {
+		window.customColors[i] = Rgb(255, 255, 255)
+	}
 
 	beditcolors.SetClickEvent(func(e *RibbonButtonEvent) {
-		var prevCustomColors [16]Color
-		// Obtain the 10 colors from our custom color buttons
-		for i, button := range customColorButtons {
-			prevCustomColors[i] = button.GetColor()
-		}
-		// Fill the rest 6 with white colors
-		for i := 10; i < 16; i++ {
-			prevCustomColors[i] = Rgb(255, 255, 255)
-		}
+		prevCustomColors := window.GetCustomColors()
 		prevColor := fForegroundBackground().GetColor()
-		newColor, _ := ChoseColorDialog(window, prevColor, prevCustomColors)
+		newColor, dialogColors := ChoseColorDialog(window, prevColor, prevCustomColors)
+		copy(window.customColors[len(customColorButtons):], dialogColors[len(customColorButtons):])
 		fForegroundBackground().SetColor(newColor)
 		// Check if it's a new color, then we add it into the custom colors
 		if !newColor.IsEqualTo(&prevColor) {
@@ -672,3 +1281,24 @@ func (window *MainWindow) InitRibbonColorSection(home *RibbonTab) {
 		}
 	})
 }
+
+// GetCustomColors returns the 16 custom colors, the ones shown in the ribbon come first
+func (window *MainWindow) GetCustomColors() [16]Color {
+	colors := window.customColors
+	for i, button := range window.customColorButtons {
+		colors[i] = button.GetColor()
+	}
+	return colors
+}
+
+// SetCustomColors replaces the custom colors, ribbon buttons holding the empty custom
+// color stay disabled
+func (window *MainWindow) SetCustomColors(colors [16]Color) {
+	window.customColors = colors
+	empty := Rgb(245, 245, 245)
+	for i, button := range window.customColorButtons {
+		button.SetColor(colors[i])
+		button.SetEnabled(!colors[i].IsEqualTo(&empty))
+	}
+	window.ribbon.Repaint()
+}
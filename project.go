@@ -0,0 +1,124 @@
+package main
+
+import (
+	"gopaint/format"
+	"gopaint/raster"
+	. "gopaint/reza"
+	"image"
+	"strings"
+)
+
+// NewProject captures the document of the canvas together with the editor settings
+func (canvas *DrawingCanvas) NewProject() *format.Project {
+	size := canvas.image.Bounds().Size()
+	project := format.NewProject(size.X, size.Y)
+	for i := 0; i < canvas.layers.Count(); i++ {
+		layer := canvas.layers.Get(i)
+		project.Layers = append(project.Layers, &format.ProjectLayer{
+			Name:       layer.Name,
+			Opacity:    layer.Opacity,
+			Visible:    layer.Visible,
+			Locked:     layer.Locked,
+			Blend:      layer.Blend.String(),
+			Background: layer.Background,
+			Pixels:     &layer.surface.BGRA,
+		})
+	}
+	project.ActiveLayer = canvas.layers.ActiveIndex()
+
+	window := mainWindow
+	tools := window.tools
+	project.Tool.Tool = tools.GetToolName(tools.GetCurrentTool())
+	for name, tool := range tools.namedTools() {
+		if size := tool.getSize(); size > 0 {
+			project.Tool.Sizes[name] = size
+		}
+	}
+	project.Tool.Outline = window.menuSolidOutline.IsToggled()
+	project.Tool.Fill = window.menuSolidFill.IsToggled()
+	color1, color2 := window.color1.GetColor(), window.color2.GetColor()
+	project.Color1 = format.FormatHexColor(color1.AsNRGBA())
+	project.Color2 = format.FormatHexColor(color2.AsNRGBA())
+	for _, c := range window.GetCustomColors() {
+		project.CustomColors = append(project.CustomColors, format.FormatHexColor(c.AsNRGBA()))
+	}
+	project.ShowGrid = window.bShowGridlines.IsToggled()
+	if selectTool := tools.toolSelect; selectTool.selected && selectTool.mask != nil {
+		mask := selectTool.mask
+		project.Selection = &format.ProjectSelection{
+			X:           mask.Rect.Min.X,
+			Y:           mask.Rect.Min.Y,
+			Width:       mask.Rect.Dx(),
+			Height:      mask.Rect.Dy(),
+			Rectangular: selectTool.rectangular,
+			Pixels:      mask,
+		}
+	}
+	return project
+}
+
+// projectLayers builds the layer stack of a project
+func projectLayers(project *format.Project) *LayerStack {
+	layers := NewLayerStack()
+	for i, projectLayer := range project.Layers {
+		layer := NewLayer(projectLayer.Name, project.Width, project.Height)
+		layer.Opacity = projectLayer.Opacity
+		layer.Visible = projectLayer.Visible
+		layer.Locked = projectLayer.Locked
+		layer.Blend, _ = raster.ParseBlendMode(projectLayer.Blend)
+		layer.Background = projectLayer.Background
+		raster.CopyRect(&layer.surface.BGRA, projectLayer.Pixels, layer.surface.Rect)
+		layers.Insert(i, layer)
+	}
+	layers.SetActive(project.ActiveLayer)
+	return layers
+}
+
+// applyProjectSettings restores the editor settings stored with a project, settings
+// that can't be read keep their current value
+func (window *MainWindow) applyProjectSettings(project *format.Project) {
+	tools := window.tools
+	for name, size := range project.Tool.Sizes {
+		if tool := tools.FindTool(name); tool != nil && size > 0 {
+			tool.changeSize(size)
+		}
+	}
+	window.menuSolidOutline.SetToggled(project.Tool.Outline)
+	window.menuNoOutline.SetToggled(!project.Tool.Outline)
+	window.menuSolidFill.SetToggled(project.Tool.Fill)
+	window.menuNoFill.SetToggled(!project.Tool.Fill)
+
+	parseColor := func(s string, c *Color) {
+		if value, err := format.ParseHexColor(s); err == nil {
+			*c = Rgba(value.R, value.G, value.B, value.A)
+		}
+	}
+	color1, color2 := window.color1.GetColor(), window.color2.GetColor()
+	parseColor(project.Color1, &color1)
+	parseColor(project.Color2, &color2)
+	window.color1.SetColor(color1)
+	window.color2.SetColor(color2)
+	customColors := window.GetCustomColors()
+	for i, s := range project.CustomColors {
+		if i < len(customColors) {
+			parseColor(s, &customColors[i])
+		}
+	}
+	window.SetCustomColors(customColors)
+	window.bShowGridlines.SetToggled(project.ShowGrid)
+
+	if tool := tools.FindTool(strings.ToLower(project.Tool.Tool)); tool != nil {
+		if tool == tools.GetCurrentTool() {
+			// Refresh the size menu with the restored sizes
+			tool.prepare()
+		} else {
+			window.SetCurrentTool(tool)
+		}
+	}
+	if selection := project.Selection; selection != nil && selection.Pixels != nil {
+		canvasRect := image.Rect(0, 0, project.Width, project.Height)
+		mask := selection.Pixels.SubImage(canvasRect).(*image.Alpha)
+		tools.toolSelect.setMask(mask, selection.Rectangular)
+		tools.toolSelect.updateStatus()
+	}
+}
@@ -0,0 +1,70 @@
+package raster
+
+import (
+	"image"
+)
+
+// Clip is a piece of an image cut out along a mask, what the clipboard holds. The
+// image and the mask have the same bounds with their origin at (0, 0), the pixels are
+// whole and the mask tells how much of each one belongs to the clip
+type Clip struct {
+	Image *BGRA
+	Mask  *image.Alpha
+}
+
+// NewClip copies the pixels of p within the bounds of the mask along with the mask
+func NewClip(p *BGRA, mask *image.Alpha) *Clip {
+	rect := MaskBounds(mask).Intersect(p.Rect)
+	clip := &Clip{
+		Image: Crop(p, rect),
+		Mask:  image.NewAlpha(image.Rect(0, 0, rect.Dx(), rect.Dy())),
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := mask.PixOffset(rect.Min.X, y)
+		copy(clip.Mask.Pix[(y-rect.Min.Y)*clip.Mask.Stride:], mask.Pix[i:i+rect.Dx()])
+	}
+	return clip
+}
+
+// NewImageClip returns a clip holding a copy of the whole image
+func NewImageClip(p *BGRA) *Clip {
+	img := Crop(p, p.Rect)
+	return &Clip{Image: img, Mask: RectMask(img.Rect)}
+}
+
+// Empty tells whether the clip has no pixels
+func (clip *Clip) Empty() bool {
+	return clip.Image.Rect.Empty()
+}
+
+// Placed returns the image and the mask of the clip moved so that their top left
+// corner is at pt, they share the pixels of the clip
+func (clip *Clip) Placed(pt image.Point) (*BGRA, *image.Alpha) {
+	img := *clip.Image
+	img.Rect = img.Rect.Add(pt)
+	mask := *clip.Mask
+	mask.Rect = mask.Rect.Add(pt)
+	return &img, &mask
+}
+
+// Turned returns the clip turned or flipped by one of the lossless transforms like
+// RotateRight, the mask goes through it as the alpha of an image
+func (clip *Clip) Turned(turn func(src *BGRA) *BGRA) *Clip {
+	rect := clip.Mask.Rect
+	coverage := NewBGRA(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := clip.Mask.PixOffset(rect.Min.X, y)
+		j := coverage.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			coverage.Pix[j+3] = clip.Mask.Pix[i]
+			i++
+			j += 4
+		}
+	}
+	coverage = turn(coverage)
+	mask := image.NewAlpha(coverage.Rect)
+	for i := range mask.Pix {
+		mask.Pix[i] = coverage.Pix[4*i+3]
+	}
+	return &Clip{Image: turn(clip.Image), Mask: mask}
+}
@@ -0,0 +1,21 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestClipKeepsPixelsWhole(t *testing.T) {
+	p := solidImage(2, 1, color.NRGBA{255, 0, 0, 255})
+	mask := image.NewAlpha(p.Rect)
+	mask.Pix[0], mask.Pix[1] = 255, 128
+	// Pasting the clip onto transparency scales the half covered pixel only once
+	clip := NewClip(p, mask)
+	dst := NewBGRA(p.Rect)
+	img, placed := clip.Placed(image.Pt(0, 0))
+	PaintMask(dst, placed, &Pattern{Image: img})
+	if got := dst.RGBAAt(1, 0); !near(got, color.RGBA{128, 0, 0, 128}) {
+		t.Errorf("half covered pixel pasted as %v, want half of red", got)
+	}
+}
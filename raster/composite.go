@@ -0,0 +1,134 @@
+package raster
+
+import (
+	"image"
+	"strings"
+)
+
+// BlendMode defines how a layer gets mixed with the layers below it
+type BlendMode int
+
+const (
+	BlendNormal BlendMode = iota
+	BlendMultiply
+	BlendScreen
+	BlendOverlay
+	BlendDarken
+	BlendLighten
+)
+
+var blendModeNames = []string{"Normal", "Multiply", "Screen", "Overlay", "Darken", "Lighten"}
+
+func (mode BlendMode) String() string {
+	if int(mode) >= 0 && int(mode) < len(blendModeNames) {
+		return blendModeNames[mode]
+	}
+	return "Unknown"
+}
+
+func GetBlendModeCount() int {
+	return len(blendModeNames)
+}
+
+// ParseBlendMode finds the blend mode with the given name, the name is not case sensitive
+func ParseBlendMode(name string) (BlendMode, bool) {
+	for i, modeName := range blendModeNames {
+		if strings.EqualFold(modeName, name) {
+			return BlendMode(i), true
+		}
+	}
+	return BlendNormal, false
+}
+
+// Composite blends the premultiplied src over dst inside rect. Both images must share
+// the same coordinate space. An opaque source has its alpha channel ignored
+func Composite(dst, src *BGRA, rect image.Rectangle, opacity uint8, mode BlendMode, opaque bool) {
+	rect = rect.Intersect(dst.Rect).Intersect(src.Rect)
+	o := uint32(opacity)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		di := dst.PixOffset(rect.Min.X, y)
+		si := src.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			sa := uint32(src.Pix[si+3])
+			if opaque {
+				sa = 255
+			}
+			// Apply the layer opacity on the premultiplied source
+			sb := uint32(src.Pix[si+0]) * o / 255
+			sg := uint32(src.Pix[si+1]) * o / 255
+			sr := uint32(src.Pix[si+2]) * o / 255
+			sa = sa * o / 255
+			if sa != 0 {
+				if mode == BlendNormal {
+					inv := 255 - sa
+					dst.Pix[di+0] = uint8(sb + uint32(dst.Pix[di+0])*inv/255)
+					dst.Pix[di+1] = uint8(sg + uint32(dst.Pix[di+1])*inv/255)
+					dst.Pix[di+2] = uint8(sr + uint32(dst.Pix[di+2])*inv/255)
+					dst.Pix[di+3] = uint8(sa + uint32(dst.Pix[di+3])*inv/255)
+				} else {
+					blendPixel(dst.Pix[di:di+4], sb, sg, sr, sa, mode)
+				}
+			}
+			di += 4
+			si += 4
+		}
+	}
+}
+
+// blendPixel mixes a premultiplied source pixel into the destination pixel using the
+// separable blend formula: Co = Cs*(1-ab) + Cb*(1-as) + as*ab*B(cb, cs)
+func blendPixel(d []uint8, sb, sg, sr, sa uint32, mode BlendMode) {
+	as := float32(sa) / 255
+	ab := float32(d[3]) / 255
+	source := [3]uint32{sb, sg, sr}
+	for c := 0; c < 3; c++ {
+		Cs := float32(source[c]) / 255
+		Cb := float32(d[c]) / 255
+		cs, cb := float32(0), float32(0)
+		if as > 0 {
+			cs = Cs / as
+		}
+		if ab > 0 {
+			cb = Cb / ab
+		}
+		co := Cs*(1-ab) + Cb*(1-as) + as*ab*blendChannel(cb, cs, mode)
+		d[c] = clampToByte(co * 255)
+	}
+	d[3] = clampToByte((as + ab - as*ab) * 255)
+}
+
+// blendChannel is the blend function B(cb, cs) with non-premultiplied values in [0, 1]
+func blendChannel(cb, cs float32, mode BlendMode) float32 {
+	switch mode {
+	case BlendMultiply:
+		return cb * cs
+	case BlendScreen:
+		return cb + cs - cb*cs
+	case BlendOverlay:
+		if cb <= 0.5 {
+			return 2 * cb * cs
+		}
+		return 1 - 2*(1-cb)*(1-cs)
+	case BlendDarken:
+		if cb < cs {
+			return cb
+		}
+		return cs
+	case BlendLighten:
+		if cb > cs {
+			return cb
+		}
+		return cs
+	}
+	return cs
+}
+
+func clampToByte(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
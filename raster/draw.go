@@ -0,0 +1,166 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// shape collects the pixels of a shape first so every pixel gets painted only once,
+// otherwise overlapping spans would build up semi-transparent colors
+type shape struct {
+	rect   image.Rectangle
+	pixels []bool
+}
+
+func newShape(rect image.Rectangle) *shape {
+	return &shape{rect: rect, pixels: make([]bool, rect.Dx()*rect.Dy())}
+}
+
+// pointsBounds returns the rectangle holding all the points
+func pointsBounds(points []image.Point) image.Rectangle {
+	if len(points) == 0 {
+		return image.Rectangle{}
+	}
+	rect := image.Rectangle{Min: points[0], Max: points[0].Add(image.Pt(1, 1))}
+	for _, pt := range points[1:] {
+		rect = rect.Union(image.Rectangle{Min: pt, Max: pt.Add(image.Pt(1, 1))})
+	}
+	return rect
+}
+
+func (s *shape) set(x, y int) {
+	if (image.Point{x, y}).In(s.rect) {
+		s.pixels[(y-s.rect.Min.Y)*s.rect.Dx()+(x-s.rect.Min.X)] = true
+	}
+}
+
+func (s *shape) setSpan(y, x0, x1 int) {
+	for x := x0; x < x1; x++ {
+		s.set(x, y)
+	}
+}
+
+func (s *shape) paint(dst *BGRA, c color.NRGBA) {
+	pc := Premultiply(c)
+	if pc.A == 0 {
+		return
+	}
+	rect := s.rect.Intersect(dst.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := (y - s.rect.Min.Y) * s.rect.Dx()
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if s.pixels[row+x-s.rect.Min.X] {
+				blendOver(dst, dst.PixOffset(x, y), pc)
+			}
+		}
+	}
+}
+
+// ellipseSpans calls span for every row of the ellipse that fits into rect with the
+// range of pixels whose centers are inside the ellipse
+func ellipseSpans(rect image.Rectangle, span func(y, x0, x1 int)) {
+	rx := float64(rect.Dx()) / 2
+	ry := float64(rect.Dy()) / 2
+	if rx <= 0 || ry <= 0 {
+		return
+	}
+	cx := float64(rect.Min.X) + rx
+	cy := float64(rect.Min.Y) + ry
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		fy := (float64(y) + 0.5 - cy) / ry
+		if fy*fy > 1 {
+			continue
+		}
+		half := rx * math.Sqrt(1-fy*fy)
+		x0 := int(math.Ceil(cx - half - 0.5))
+		x1 := int(math.Floor(cx + half - 0.5))
+		if x1 >= x0 {
+			span(y, x0, x1+1)
+		}
+	}
+}
+
+// FillEllipse fills the ellipse that fits into rect
+func FillEllipse(dst *BGRA, rect image.Rectangle, c color.NRGBA) {
+	s := newShape(rect.Intersect(dst.Rect))
+	ellipseSpans(rect, s.setSpan)
+	s.paint(dst, c)
+}
+
+// FillRoundRect fills the rectangle with its corners rounded by the given radius
+func FillRoundRect(dst *BGRA, rect image.Rectangle, radius int, c color.NRGBA) {
+	s := newShape(rect.Intersect(dst.Rect))
+	r := float64(minInt(radius, minInt(rect.Dx(), rect.Dy())/2))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		fy := float64(y) + 0.5
+		dy := 0.0
+		if top := float64(rect.Min.Y) + r; fy < top {
+			dy = top - fy
+		} else if bottom := float64(rect.Max.Y) - r; fy > bottom {
+			dy = fy - bottom
+		}
+		inset := int(math.Round(r - math.Sqrt(math.Max(0, r*r-dy*dy))))
+		s.setSpan(y, rect.Min.X+inset, rect.Max.X-inset)
+	}
+	s.paint(dst, c)
+}
+
+// PolygonSpans calls span for every row of the polygon with the ranges of pixels whose
+// centers are inside it (even-odd rule). The polygon is clipped to the given rectangle
+func PolygonSpans(points []image.Point, clip image.Rectangle, span func(y, x0, x1 int)) {
+	if len(points) < 3 {
+		return
+	}
+	minY, maxY := points[0].Y, points[0].Y
+	for _, pt := range points {
+		if pt.Y < minY {
+			minY = pt.Y
+		}
+		if pt.Y > maxY {
+			maxY = pt.Y
+		}
+	}
+	if minY < clip.Min.Y {
+		minY = clip.Min.Y
+	}
+	if maxY > clip.Max.Y {
+		maxY = clip.Max.Y
+	}
+	crossings := make([]float64, 0, len(points))
+	for y := minY; y < maxY; y++ {
+		fy := float64(y) + 0.5
+		crossings = crossings[:0]
+		for i := range points {
+			p0 := points[i]
+			p1 := points[(i+1)%len(points)]
+			y0, y1 := float64(p0.Y), float64(p1.Y)
+			if (y0 <= fy && y1 > fy) || (y1 <= fy && y0 > fy) {
+				t := (fy - y0) / (y1 - y0)
+				crossings = append(crossings, float64(p0.X)+t*float64(p1.X-p0.X))
+			}
+		}
+		sort.Float64s(crossings)
+		for i := 0; i+1 < len(crossings); i += 2 {
+			x0 := int(math.Ceil(crossings[i] - 0.5))
+			x1 := int(math.Ceil(crossings[i+1] - 0.5))
+			if x0 < clip.Min.X {
+				x0 = clip.Min.X
+			}
+			if x1 > clip.Max.X {
+				x1 = clip.Max.X
+			}
+			if x1 > x0 {
+				span(y, x0, x1)
+			}
+		}
+	}
+}
+
+// FillPolygon fills the polygon given by its corner points
+func FillPolygon(dst *BGRA, points []image.Point, c color.NRGBA) {
+	s := newShape(pointsBounds(points).Intersect(dst.Rect))
+	PolygonSpans(points, dst.Rect, s.setSpan)
+	s.paint(dst, c)
+}
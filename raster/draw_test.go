@@ -0,0 +1,120 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// drawnRegion returns the alpha of the pixels as a mask to compare with checkRegion
+func drawnRegion(p *BGRA) *image.Alpha {
+	region := image.NewAlpha(p.Rect)
+	for i := range region.Pix {
+		region.Pix[i] = p.Pix[4*i+3]
+	}
+	return region
+}
+
+func TestFillShapes(t *testing.T) {
+	black := color.NRGBA{0, 0, 0, 255}
+	tests := []struct {
+		name string
+		fill func(p *BGRA)
+		want []string
+	}{
+		{"ellipse", func(p *BGRA) { FillEllipse(p, image.Rect(0, 0, 7, 5), black) }, []string{
+			".xxxxx.",
+			"xxxxxxx",
+			"xxxxxxx",
+			"xxxxxxx",
+			".xxxxx.",
+		}},
+		{"ellipse at the edge", func(p *BGRA) { FillEllipse(p, image.Rect(-3, -2, 4, 3), black) }, []string{
+			"xxxx...",
+			"xxxx...",
+			"xxx....",
+			".......",
+			".......",
+		}},
+		{"1px ellipse", func(p *BGRA) { FillEllipse(p, image.Rect(3, 0, 4, 5), black) }, []string{
+			"...x...",
+			"...x...",
+			"...x...",
+			"...x...",
+			"...x...",
+		}},
+		{"round rect", func(p *BGRA) { FillRoundRect(p, image.Rect(0, 0, 7, 5), 2, black) }, []string{
+			".xxxxx.",
+			"xxxxxxx",
+			"xxxxxxx",
+			"xxxxxxx",
+			".xxxxx.",
+		}},
+		{"round rect at the edge", func(p *BGRA) { FillRoundRect(p, image.Rect(4, 2, 10, 8), 2, black) }, []string{
+			".......",
+			".......",
+			".....xx",
+			"....xxx",
+			"....xxx",
+		}},
+		{"1px round rect", func(p *BGRA) { FillRoundRect(p, image.Rect(1, 1, 2, 4), 2, black) }, []string{
+			".......",
+			".x.....",
+			".x.....",
+			".x.....",
+			".......",
+		}},
+		{"rectangle polygon", func(p *BGRA) {
+			FillPolygon(p, []image.Point{{1, 1}, {5, 1}, {5, 4}, {1, 4}}, black)
+		}, []string{
+			".......",
+			".xxxx..",
+			".xxxx..",
+			".xxxx..",
+			".......",
+		}},
+		{"triangle", func(p *BGRA) {
+			FillPolygon(p, []image.Point{{0, 0}, {7, 0}, {0, 5}}, black)
+		}, []string{
+			"xxxxxx.",
+			"xxxxx..",
+			"xxx....",
+			"xx.....",
+			"x......",
+		}},
+		{"polygon at the edge", func(p *BGRA) {
+			FillPolygon(p, []image.Point{{-4, -4}, {3, -4}, {3, 2}, {-4, 2}}, black)
+		}, []string{
+			"xxx....",
+			"xxx....",
+			".......",
+			".......",
+			".......",
+		}},
+		{"1px polygon", func(p *BGRA) {
+			FillPolygon(p, []image.Point{{2, 0}, {3, 0}, {3, 5}, {2, 5}}, black)
+		}, []string{
+			"..x....",
+			"..x....",
+			"..x....",
+			"..x....",
+			"..x....",
+		}},
+		{"outside", func(p *BGRA) {
+			FillEllipse(p, image.Rect(-9, 0, -2, 5), black)
+			FillRoundRect(p, image.Rect(7, 5, 12, 9), 2, black)
+			FillPolygon(p, []image.Point{{0, -5}, {7, -5}, {3, -1}}, black)
+		}, []string{
+			".......",
+			".......",
+			".......",
+			".......",
+			".......",
+		}},
+	}
+	for _, test := range tests {
+		p := NewBGRA(image.Rect(0, 0, 7, 5))
+		test.fill(p)
+		checkRegion(t, test.name, drawnRegion(p), test.want...)
+	}
+}
@@ -0,0 +1,66 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+)
+
+// Floating holds the pixels of a selection lifted off a layer or pasted from the
+// clipboard until they get dropped into a layer. The pixels are kept whole, the
+// selection mask tells how much of each one floats, so it only gets applied once
+type Floating struct {
+	Image *BGRA
+	// Whether the pixels came from the clipboard, the layer didn't change for them then
+	Pasted bool
+}
+
+// LiftFloating copies the pixels of p within the bounds of the mask into a floating
+// selection and erases the ones the mask covers with the hole color, partly covered
+// ones only partly. The part of the mask outside of p floats transparent pixels
+func LiftFloating(p *BGRA, mask *image.Alpha, hole color.NRGBA) *Floating {
+	floating := &Floating{Image: copyPlaced(p, mask.Rect)}
+	PaintMask(p, mask, NewSolidPaint(hole))
+	return floating
+}
+
+// PasteFloating makes the clip a floating selection with its top left corner at pt,
+// the mask it floats through is returned along with it and shares the clip's pixels
+func PasteFloating(clip *Clip, pt image.Point) (*Floating, *image.Alpha) {
+	pixels, mask := clip.Placed(pt)
+	return &Floating{Image: copyPlaced(pixels, pixels.Rect), Pasted: true}, mask
+}
+
+// Move moves the floating pixels by the offset
+func (floating *Floating) Move(offset image.Point) {
+	floating.Image.Rect = floating.Image.Rect.Add(offset)
+}
+
+// Shown returns the floating pixels as they look above the layer, scaled by the mask
+func (floating *Floating) Shown(mask *image.Alpha) *BGRA {
+	shown := copyPlaced(floating.Image, floating.Image.Rect)
+	ApplyMask(shown, mask)
+	return shown
+}
+
+// Drop paints the floating pixels into p through the mask
+func (floating *Floating) Drop(p *BGRA, mask *image.Alpha) {
+	PaintMask(p, mask, &Pattern{Image: floating.Image, Origin: floating.Image.Rect.Min})
+}
+
+// UndoFloating discards the floating selection without dropping it and undoes the
+// edit before it. A pasted selection is all there is to undo, the layer didn't change
+// for it. True if the history changed
+func UndoFloating(history *History, floating *Floating) bool {
+	if floating != nil && floating.Pasted {
+		return false
+	}
+	return history.Undo()
+}
+
+// copyPlaced returns a copy of the rectangle of p that keeps its place, what isn't
+// inside p is transparent
+func copyPlaced(p *BGRA, rect image.Rectangle) *BGRA {
+	dst := NewBGRA(rect)
+	CopyRect(dst, p, rect)
+	return dst
+}
@@ -0,0 +1,96 @@
+package raster
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFloatingDropKeepsCoverage(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	img := solidImage(4, 1, red)
+	mask := image.NewAlpha(image.Rect(0, 0, 2, 1))
+	mask.Pix[0], mask.Pix[1] = 255, 128
+	floating := LiftFloating(img, mask, color.NRGBA{})
+	if got := img.RGBAAt(1, 0); !near(got, color.RGBA{127, 0, 0, 127}) {
+		t.Errorf("half selected pixel left %v behind", got)
+	}
+
+	// Moved onto the other two pixels made transparent, the half selected one comes
+	// out half covered and not a quarter
+	Fill(img, image.Rect(2, 0, 4, 1), color.NRGBA{})
+	floating.Move(image.Pt(2, 0))
+	mask.Rect = mask.Rect.Add(image.Pt(2, 0))
+	floating.Drop(img, mask)
+	if got := img.RGBAAt(2, 0); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("fully selected pixel dropped as %v", got)
+	}
+	if got := img.RGBAAt(3, 0); !near(got, color.RGBA{128, 0, 0, 128}) {
+		t.Errorf("half selected pixel dropped as %v, want half of red", got)
+	}
+	if got := floating.Shown(mask).RGBAAt(3, 0); !near(got, color.RGBA{128, 0, 0, 128}) {
+		t.Errorf("half selected pixel shown as %v, want half of red", got)
+	}
+}
+
+func TestFloatingLiftOutside(t *testing.T) {
+	img := solidImage(2, 2, color.NRGBA{0, 0, 255, 255})
+	floating := LiftFloating(img, RectMask(image.Rect(1, 1, 3, 3)), color.NRGBA{})
+	if floating.Image.Rect != image.Rect(1, 1, 3, 3) {
+		t.Fatalf("floating pixels at %v, want the bounds of the mask", floating.Image.Rect)
+	}
+	if got := floating.Image.RGBAAt(2, 2); got != (color.RGBA{}) {
+		t.Errorf("pixel outside of the image floats as %v", got)
+	}
+	if got := floating.Image.RGBAAt(1, 1); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("lifted pixel is %v", got)
+	}
+}
+
+func TestFloatingCutPasteUndo(t *testing.T) {
+	history := NewHistory(1 << 20)
+	img := solidImage(6, 4, color.NRGBA{255, 255, 255, 255})
+	edit(t, history, img, func() { Fill(img, image.Rect(0, 0, 2, 2), color.NRGBA{0, 0, 255, 255}) })
+	painted := cloneImage(img)
+
+	// Cut the blue square, the clipboard gets the pixels and the layer the hole
+	mask := RectMask(image.Rect(0, 0, 2, 2))
+	clip := NewClip(img, mask)
+	edit(t, history, img, func() { PaintMask(img, mask, NewSolidPaint(color.NRGBA{})) })
+	cut := cloneImage(img)
+
+	// Undo right after pasting only drops the pasted pixels
+	floating, pastedMask := PasteFloating(clip, image.Pt(3, 1))
+	if !floating.Pasted || floating.Image.Rect != image.Rect(3, 1, 5, 3) || pastedMask.Rect != floating.Image.Rect {
+		t.Fatalf("pasted at %v with the mask at %v", floating.Image.Rect, pastedMask.Rect)
+	}
+	if UndoFloating(history, floating) {
+		t.Error("undoing the paste undid an edit of the layer")
+	}
+	if !bytes.Equal(img.Pix, cut.Pix) {
+		t.Fatal("undoing the paste changed the layer")
+	}
+	if !UndoFloating(history, nil) || !bytes.Equal(img.Pix, painted.Pix) {
+		t.Fatal("the next undo doesn't bring back the cut pixels")
+	}
+
+	// A dropped paste is an edit of its own
+	history.Redo()
+	floating, pastedMask = PasteFloating(clip, image.Pt(3, 1))
+	edit(t, history, img, func() { floating.Drop(img, pastedMask) })
+	if got := img.RGBAAt(4, 2); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("dropped pixel is %v", got)
+	}
+	if !history.Undo() || !bytes.Equal(img.Pix, cut.Pix) {
+		t.Error("undo doesn't take back just the dropped paste")
+	}
+
+	// Undo with a lifted selection brings back the pixels it was lifted from
+	moved := RectMask(image.Rect(3, 0, 5, 2))
+	var lifted *Floating
+	edit(t, history, img, func() { lifted = LiftFloating(img, moved, color.NRGBA{}) })
+	if !UndoFloating(history, lifted) || !bytes.Equal(img.Pix, cut.Pix) {
+		t.Error("undo with a lifted selection doesn't fill its hole again")
+	}
+}
@@ -0,0 +1,268 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+)
+
+// FloodOptions controls which pixels a flood fill reaches
+type FloodOptions struct {
+	// Largest difference of any channel to the color at the starting point that still
+	// counts as the same color, 0 only takes the exact color and 255 takes everything
+	Tolerance int
+	// Spread to the diagonal neighbours too, not only left, right, up and down
+	Diagonal bool
+	// Take every matching pixel of the image, connected to the starting point or not
+	Global bool
+	// Don't leak through breaks of the outline up to this many pixels wide
+	GapSize int
+	// Partly cover the pixels around the area by how similar they are, so the fill
+	// blends into anti-aliased outlines instead of leaving a halo
+	Antialias bool
+}
+
+// colorDistance returns the largest difference between the channels of the pixel at
+// offset i and the (premultiplied) color
+func colorDistance(p *BGRA, i int, c color.RGBA) int {
+	distance := 0
+	for channel, value := range [4]uint8{c.B, c.G, c.R, c.A} {
+		d := int(p.Pix[i+channel]) - int(value)
+		if d < 0 {
+			d = -d
+		}
+		if d > distance {
+			distance = d
+		}
+	}
+	return distance
+}
+
+// FloodRegion returns the mask of the pixels a flood fill starting at (x, y) covers,
+// 255 for the covered pixels, 0 for the rest and anything between for the anti-aliased
+// edges. It uses the scanline algorithm with an explicit stack so big areas don't blow
+// the goroutine stack
+func FloodRegion(p *BGRA, x, y int, options FloodOptions) *image.Alpha {
+	region := image.NewAlpha(p.Rect)
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return region
+	}
+	seed := p.RGBAAt(x, y)
+	similar := func(x, y int) bool {
+		return colorDistance(p, p.PixOffset(x, y), seed) <= options.Tolerance
+	}
+	if options.Global {
+		markSimilar(region, p, seed, options.Tolerance)
+	} else {
+		fillable := similar
+		grow := 0
+		if options.GapSize > 0 {
+			// Thicken the outline until the gaps are closed, fill what is left and grow
+			// the area back by the same amount so it reaches the outline again
+			radius := (options.GapSize + 1) / 2
+			blocked := thickenOutline(p, similar, radius)
+			index := func(x, y int) int {
+				return (y-p.Rect.Min.Y)*p.Rect.Dx() + x - p.Rect.Min.X
+			}
+			// Clicking into a spot narrower than a gap fills it the normal way
+			if !blocked[index(x, y)] {
+				fillable = func(x, y int) bool {
+					return !blocked[index(x, y)]
+				}
+				grow = radius
+			}
+		}
+		scanlineFill(region, x, y, fillable, options.Diagonal)
+		// The outline got thickened as a square, so the area grows back the same way
+		growRegion(region, similar, grow, true)
+	}
+	if options.Antialias {
+		antialiasEdges(p, region, seed, options.Tolerance)
+	}
+	return region
+}
+
+// ColorRegion returns the mask of all the pixels of p within the tolerance of the (straight
+// alpha) color
+func ColorRegion(p *BGRA, c color.NRGBA, tolerance int) *image.Alpha {
+	region := image.NewAlpha(p.Rect)
+	markSimilar(region, p, Premultiply(c), tolerance)
+	return region
+}
+
+// markSimilar sets the pixels of the region whose color is within the tolerance of c
+func markSimilar(region *image.Alpha, p *BGRA, c color.RGBA, tolerance int) {
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		i := p.PixOffset(p.Rect.Min.X, y)
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			if colorDistance(p, i, c) <= tolerance {
+				region.Pix[region.PixOffset(x, y)] = 255
+			}
+			i += 4
+		}
+	}
+}
+
+// scanlineFill sets the pixels of the region connected to (x, y) for which fillable is true
+func scanlineFill(region *image.Alpha, x, y int, fillable func(x, y int) bool, diagonal bool) {
+	// A pixel matches once, the mask doubles as the visited set
+	matches := func(x, y int) bool {
+		return region.Pix[region.PixOffset(x, y)] == 0 && fillable(x, y)
+	}
+	minX, maxX := region.Rect.Min.X, region.Rect.Max.X
+	minY, maxY := region.Rect.Min.Y, region.Rect.Max.Y
+	stack := []image.Point{{x, y}}
+	for len(stack) > 0 {
+		pt := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !matches(pt.X, pt.Y) {
+			continue
+		}
+		x0, x1 := pt.X, pt.X+1
+		for x0 > minX && matches(x0-1, pt.Y) {
+			x0--
+		}
+		for x1 < maxX && matches(x1, pt.Y) {
+			x1++
+		}
+		i := region.PixOffset(x0, pt.Y)
+		for x := x0; x < x1; x++ {
+			region.Pix[i] = 255
+			i++
+		}
+		// Diagonal neighbours of the span reach one pixel further on both sides
+		if diagonal {
+			x0 = maxInt(x0-1, minX)
+			x1 = minInt(x1+1, maxX)
+		}
+		for _, ny := range [2]int{pt.Y - 1, pt.Y + 1} {
+			if ny < minY || ny >= maxY {
+				continue
+			}
+			inSpan := false
+			for x := x0; x < x1; x++ {
+				match := matches(x, ny)
+				if match && !inSpan {
+					stack = append(stack, image.Point{x, ny})
+				}
+				inSpan = match
+			}
+		}
+	}
+}
+
+// thickenOutline returns which pixels are within radius (as a square) of a pixel that
+// isn't similar, row after row
+func thickenOutline(p *BGRA, similar func(x, y int) bool, radius int) []bool {
+	width, height := p.Rect.Dx(), p.Rect.Dy()
+	blocked := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			blocked[y*width+x] = !similar(x+p.Rect.Min.X, y+p.Rect.Min.Y)
+		}
+	}
+	// Growing a square is growing rows and then columns, a sliding count of the
+	// outline pixels in the window tells whether a pixel gets covered
+	dilate := func(start, step, count int) {
+		line := make([]bool, count)
+		for i := range line {
+			line[i] = blocked[start+i*step]
+		}
+		inWindow := 0
+		for i := 0; i < minInt(radius, count); i++ {
+			if line[i] {
+				inWindow++
+			}
+		}
+		for i := 0; i < count; i++ {
+			if i+radius < count && line[i+radius] {
+				inWindow++
+			}
+			if i-radius-1 >= 0 && line[i-radius-1] {
+				inWindow--
+			}
+			blocked[start+i*step] = inWindow > 0
+		}
+	}
+	for y := 0; y < height; y++ {
+		dilate(y*width, 1, width)
+	}
+	for x := 0; x < width; x++ {
+		dilate(x, width, height)
+	}
+	return blocked
+}
+
+// growRegion adds the similar pixels touching the region, as many times as asked
+func growRegion(region *image.Alpha, similar func(x, y int) bool, times int, diagonal bool) {
+	rect := region.Rect
+	for ; times > 0; times-- {
+		var added []int
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				i := region.PixOffset(x, y)
+				if region.Pix[i] == 0 && touchesRegion(region, x, y, diagonal) && similar(x, y) {
+					added = append(added, i)
+				}
+			}
+		}
+		if len(added) == 0 {
+			return
+		}
+		for _, i := range added {
+			region.Pix[i] = 255
+		}
+	}
+}
+
+// touchesRegion tells whether a neighbour of (x, y) is fully covered by the region
+func touchesRegion(region *image.Alpha, x, y int, diagonal bool) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if (dx == 0 && dy == 0) || (!diagonal && dx != 0 && dy != 0) {
+				continue
+			}
+			pt := image.Point{x + dx, y + dy}
+			if pt.In(region.Rect) && region.Pix[region.PixOffset(pt.X, pt.Y)] == 255 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// antialiasEdges partly covers the pixels around the region, the closer their color
+// is to the seed color the more they get covered
+func antialiasEdges(p *BGRA, region *image.Alpha, seed color.RGBA, tolerance int) {
+	if tolerance >= 255 {
+		return
+	}
+	var edges []int
+	var coverages []uint8
+	for y := region.Rect.Min.Y; y < region.Rect.Max.Y; y++ {
+		for x := region.Rect.Min.X; x < region.Rect.Max.X; x++ {
+			if region.Pix[region.PixOffset(x, y)] != 0 || !touchesRegion(region, x, y, true) {
+				continue
+			}
+			distance := colorDistance(p, p.PixOffset(x, y), seed)
+			coverage := (255 - distance) * 255 / (255 - tolerance)
+			if coverage > 0 {
+				edges = append(edges, region.PixOffset(x, y))
+				coverages = append(coverages, uint8(minInt(coverage, 254)))
+			}
+		}
+	}
+	for i, edge := range edges {
+		region.Pix[edge] = coverages[i]
+	}
+}
+
+// FillMask paints the (straight alpha) color into dst through the mask, see PaintMask
+func FillMask(dst *BGRA, mask *image.Alpha, c color.NRGBA) {
+	PaintMask(dst, mask, NewSolidPaint(c))
+}
+
+// FloodFill replaces the area of pixels around (x, y) that are similar to the pixel at
+// (x, y) with the new (straight alpha) color
+func FloodFill(p *BGRA, x, y int, newColor color.NRGBA, options FloodOptions) {
+	FillMask(p, FloodRegion(p, x, y, options), newColor)
+}
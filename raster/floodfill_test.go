@@ -0,0 +1,239 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Colors of the pixels in the test images
+var floodTestColors = map[byte]color.NRGBA{
+	'.': {255, 255, 255, 255},
+	'g': {240, 240, 240, 255},
+	'm': {128, 128, 128, 255},
+	'#': {0, 0, 0, 255},
+	' ': {},
+}
+
+// parseImage builds an image from rows of characters, one per pixel
+func parseImage(rows ...string) *BGRA {
+	p := NewBGRA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			Fill(p, image.Rect(x, y, x+1, y+1), floodTestColors[row[x]])
+		}
+	}
+	return p
+}
+
+// regionString draws the mask the way parseImage reads images, 'x' for covered pixels,
+// '+' for partly covered ones and '.' for the rest
+func regionString(region *image.Alpha) []string {
+	var rows []string
+	for y := region.Rect.Min.Y; y < region.Rect.Max.Y; y++ {
+		row := make([]byte, 0, region.Rect.Dx())
+		for x := region.Rect.Min.X; x < region.Rect.Max.X; x++ {
+			switch region.AlphaAt(x, y).A {
+			case 255:
+				row = append(row, 'x')
+			case 0:
+				row = append(row, '.')
+			default:
+				row = append(row, '+')
+			}
+		}
+		rows = append(rows, string(row))
+	}
+	return rows
+}
+
+func checkRegion(t *testing.T, name string, region *image.Alpha, want ...string) {
+	t.Helper()
+	got := regionString(region)
+	for y := range want {
+		if got[y] != want[y] {
+			t.Errorf("%s: region is\n%v\nwant\n%v", name, got, want)
+			return
+		}
+	}
+}
+
+func TestFloodTolerance(t *testing.T) {
+	p := parseImage(
+		"..gg#..",
+		"..gg#..",
+		"..gg#..",
+	)
+	checkRegion(t, "exact color", FloodRegion(p, 0, 0, FloodOptions{}),
+		"xx.....",
+		"xx.....",
+		"xx.....",
+	)
+	// 240 is 15 away from 255
+	checkRegion(t, "tolerance 15", FloodRegion(p, 0, 0, FloodOptions{Tolerance: 15}),
+		"xxxx...",
+		"xxxx...",
+		"xxxx...",
+	)
+	checkRegion(t, "tolerance 14", FloodRegion(p, 0, 0, FloodOptions{Tolerance: 14}),
+		"xx.....",
+		"xx.....",
+		"xx.....",
+	)
+	checkRegion(t, "tolerance 255", FloodRegion(p, 0, 0, FloodOptions{Tolerance: 255}),
+		"xxxxxxx",
+		"xxxxxxx",
+		"xxxxxxx",
+	)
+}
+
+func TestFloodDiagonal(t *testing.T) {
+	p := parseImage(
+		".#...",
+		"#.#..",
+		"##.##",
+		"...#.",
+	)
+	checkRegion(t, "4 neighbours", FloodRegion(p, 0, 0, FloodOptions{}),
+		"x....",
+		".....",
+		".....",
+		".....",
+	)
+	checkRegion(t, "8 neighbours", FloodRegion(p, 0, 0, FloodOptions{Diagonal: true}),
+		"x.xxx",
+		".x.xx",
+		"..x..",
+		"xxx..",
+	)
+}
+
+func TestFloodGlobal(t *testing.T) {
+	p := parseImage(
+		"..#..",
+		"..#..",
+		"###g#",
+		"..#..",
+	)
+	checkRegion(t, "contiguous", FloodRegion(p, 0, 0, FloodOptions{}),
+		"xx...",
+		"xx...",
+		".....",
+		".....",
+	)
+	checkRegion(t, "global", FloodRegion(p, 0, 0, FloodOptions{Global: true}),
+		"xx.xx",
+		"xx.xx",
+		".....",
+		"xx.xx",
+	)
+	checkRegion(t, "global with tolerance", FloodRegion(p, 0, 0, FloodOptions{Global: true, Tolerance: 20}),
+		"xx.xx",
+		"xx.xx",
+		"...x.",
+		"xx.xx",
+	)
+}
+
+func TestFloodGapClosing(t *testing.T) {
+	// A box with a two pixel wide break in its top side
+	p := parseImage(
+		"............",
+		"............",
+		"..###..###..",
+		"..#......#..",
+		"..#......#..",
+		"..#......#..",
+		"..#......#..",
+		"..#......#..",
+		"..#......#..",
+		"..########..",
+		"............",
+	)
+	region := FloodRegion(p, 5, 5, FloodOptions{})
+	if region.AlphaAt(0, 0).A != 255 {
+		t.Error("without gap closing the fill doesn't leak out of the box")
+	}
+	region = FloodRegion(p, 5, 5, FloodOptions{GapSize: 2})
+	checkRegion(t, "closing 2 pixel gaps", region,
+		"............",
+		"............",
+		"............",
+		"...xxxxxx...",
+		"...xxxxxx...",
+		"...xxxxxx...",
+		"...xxxxxx...",
+		"...xxxxxx...",
+		"...xxxxxx...",
+		"............",
+		"............",
+	)
+	// Gaps wider than asked for still leak
+	p = parseImage(
+		".........",
+		"..##...##",
+		"..#.....#",
+		"..#.....#",
+		"..#######",
+	)
+	region = FloodRegion(p, 5, 3, FloodOptions{GapSize: 2})
+	if region.AlphaAt(0, 0).A != 255 {
+		t.Error("closing 2 pixel gaps also closed a 3 pixel one")
+	}
+}
+
+func TestFloodGapClosingNarrowSpot(t *testing.T) {
+	// Clicking into a spot narrower than the gap size still fills it
+	p := parseImage(
+		"#####",
+		"#...#",
+		"#####",
+	)
+	checkRegion(t, "narrow spot", FloodRegion(p, 2, 1, FloodOptions{GapSize: 4}),
+		".....",
+		".xxx.",
+		".....",
+	)
+}
+
+func TestFloodAntialias(t *testing.T) {
+	p := parseImage(
+		"..m#",
+		"..m#",
+	)
+	checkRegion(t, "anti-aliased", FloodRegion(p, 0, 0, FloodOptions{Antialias: true}),
+		"xx+.",
+		"xx+.",
+	)
+	if a := FloodRegion(p, 0, 0, FloodOptions{Antialias: true}).AlphaAt(2, 0).A; a < 100 || a > 160 {
+		t.Errorf("a pixel halfway to the seed color is covered by %d, want about half", a)
+	}
+}
+
+func TestFloodOutside(t *testing.T) {
+	p := parseImage("..", "..")
+	if region := FloodRegion(p, 5, 0, FloodOptions{}); region.AlphaAt(0, 0).A != 0 {
+		t.Error("a flood starting outside of the image covered pixels")
+	}
+}
+
+func TestFloodFill(t *testing.T) {
+	p := parseImage(
+		" . ",
+		"...",
+		" . ",
+	)
+	red := color.NRGBA{255, 0, 0, 255}
+	FloodFill(p, 1, 1, red, FloodOptions{})
+	if got := p.RGBAAt(1, 0); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("filled pixel is %v", got)
+	}
+	if got := p.RGBAAt(0, 0); got != (color.RGBA{}) {
+		t.Errorf("the transparent corner became %v", got)
+	}
+	checkRegion(t, "color region", ColorRegion(p, red, 0),
+		".x.",
+		"xxx",
+		".x.",
+	)
+}
@@ -0,0 +1,219 @@
+package raster
+
+import (
+	"image"
+)
+
+// Changed pixels are stored in tiles of this size so a long stroke across
+// the canvas doesn't end up saving the whole frame
+const historyTileSize = 64
+
+// Step is a single undoable edit
+type Step interface {
+	Undo()
+	Redo()
+	MemorySize() int
+}
+
+// deltaTile holds the before and after pixels of one changed tile
+type deltaTile struct {
+	rect   image.Rectangle
+	before []uint8
+	after  []uint8
+}
+
+// TileDelta is the change an edit made to the pixels of an image, only the tiles that
+// differ are kept
+type TileDelta struct {
+	tiles []deltaTile
+}
+
+// diffTiles compares two images of the same size tile by tile and returns
+// the tiles that differ along with their old and new pixels
+func diffTiles(before, after *BGRA, tileSize int) *TileDelta {
+	delta := &TileDelta{}
+	bounds := after.Rect
+	for ty := bounds.Min.Y; ty < bounds.Max.Y; ty += tileSize {
+		for tx := bounds.Min.X; tx < bounds.Max.X; tx += tileSize {
+			rect := image.Rect(tx, ty, tx+tileSize, ty+tileSize).Intersect(bounds)
+			if !EqualRect(before, after, rect) {
+				delta.tiles = append(delta.tiles, deltaTile{
+					rect:   rect,
+					before: ReadRect(before, rect),
+					after:  ReadRect(after, rect),
+				})
+			}
+		}
+	}
+	return delta
+}
+
+// Empty tells whether the edit didn't change any pixel
+func (delta *TileDelta) Empty() bool {
+	return len(delta.tiles) == 0
+}
+
+// Revert puts back the pixels the image had before the edit
+func (delta *TileDelta) Revert(p *BGRA) {
+	for i := range delta.tiles {
+		tile := &delta.tiles[i]
+		WriteRect(p, tile.rect, tile.before)
+	}
+}
+
+// Apply makes the edit again
+func (delta *TileDelta) Apply(p *BGRA) {
+	for i := range delta.tiles {
+		tile := &delta.tiles[i]
+		WriteRect(p, tile.rect, tile.after)
+	}
+}
+
+func (delta *TileDelta) MemorySize() int {
+	size := 0
+	for i := range delta.tiles {
+		size += len(delta.tiles[i].before) + len(delta.tiles[i].after)
+	}
+	return size
+}
+
+// History keeps track of the edits made to a document
+type History struct {
+	undoSteps   []Step
+	redoSteps   []Step
+	memoryLimit int
+	memoryUsed  int
+	// Copy of the pixels taken when an edit begins
+	snapshot      []uint8
+	snapshotRect  image.Rectangle
+	snapshotLayer int
+	depth         int
+}
+
+func NewHistory(memoryLimit int) *History {
+	history := &History{}
+	history.memoryLimit = memoryLimit
+	return history
+}
+
+// SetMemoryLimit sets the maximum amount of memory (in bytes) the steps can hold,
+// the oldest steps are dropped once the limit exceeds
+func (history *History) SetMemoryLimit(limit int) {
+	history.memoryLimit = limit
+	history.trim()
+}
+
+func (history *History) MemoryUsed() int {
+	return history.memoryUsed
+}
+
+func (history *History) CanUndo() bool {
+	return len(history.undoSteps) > 0
+}
+
+func (history *History) CanRedo() bool {
+	return len(history.redoSteps) > 0
+}
+
+func (history *History) Clear() {
+	history.undoSteps = nil
+	history.redoSteps = nil
+	history.memoryUsed = 0
+	history.depth = 0
+}
+
+// Begin must be called before an edit touches the pixels of the given layer. Calls can be
+// nested, only the outermost Begin/End pair counts
+func (history *History) Begin(layer int, img *BGRA) {
+	history.depth++
+	if history.depth > 1 {
+		return
+	}
+	history.snapshotLayer = layer
+	if cap(history.snapshot) < len(img.Pix) {
+		history.snapshot = make([]uint8, len(img.Pix))
+	}
+	history.snapshot = history.snapshot[:len(img.Pix)]
+	copy(history.snapshot, img.Pix)
+	history.snapshotRect = img.Rect
+}
+
+// End compares the image with the pixels taken at Begin and returns the changed tiles,
+// the caller pushes them as a step. Returns nil if nothing has changed or the edit
+// is still going on
+func (history *History) End(layer int, img *BGRA) *TileDelta {
+	if history.depth == 0 {
+		return nil
+	}
+	history.depth--
+	if history.depth > 0 {
+		return nil
+	}
+	if layer != history.snapshotLayer || !history.snapshotRect.Eq(img.Rect) || len(history.snapshot) != len(img.Pix) {
+		// The document got replaced in the middle of the edit, which records its own step
+		return nil
+	}
+	before := &BGRA{Pix: history.snapshot, Stride: img.Stride, Rect: img.Rect}
+	delta := diffTiles(before, img, historyTileSize)
+	if delta.Empty() {
+		return nil
+	}
+	return delta
+}
+
+// Before returns the pixels the image had at Begin, nil when we aren't editing
+func (history *History) Before() *BGRA {
+	if history.depth == 0 {
+		return nil
+	}
+	return &BGRA{Pix: history.snapshot, Stride: 4 * history.snapshotRect.Dx(), Rect: history.snapshotRect}
+}
+
+// IsEditing tells whether we are in between Begin and End
+func (history *History) IsEditing() bool {
+	return history.depth > 0
+}
+
+// Push records a step that has already been done, the steps that could be redone are lost
+func (history *History) Push(step Step) {
+	history.undoSteps = append(history.undoSteps, step)
+	history.memoryUsed += step.MemorySize()
+	for _, redo := range history.redoSteps {
+		history.memoryUsed -= redo.MemorySize()
+	}
+	history.redoSteps = nil
+	history.trim()
+}
+
+// Drop the oldest steps until we fit into the memory limit, the latest step is always kept
+func (history *History) trim() {
+	for history.memoryUsed > history.memoryLimit && len(history.undoSteps) > 1 {
+		history.memoryUsed -= history.undoSteps[0].MemorySize()
+		history.undoSteps[0] = nil
+		history.undoSteps = history.undoSteps[1:]
+	}
+}
+
+func (history *History) Undo() bool {
+	count := len(history.undoSteps)
+	if count == 0 || history.IsEditing() {
+		return false
+	}
+	step := history.undoSteps[count-1]
+	history.undoSteps = history.undoSteps[:count-1]
+	step.Undo()
+	history.redoSteps = append(history.redoSteps, step)
+	return true
+}
+
+func (history *History) Redo() bool {
+	count := len(history.redoSteps)
+	if count == 0 || history.IsEditing() {
+		return false
+	}
+	step := history.redoSteps[count-1]
+	history.redoSteps = history.redoSteps[:count-1]
+	step.Redo()
+	history.undoSteps = append(history.undoSteps, step)
+	return true
+}
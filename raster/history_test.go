@@ -0,0 +1,227 @@
+package raster
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// newTestImage returns an image with a different color on every pixel
+func newTestImage(width, height int) *BGRA {
+	p := NewBGRA(image.Rect(0, 0, width, height))
+	for i := range p.Pix {
+		p.Pix[i] = uint8(i * 7)
+	}
+	return p
+}
+
+func cloneImage(p *BGRA) *BGRA {
+	c := NewBGRA(p.Rect)
+	copy(c.Pix, p.Pix)
+	return c
+}
+
+// deltaStep is a pixel edit of a single image
+type deltaStep struct {
+	img   *BGRA
+	delta *TileDelta
+}
+
+func (step *deltaStep) Undo()           { step.delta.Revert(step.img) }
+func (step *deltaStep) Redo()           { step.delta.Apply(step.img) }
+func (step *deltaStep) MemorySize() int { return step.delta.MemorySize() }
+
+// snapshotTestStep replaces the whole image, the way new, open or resize do
+type snapshotTestStep struct {
+	doc           **BGRA
+	before, after *BGRA
+}
+
+func (step *snapshotTestStep) Undo()           { *step.doc = step.before }
+func (step *snapshotTestStep) Redo()           { *step.doc = step.after }
+func (step *snapshotTestStep) MemorySize() int { return len(step.before.Pix) + len(step.after.Pix) }
+
+// edit runs the change between Begin and End and pushes what it did
+func edit(t *testing.T, history *History, img *BGRA, change func()) *TileDelta {
+	t.Helper()
+	history.Begin(0, img)
+	change()
+	delta := history.End(0, img)
+	if delta != nil {
+		history.Push(&deltaStep{img: img, delta: delta})
+	}
+	return delta
+}
+
+func TestTileDeltaApplyRevert(t *testing.T) {
+	// 150x100 leaves partial tiles on the right and bottom edges
+	before := newTestImage(150, 100)
+	after := cloneImage(before)
+	Fill(after, image.Rect(60, 10, 70, 20), color.NRGBA{255, 0, 0, 255})
+	Fill(after, image.Rect(140, 90, 150, 100), color.NRGBA{0, 0, 255, 255})
+
+	delta := diffTiles(before, after, historyTileSize)
+	// The first rectangle crosses the border of two tiles, the second is in the corner tile
+	if got := len(delta.tiles); got != 3 {
+		t.Fatalf("changed tiles = %d, want 3", got)
+	}
+	// Only the changed tiles are stored, not the whole frame
+	if size := delta.MemorySize(); size >= 2*len(before.Pix) {
+		t.Errorf("delta takes %d bytes, more than two full frames", size)
+	}
+
+	img := cloneImage(after)
+	delta.Revert(img)
+	if !bytes.Equal(img.Pix, before.Pix) {
+		t.Error("Revert doesn't restore the pixels before the edit")
+	}
+	delta.Apply(img)
+	if !bytes.Equal(img.Pix, after.Pix) {
+		t.Error("Apply doesn't restore the pixels after the edit")
+	}
+}
+
+func TestTileDeltaEmpty(t *testing.T) {
+	img := newTestImage(70, 70)
+	if delta := diffTiles(img, cloneImage(img), historyTileSize); !delta.Empty() {
+		t.Errorf("identical images give %d changed tiles", len(delta.tiles))
+	}
+}
+
+func TestHistoryUndoRedo(t *testing.T) {
+	history := NewHistory(1 << 20)
+	img := newTestImage(100, 100)
+	original := cloneImage(img)
+
+	edit(t, history, img, func() { Fill(img, image.Rect(0, 0, 10, 10), color.NRGBA{255, 0, 0, 255}) })
+	first := cloneImage(img)
+	edit(t, history, img, func() { Fill(img, image.Rect(80, 80, 100, 100), color.NRGBA{0, 255, 0, 255}) })
+	second := cloneImage(img)
+
+	if !history.Undo() || !bytes.Equal(img.Pix, first.Pix) {
+		t.Fatal("undo doesn't revert the second edit")
+	}
+	if !history.Undo() || !bytes.Equal(img.Pix, original.Pix) {
+		t.Fatal("undo doesn't revert the first edit")
+	}
+	if history.Undo() {
+		t.Error("undo with nothing left succeeded")
+	}
+	if !history.Redo() || !history.Redo() || !bytes.Equal(img.Pix, second.Pix) {
+		t.Fatal("redo doesn't bring both edits back")
+	}
+	if history.Redo() {
+		t.Error("redo with nothing left succeeded")
+	}
+}
+
+func TestHistoryNoChange(t *testing.T) {
+	history := NewHistory(1 << 20)
+	img := newTestImage(10, 10)
+	if delta := edit(t, history, img, func() {}); delta != nil {
+		t.Error("an edit changing nothing returned a delta")
+	}
+	if history.CanUndo() {
+		t.Error("an edit changing nothing got recorded")
+	}
+}
+
+func TestHistoryNestedEdits(t *testing.T) {
+	history := NewHistory(1 << 20)
+	img := newTestImage(10, 10)
+	original := cloneImage(img)
+	history.Begin(0, img)
+	history.Begin(0, img)
+	Fill(img, image.Rect(0, 0, 5, 5), color.NRGBA{255, 255, 255, 255})
+	if delta := history.End(0, img); delta != nil {
+		t.Fatal("the inner End returned a delta")
+	}
+	if before := history.Before(); before == nil || !bytes.Equal(before.Pix, original.Pix) {
+		t.Fatal("Before doesn't return the pixels of the outermost Begin")
+	}
+	delta := history.End(0, img)
+	if delta == nil {
+		t.Fatal("the outer End returned no delta")
+	}
+	if history.Before() != nil {
+		t.Error("Before returns pixels once the edit is over")
+	}
+}
+
+func TestHistoryRedoTruncation(t *testing.T) {
+	history := NewHistory(1 << 20)
+	img := newTestImage(64, 64)
+	edit(t, history, img, func() { Fill(img, image.Rect(0, 0, 8, 8), color.NRGBA{255, 0, 0, 255}) })
+	edit(t, history, img, func() { Fill(img, image.Rect(8, 8, 16, 16), color.NRGBA{0, 255, 0, 255}) })
+	history.Undo()
+	if !history.CanRedo() {
+		t.Fatal("nothing to redo after undo")
+	}
+	// A new edit drops the undone one for good
+	edit(t, history, img, func() { Fill(img, image.Rect(30, 30, 40, 40), color.NRGBA{0, 0, 255, 255}) })
+	if history.CanRedo() {
+		t.Error("the undone edit can still be redone after a new edit")
+	}
+	// Each edit changed a single tile
+	tile := 2 * 4 * historyTileSize * historyTileSize
+	if got := history.MemoryUsed(); got != 2*tile {
+		t.Errorf("memory used = %d, want %d once the redo step is dropped", got, 2*tile)
+	}
+	if !history.Undo() || !history.Undo() || history.CanUndo() {
+		t.Error("the history doesn't hold exactly the two remaining edits")
+	}
+}
+
+func TestHistorySnapshotUndo(t *testing.T) {
+	history := NewHistory(1 << 20)
+	doc := newTestImage(20, 20)
+	original := doc
+	edit(t, history, doc, func() { Fill(doc, image.Rect(0, 0, 4, 4), color.NRGBA{255, 0, 0, 255}) })
+	painted := cloneImage(doc)
+
+	// Replace the whole document, like a resize does
+	resized := newTestImage(40, 30)
+	history.Push(&snapshotTestStep{doc: &doc, before: doc, after: resized})
+	doc = resized
+
+	if !history.Undo() || doc != original {
+		t.Fatal("undo doesn't bring back the document before the resize")
+	}
+	if !history.Undo() || bytes.Equal(doc.Pix, painted.Pix) {
+		t.Fatal("undo doesn't revert the paint on the document before the resize")
+	}
+	history.Redo()
+	history.Redo()
+	if doc != resized {
+		t.Error("redo doesn't bring back the resized document")
+	}
+}
+
+func TestHistoryMemoryLimit(t *testing.T) {
+	tile := 2 * 4 * historyTileSize * historyTileSize
+	// Room for two single tile steps
+	history := NewHistory(2 * tile)
+	img := newTestImage(256, 64)
+	for i := 0; i < 4; i++ {
+		x := i * historyTileSize
+		edit(t, history, img, func() { Fill(img, image.Rect(x, 0, x+1, 1), color.NRGBA{1, 2, 3, 255}) })
+	}
+	if got := history.MemoryUsed(); got != 2*tile {
+		t.Errorf("memory used = %d, want %d", got, 2*tile)
+	}
+	undone := 0
+	for history.Undo() {
+		undone++
+	}
+	if undone != 2 {
+		t.Errorf("%d steps kept, want the 2 latest ones", undone)
+	}
+	// The latest step stays even when it alone is over the limit
+	history.Clear()
+	history.SetMemoryLimit(1)
+	edit(t, history, img, func() { Fill(img, img.Rect, color.NRGBA{9, 9, 9, 255}) })
+	if !history.CanUndo() {
+		t.Error("the latest step got dropped")
+	}
+}
@@ -0,0 +1,274 @@
+package raster
+
+import "sort"
+
+// bitWriter packs values into bytes starting from the least significant bit, the
+// way the WebP lossless bitstream expects them
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (bw *bitWriter) write(value uint32, n uint) {
+	bw.acc |= uint64(value) << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nbits -= 8
+	}
+}
+
+// flush writes out the remaining bits padded with zeros
+func (bw *bitWriter) flush() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc, bw.nbits = 0, 0
+	}
+	return bw.buf
+}
+
+// Longest codes allowed for the pixel alphabets and for the code length alphabet
+const (
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+)
+
+// Order in which the lengths of the code length code are stored
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// huffmanCode is a canonical prefix code ready to write symbols with
+type huffmanCode struct {
+	lengths []uint8
+	// Bit reversed codes, so they can be written least significant bit first
+	codes []uint16
+	// Number of bits written for each symbol. A code with a single symbol is
+	// stored with a length of 1 but takes no bits at all in the stream
+	bits []uint8
+}
+
+func (code *huffmanCode) writeSymbol(bw *bitWriter, symbol int) {
+	bw.write(uint32(code.codes[symbol]), uint(code.bits[symbol]))
+}
+
+// huffmanLengths returns the code length of every symbol for the given symbol counts,
+// no code gets longer than maxLength. Unused symbols get a length of 0
+func huffmanLengths(counts []int, maxLength int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	weights := make([]int, len(counts))
+	copy(weights, counts)
+	for {
+		type node struct {
+			weight int
+			parent int
+		}
+		leaves := make([]int, 0, len(weights))
+		for symbol, weight := range weights {
+			if weight > 0 {
+				leaves = append(leaves, symbol)
+			}
+		}
+		if len(leaves) == 0 {
+			return lengths
+		}
+		if len(leaves) == 1 {
+			lengths[leaves[0]] = 1
+			return lengths
+		}
+		sort.SliceStable(leaves, func(i, j int) bool { return weights[leaves[i]] < weights[leaves[j]] })
+		// Leaves come first, then the internal nodes in the order they get built. Both
+		// parts stay sorted by weight, so the two lightest nodes are always at the front
+		nodes := make([]node, len(leaves), 2*len(leaves)-1)
+		for i, symbol := range leaves {
+			nodes[i] = node{weight: weights[symbol], parent: -1}
+		}
+		nextLeaf, nextInternal := 0, len(leaves)
+		lightest := func() int {
+			if nextLeaf < len(leaves) && (nextInternal >= len(nodes) || nodes[nextLeaf].weight <= nodes[nextInternal].weight) {
+				nextLeaf++
+				return nextLeaf - 1
+			}
+			nextInternal++
+			return nextInternal - 1
+		}
+		for len(nodes) < cap(nodes) {
+			a, b := lightest(), lightest()
+			nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, parent: -1})
+			nodes[a].parent = len(nodes) - 1
+			nodes[b].parent = len(nodes) - 1
+		}
+		depths := make([]int, len(nodes))
+		for i := len(nodes) - 2; i >= 0; i-- {
+			depths[i] = depths[nodes[i].parent] + 1
+		}
+		deepest := 0
+		for i, symbol := range leaves {
+			lengths[symbol] = uint8(depths[i])
+			if depths[i] > deepest {
+				deepest = depths[i]
+			}
+		}
+		if deepest <= maxLength {
+			return lengths
+		}
+		// Too deep, flatten the distribution and try again
+		for i := range weights {
+			if weights[i] > 0 {
+				weights[i] = (weights[i] + 1) / 2
+			}
+		}
+	}
+}
+
+// newHuffmanCode builds the canonical code for the given code lengths
+func newHuffmanCode(lengths []uint8) *huffmanCode {
+	code := &huffmanCode{
+		lengths: lengths,
+		codes:   make([]uint16, len(lengths)),
+		bits:    make([]uint8, len(lengths)),
+	}
+	used := 0
+	var count [maxCodeLength + 1]int
+	for _, length := range lengths {
+		if length > 0 {
+			count[length]++
+			used++
+		}
+	}
+	if used < 2 {
+		return code
+	}
+	var next [maxCodeLength + 1]int
+	value := 0
+	for length := 1; length <= maxCodeLength; length++ {
+		value = (value + count[length-1]) << 1
+		next[length] = value
+	}
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		v := next[length]
+		next[length]++
+		reversed := 0
+		for i := 0; i < int(length); i++ {
+			reversed = reversed<<1 | (v>>i)&1
+		}
+		code.codes[symbol] = uint16(reversed)
+		code.bits[symbol] = length
+	}
+	return code
+}
+
+// codeLengthToken is one symbol of the run length encoded code lengths
+type codeLengthToken struct {
+	symbol int
+	extra  uint32
+}
+
+// codeLengthTokens run length encodes the code lengths: 16 repeats the previous
+// length 3-6 times, 17 and 18 write 3-10 and 11-138 zeros
+func codeLengthTokens(lengths []uint8) []codeLengthToken {
+	tokens := make([]codeLengthToken, 0, len(lengths))
+	for i := 0; i < len(lengths); {
+		value := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == value {
+			run++
+		}
+		i += run
+		if value == 0 {
+			for run >= 11 {
+				n := minInt(run, 138)
+				tokens = append(tokens, codeLengthToken{18, uint32(n - 11)})
+				run -= n
+			}
+			for run >= 3 {
+				n := minInt(run, 10)
+				tokens = append(tokens, codeLengthToken{17, uint32(n - 3)})
+				run -= n
+			}
+		} else {
+			tokens = append(tokens, codeLengthToken{int(value), 0})
+			run--
+			for run >= 3 {
+				n := minInt(run, 6)
+				tokens = append(tokens, codeLengthToken{16, uint32(n - 3)})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, codeLengthToken{int(value), 0})
+		}
+	}
+	return tokens
+}
+
+// writeHuffmanCode builds a prefix code for the symbol counts, writes its description
+// into the stream and returns it
+func writeHuffmanCode(bw *bitWriter, counts []int) *huffmanCode {
+	var symbols []int
+	for symbol, count := range counts {
+		if count > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 0 {
+		// Nothing uses this code but it still has to be valid
+		symbols = []int{0}
+	}
+	if len(symbols) <= 2 && symbols[len(symbols)-1] < 256 {
+		// Simple code: one or two 8 bit symbols written directly
+		lengths := make([]uint8, len(counts))
+		bw.write(1, 1)
+		bw.write(uint32(len(symbols)-1), 1)
+		if symbols[0] > 1 {
+			bw.write(1, 1)
+			bw.write(uint32(symbols[0]), 8)
+		} else {
+			bw.write(0, 1)
+			bw.write(uint32(symbols[0]), 1)
+		}
+		if len(symbols) == 2 {
+			bw.write(uint32(symbols[1]), 8)
+		}
+		for _, symbol := range symbols {
+			lengths[symbol] = 1
+		}
+		return newHuffmanCode(lengths)
+	}
+
+	lengths := huffmanLengths(counts, maxCodeLength)
+	tokens := codeLengthTokens(lengths)
+	tokenCounts := make([]int, len(codeLengthCodeOrder))
+	for _, token := range tokens {
+		tokenCounts[token.symbol]++
+	}
+	tokenCode := newHuffmanCode(huffmanLengths(tokenCounts, maxCodeLengthCodeLength))
+	n := 4
+	for i, symbol := range codeLengthCodeOrder {
+		if tokenCode.lengths[symbol] > 0 && i+1 > n {
+			n = i + 1
+		}
+	}
+	bw.write(0, 1)
+	bw.write(uint32(n-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:n] {
+		bw.write(uint32(tokenCode.lengths[symbol]), 3)
+	}
+	// All the code lengths are written, no max_symbol
+	bw.write(0, 1)
+	for _, token := range tokens {
+		tokenCode.writeSymbol(bw, token.symbol)
+		switch token.symbol {
+		case 16:
+			bw.write(token.extra, 2)
+		case 17:
+			bw.write(token.extra, 3)
+		case 18:
+			bw.write(token.extra, 7)
+		}
+	}
+	return newHuffmanCode(lengths)
+}
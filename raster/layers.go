@@ -0,0 +1,37 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+)
+
+// CompositeLayer is what the compositor needs to know of a layer
+type CompositeLayer struct {
+	Pixels  *BGRA
+	Opacity uint8
+	Visible bool
+	Blend   BlendMode
+	// The alpha channel of an opaque layer is ignored, like for a background
+	Opaque bool
+}
+
+// CompositeLayers blends the visible layers, from the bottom one to the top one, into
+// dst within the given rectangle. Transparent areas show a checkerboard pattern if
+// asked for
+func CompositeLayers(dst *BGRA, layers []CompositeLayer, rect image.Rectangle, checkerboard bool) {
+	rect = rect.Intersect(dst.Rect)
+	if rect.Empty() {
+		return
+	}
+	if checkerboard {
+		Checkerboard(dst, rect, 8)
+	} else {
+		Fill(dst, rect, color.NRGBA{})
+	}
+	for _, layer := range layers {
+		if !layer.Visible || layer.Opacity == 0 {
+			continue
+		}
+		Composite(dst, layer.Pixels, rect, layer.Opacity, layer.Blend, layer.Opaque)
+	}
+}
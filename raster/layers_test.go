@@ -0,0 +1,152 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solidImage(width, height int, c color.NRGBA) *BGRA {
+	p := NewBGRA(image.Rect(0, 0, width, height))
+	Fill(p, p.Rect, c)
+	return p
+}
+
+// near tells whether both colors are the same, give or take one for the rounding
+func near(a, b color.RGBA) bool {
+	close := func(x, y uint8) bool {
+		return x-y <= 1 || y-x <= 1
+	}
+	return close(a.R, b.R) && close(a.G, b.G) && close(a.B, b.B) && close(a.A, b.A)
+}
+
+func TestCompositeBlendModes(t *testing.T) {
+	backdrop := color.NRGBA{200, 100, 50, 255}
+	source := color.NRGBA{100, 200, 128, 255}
+	// Both are opaque, so the result is the blend function B(cb, cs) alone
+	tests := []struct {
+		mode BlendMode
+		want color.RGBA
+	}{
+		{BlendNormal, color.RGBA{100, 200, 128, 255}},
+		{BlendMultiply, color.RGBA{78, 78, 25, 255}},
+		{BlendScreen, color.RGBA{222, 222, 153, 255}},
+		{BlendOverlay, color.RGBA{188, 157, 50, 255}},
+		{BlendDarken, color.RGBA{100, 100, 50, 255}},
+		{BlendLighten, color.RGBA{200, 200, 128, 255}},
+	}
+	for _, test := range tests {
+		dst := solidImage(2, 2, backdrop)
+		src := solidImage(2, 2, source)
+		Composite(dst, src, dst.Rect, 255, test.mode, false)
+		if got := dst.RGBAAt(1, 1); !near(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.mode, got, test.want)
+		}
+	}
+}
+
+func TestCompositeOpacity(t *testing.T) {
+	dst := solidImage(1, 1, color.NRGBA{255, 255, 255, 255})
+	src := solidImage(1, 1, color.NRGBA{255, 0, 0, 255})
+	Composite(dst, src, dst.Rect, 128, BlendNormal, false)
+	if got, want := dst.RGBAAt(0, 0), (color.RGBA{255, 127, 127, 255}); got != want {
+		t.Errorf("half red over white = %v, want %v", got, want)
+	}
+
+	// Over nothing the result keeps the (premultiplied) transparency of the source
+	dst = NewBGRA(image.Rect(0, 0, 1, 1))
+	src = solidImage(1, 1, color.NRGBA{255, 0, 0, 128})
+	Composite(dst, src, dst.Rect, 255, BlendNormal, false)
+	if got, want := dst.RGBAAt(0, 0), (color.RGBA{128, 0, 0, 128}); got != want {
+		t.Errorf("half transparent red over nothing = %v, want %v", got, want)
+	}
+}
+
+func TestCompositeBlendTransparentBackdrop(t *testing.T) {
+	// Blending with nothing below shows the source as it is, whatever the mode
+	for mode := BlendMode(0); int(mode) < GetBlendModeCount(); mode++ {
+		dst := NewBGRA(image.Rect(0, 0, 1, 1))
+		src := solidImage(1, 1, color.NRGBA{100, 200, 128, 255})
+		Composite(dst, src, dst.Rect, 255, mode, false)
+		if got, want := dst.RGBAAt(0, 0), (color.RGBA{100, 200, 128, 255}); !near(got, want) {
+			t.Errorf("%v over nothing = %v, want %v", mode, got, want)
+		}
+	}
+}
+
+func TestCompositeLayers(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	green := color.NRGBA{0, 255, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 255}
+	layer := func(c color.NRGBA) CompositeLayer {
+		return CompositeLayer{Pixels: solidImage(4, 4, c), Opacity: 255, Visible: true}
+	}
+	tests := []struct {
+		name   string
+		layers []CompositeLayer
+		want   color.RGBA
+	}{
+		{"top layer wins", []CompositeLayer{layer(red), layer(green)}, color.RGBA{0, 255, 0, 255}},
+		{"hidden layer", []CompositeLayer{layer(red), func() CompositeLayer {
+			l := layer(green)
+			l.Visible = false
+			return l
+		}()}, color.RGBA{255, 0, 0, 255}},
+		{"zero opacity", []CompositeLayer{layer(red), func() CompositeLayer {
+			l := layer(blue)
+			l.Opacity = 0
+			return l
+		}()}, color.RGBA{255, 0, 0, 255}},
+		{"half opacity", []CompositeLayer{layer(red), func() CompositeLayer {
+			l := layer(blue)
+			l.Opacity = 128
+			return l
+		}()}, color.RGBA{127, 0, 128, 255}},
+		{"multiply", []CompositeLayer{layer(color.NRGBA{255, 255, 255, 255}), func() CompositeLayer {
+			l := layer(blue)
+			l.Blend = BlendMultiply
+			return l
+		}()}, color.RGBA{0, 0, 255, 255}},
+		{"opaque background ignores alpha", []CompositeLayer{func() CompositeLayer {
+			l := layer(color.NRGBA{255, 0, 0, 0})
+			l.Opaque = true
+			return l
+		}()}, color.RGBA{0, 0, 0, 255}},
+		{"no layers", nil, color.RGBA{}},
+	}
+	for _, test := range tests {
+		dst := solidImage(4, 4, color.NRGBA{9, 9, 9, 255})
+		CompositeLayers(dst, test.layers, dst.Rect, false)
+		if got := dst.RGBAAt(2, 2); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCompositeLayersRect(t *testing.T) {
+	before := color.RGBA{9, 9, 9, 255}
+	dst := solidImage(4, 4, color.NRGBA{9, 9, 9, 255})
+	layers := []CompositeLayer{{Pixels: solidImage(4, 4, color.NRGBA{255, 0, 0, 255}), Opacity: 255, Visible: true}}
+	CompositeLayers(dst, layers, image.Rect(0, 0, 2, 2), false)
+	if got := dst.RGBAAt(1, 1); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("inside the rectangle got %v", got)
+	}
+	if got := dst.RGBAAt(3, 3); got != before {
+		t.Errorf("outside the rectangle got %v, want it untouched", got)
+	}
+}
+
+func TestCompositeLayersCheckerboard(t *testing.T) {
+	dst := NewBGRA(image.Rect(0, 0, 16, 16))
+	layers := []CompositeLayer{{Pixels: NewBGRA(dst.Rect), Opacity: 255, Visible: true}}
+	CompositeLayers(dst, layers, dst.Rect, true)
+	// Two neighbouring cells of the pattern have different colors and are opaque
+	a, b := dst.RGBAAt(0, 0), dst.RGBAAt(8, 0)
+	if a.A != 255 || b.A != 255 || a == b {
+		t.Errorf("checkerboard cells are %v and %v", a, b)
+	}
+	CompositeLayers(dst, layers, dst.Rect, false)
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{}) {
+		t.Errorf("without checkerboard an empty layer gives %v, want transparent", got)
+	}
+}
@@ -0,0 +1,201 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+)
+
+// PolygonMask returns a mask of the rectangle covering the pixels inside the polygon
+func PolygonMask(points []image.Point, rect image.Rectangle) *image.Alpha {
+	mask := image.NewAlpha(rect)
+	PolygonSpans(points, rect, func(y, x0, x1 int) {
+		i := mask.PixOffset(x0, y)
+		for x := x0; x < x1; x++ {
+			mask.Pix[i] = 255
+			i++
+		}
+	})
+	return mask
+}
+
+// ApplyMask scales the pixels by the coverage of the mask, pixels outside of it become
+// fully transparent
+func ApplyMask(p *BGRA, mask *image.Alpha) {
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		i := p.PixOffset(p.Rect.Min.X, y)
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			coverage := uint32(0)
+			if (image.Point{x, y}).In(mask.Rect) {
+				coverage = uint32(mask.Pix[mask.PixOffset(x, y)])
+			}
+			if coverage < 255 {
+				for channel := 0; channel < 4; channel++ {
+					p.Pix[i+channel] = uint8(uint32(p.Pix[i+channel]) * coverage / 255)
+				}
+			}
+			i += 4
+		}
+	}
+}
+
+// MaskOp tells how a new selection joins the current one
+type MaskOp int
+
+const (
+	MaskReplace MaskOp = iota
+	MaskUnion
+	MaskSubtract
+	MaskIntersect
+)
+
+// RectMask returns a mask covering the rectangle fully
+func RectMask(rect image.Rectangle) *image.Alpha {
+	mask := image.NewAlpha(rect)
+	for i := range mask.Pix {
+		mask.Pix[i] = 255
+	}
+	return mask
+}
+
+// CombineMasks returns the mask we get by applying b to a with the given operation.
+// The pixels outside of a mask count as not covered
+func CombineMasks(a, b *image.Alpha, op MaskOp) *image.Alpha {
+	var rect image.Rectangle
+	switch op {
+	case MaskReplace:
+		rect = b.Rect
+	case MaskUnion:
+		rect = a.Rect.Union(b.Rect)
+	case MaskSubtract:
+		rect = a.Rect
+	case MaskIntersect:
+		rect = a.Rect.Intersect(b.Rect)
+	}
+	mask := image.NewAlpha(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			ca, cb := uint32(a.AlphaAt(x, y).A), uint32(b.AlphaAt(x, y).A)
+			var c uint32
+			switch op {
+			case MaskReplace:
+				c = cb
+			case MaskUnion:
+				c = ca
+				if cb > c {
+					c = cb
+				}
+			case MaskSubtract:
+				c = ca * (255 - cb) / 255
+			case MaskIntersect:
+				c = ca * cb / 255
+			}
+			mask.Pix[mask.PixOffset(x, y)] = uint8(c)
+		}
+	}
+	return mask
+}
+
+// InvertMask returns a mask of the rectangle selecting what the given mask doesn't
+func InvertMask(mask *image.Alpha, rect image.Rectangle) *image.Alpha {
+	inverted := image.NewAlpha(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := inverted.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			inverted.Pix[i] = 255 - mask.AlphaAt(x, y).A
+			i++
+		}
+	}
+	return inverted
+}
+
+// TrimMask returns the part of the mask inside its bounds, sharing the pixels
+func TrimMask(mask *image.Alpha) *image.Alpha {
+	return mask.SubImage(MaskBounds(mask)).(*image.Alpha)
+}
+
+// MaskEdge is a straight piece of the outline of a mask, running along the borders of
+// the pixels from one corner to another
+type MaskEdge struct {
+	From, To image.Point
+}
+
+// MaskOutline returns the borders between the pixels selected by the mask (at least half
+// covered) and the rest. Neighbouring borders on the same line are joined into one edge
+func MaskOutline(mask *image.Alpha) []MaskEdge {
+	selected := func(x, y int) bool {
+		return mask.AlphaAt(x, y).A >= 128
+	}
+	rect := mask.Rect
+	edges := []MaskEdge{}
+	// Horizontal borders, above each row and below the last one
+	for y := rect.Min.Y; y <= rect.Max.Y; y++ {
+		start := 0
+		open := false
+		for x := rect.Min.X; x <= rect.Max.X; x++ {
+			border := x < rect.Max.X && selected(x, y-1) != selected(x, y)
+			if border && !open {
+				start, open = x, true
+			} else if !border && open {
+				edges = append(edges, MaskEdge{image.Pt(start, y), image.Pt(x, y)})
+				open = false
+			}
+		}
+	}
+	// Vertical borders, left of each column and right of the last one
+	for x := rect.Min.X; x <= rect.Max.X; x++ {
+		start := 0
+		open := false
+		for y := rect.Min.Y; y <= rect.Max.Y; y++ {
+			border := y < rect.Max.Y && selected(x-1, y) != selected(x, y)
+			if border && !open {
+				start, open = y, true
+			} else if !border && open {
+				edges = append(edges, MaskEdge{image.Pt(x, start), image.Pt(x, y)})
+				open = false
+			}
+		}
+	}
+	return edges
+}
+
+// ClipToMask puts the pixels of before back into p where the mask doesn't select them,
+// partly selected pixels get a mix of both. Only the pixels within rect are looked at.
+// Both images must have the same bounds
+func ClipToMask(p, before *BGRA, mask *image.Alpha, rect image.Rectangle) {
+	rect = rect.Intersect(p.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := p.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			coverage := uint32(mask.AlphaAt(x, y).A)
+			if coverage < 255 {
+				for channel := 0; channel < 4; channel++ {
+					value := uint32(p.Pix[i+channel])*coverage + uint32(before.Pix[i+channel])*(255-coverage)
+					p.Pix[i+channel] = uint8((value + 127) / 255)
+				}
+			}
+			i += 4
+		}
+	}
+}
+
+// KeyOutColor returns a copy of the mask that leaves out the pixels of p which are fully
+// transparent or exactly of the (straight alpha) color. Pixels outside p stay as they are
+func KeyOutColor(p *BGRA, mask *image.Alpha, c color.NRGBA) *image.Alpha {
+	key := Premultiply(c)
+	keyed := image.NewAlpha(mask.Rect)
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		i := mask.PixOffset(mask.Rect.Min.X, y)
+		copy(keyed.Pix[keyed.PixOffset(mask.Rect.Min.X, y):], mask.Pix[i:i+mask.Rect.Dx()])
+	}
+	rect := mask.Rect.Intersect(p.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := p.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if p.Pix[i+3] == 0 || colorDistance(p, i, key) == 0 {
+				keyed.Pix[keyed.PixOffset(x, y)] = 0
+			}
+			i += 4
+		}
+	}
+	return keyed
+}
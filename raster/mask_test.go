@@ -0,0 +1,175 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestClipToMask(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	before := solidImage(6, 1, white)
+	p := solidImage(6, 1, color.NRGBA{0, 0, 0, 255})
+	mask := image.NewAlpha(p.Rect)
+	mask.SetAlpha(1, 0, color.Alpha{A: 255})
+	mask.SetAlpha(2, 0, color.Alpha{A: 128})
+	// Pixel 5 is outside of the rectangle and keeps the change
+	ClipToMask(p, before, mask, image.Rect(0, 0, 5, 1))
+	want := []uint8{255, 0, 127, 255, 255, 0}
+	for x, level := range want {
+		if got := p.RGBAAt(x, 0); got != (color.RGBA{level, level, level, 255}) {
+			t.Errorf("pixel %d is %v, want gray %d", x, got, level)
+		}
+	}
+}
+
+// parseMask builds a mask from rows of characters the way regionString draws them, 'x'
+// for covered pixels, '+' for half covered ones and '.' for the rest. Its top left
+// corner is at origin
+func parseMask(origin image.Point, rows ...string) *image.Alpha {
+	mask := image.NewAlpha(image.Rectangle{Min: origin, Max: origin.Add(image.Pt(len(rows[0]), len(rows)))})
+	levels := map[byte]uint8{'x': 255, '+': 128, '.': 0}
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			mask.Pix[y*mask.Stride+x] = levels[row[x]]
+		}
+	}
+	return mask
+}
+
+func TestCombineMasks(t *testing.T) {
+	a := parseMask(image.Pt(0, 0),
+		"xxx",
+		"xxx",
+		"xx+",
+	)
+	b := parseMask(image.Pt(1, 1),
+		"x+x",
+		"xx.",
+	)
+	tests := []struct {
+		name string
+		op   MaskOp
+		rect image.Rectangle
+		want []string
+	}{
+		{"replace", MaskReplace, image.Rect(1, 1, 4, 3), []string{
+			"x+x",
+			"xx.",
+		}},
+		{"union", MaskUnion, image.Rect(0, 0, 4, 3), []string{
+			"xxx.",
+			"xxxx",
+			"xxx.",
+		}},
+		{"subtract", MaskSubtract, image.Rect(0, 0, 3, 3), []string{
+			"xxx",
+			"x.+",
+			"x..",
+		}},
+		{"intersect", MaskIntersect, image.Rect(1, 1, 3, 3), []string{
+			"x+",
+			"x+",
+		}},
+	}
+	for _, test := range tests {
+		got := CombineMasks(a, b, test.op)
+		if got.Rect != test.rect {
+			t.Errorf("%s: bounds %v, want %v", test.name, got.Rect, test.rect)
+			continue
+		}
+		checkRegion(t, test.name, got, test.want...)
+	}
+	// Partial coverage scales instead of switching on or off
+	if got := CombineMasks(a, b, MaskSubtract).AlphaAt(2, 1).A; got != 127 {
+		t.Errorf("subtracting half of a full pixel leaves %d, want 127", got)
+	}
+	if got := CombineMasks(a, b, MaskIntersect).AlphaAt(2, 1).A; got != 128 {
+		t.Errorf("intersecting a full pixel with half of one leaves %d, want 128", got)
+	}
+}
+
+func TestInvertMask(t *testing.T) {
+	mask := parseMask(image.Pt(1, 0),
+		"x+",
+		".x",
+	)
+	inverted := InvertMask(mask, image.Rect(0, 0, 4, 2))
+	checkRegion(t, "inverted", inverted,
+		"x.+x",
+		"xx.x",
+	)
+	if got := inverted.AlphaAt(2, 0).A; got != 127 {
+		t.Errorf("half covered pixel inverted to %d, want 127", got)
+	}
+}
+
+func TestPolygonMask(t *testing.T) {
+	// A U shape, the rows across its gap have two spans
+	u := []image.Point{{0, 0}, {1, 0}, {1, 2}, {3, 2}, {3, 0}, {4, 0}, {4, 3}, {0, 3}}
+	checkRegion(t, "U", PolygonMask(u, image.Rect(0, 0, 5, 4)),
+		"x..x.",
+		"x..x.",
+		"xxxx.",
+		".....",
+	)
+	// Clipped to the rectangle
+	checkRegion(t, "clipped U", PolygonMask(u, image.Rect(2, 1, 5, 3)),
+		".x.",
+		"xx.",
+	)
+}
+
+func TestMaskOutline(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon []image.Point
+	}{
+		{"square", []image.Point{{1, 1}, {3, 1}, {3, 3}, {1, 3}}},
+		{"L", []image.Point{{0, 0}, {3, 0}, {3, 1}, {1, 1}, {1, 3}, {0, 3}}},
+		{"U", []image.Point{{0, 0}, {1, 0}, {1, 2}, {3, 2}, {3, 0}, {4, 0}, {4, 3}, {0, 3}}},
+	}
+	for _, test := range tests {
+		mask := PolygonMask(test.polygon, image.Rect(0, 0, 5, 5))
+		// The outline of a polygon mask runs along the sides of the polygon
+		want := map[MaskEdge]bool{}
+		for i, from := range test.polygon {
+			to := test.polygon[(i+1)%len(test.polygon)]
+			if to.X < from.X || to.Y < from.Y {
+				from, to = to, from
+			}
+			want[MaskEdge{from, to}] = true
+		}
+		edges := MaskOutline(mask)
+		if len(edges) != len(want) {
+			t.Errorf("%s: %d edges %v, want %d", test.name, len(edges), edges, len(want))
+			continue
+		}
+		for _, edge := range edges {
+			if !want[edge] {
+				t.Errorf("%s: edge %v isn't a side of the polygon", test.name, edge)
+			}
+		}
+	}
+}
+
+func TestKeyOutColor(t *testing.T) {
+	p := parseImage(
+		".#m ",
+		"#.#.",
+	)
+	mask := parseMask(image.Pt(0, 0),
+		"xx+xx",
+		"+xxx+",
+	)
+	// White and transparent pixels go, the others keep their coverage and so do the
+	// ones outside of the image
+	checkRegion(t, "keyed", KeyOutColor(p, mask, color.NRGBA{255, 255, 255, 255}),
+		".x+.x",
+		"+.x.+",
+	)
+	checkRegion(t, "mask", mask,
+		"xx+xx",
+		"+xxx+",
+	)
+}
@@ -0,0 +1,183 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Paint gives the (premultiplied) color a fill puts at each pixel
+type Paint interface {
+	ColorAt(x, y int) color.RGBA
+}
+
+// SolidPaint is the same color everywhere
+type SolidPaint color.RGBA
+
+func NewSolidPaint(c color.NRGBA) SolidPaint {
+	return SolidPaint(Premultiply(c))
+}
+
+func (paint SolidPaint) ColorAt(x, y int) color.RGBA {
+	return color.RGBA(paint)
+}
+
+type GradientKind int
+
+const (
+	// Changes along the line from start to end
+	GradientLinear GradientKind = iota
+	// Circles around start, end is on the last circle
+	GradientRadial
+	// Goes around start once, beginning in the direction of end
+	GradientAngular
+	// Squares turned towards end around start, end is on the last one
+	GradientDiamond
+)
+
+var gradientKindNames = [...]string{"Linear", "Radial", "Angular", "Diamond"}
+
+func (kind GradientKind) String() string {
+	return gradientKindNames[kind]
+}
+
+func GetGradientKindCount() int {
+	return len(gradientKindNames)
+}
+
+// GradientStop is a color of the gradient at a position from 0 (start) to 1 (end)
+type GradientStop struct {
+	Offset float64
+	Color  color.NRGBA
+}
+
+// Gradient blends its stops from the start point to the end point, pixels before the
+// first or after the last stop take its color
+type Gradient struct {
+	Kind       GradientKind
+	Start, End image.Point
+	// Sorted by offset
+	Stops []GradientStop
+}
+
+// position returns where the pixel is on the gradient, 0 at start and 1 at end
+func (gradient *Gradient) position(x, y int) float64 {
+	dx := float64(gradient.End.X - gradient.Start.X)
+	dy := float64(gradient.End.Y - gradient.Start.Y)
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return 0
+	}
+	// Measure from the pixel center
+	px := float64(x-gradient.Start.X) + 0.5
+	py := float64(y-gradient.Start.Y) + 0.5
+	switch gradient.Kind {
+	case GradientRadial:
+		return math.Hypot(px, py) / length
+	case GradientAngular:
+		angle := math.Atan2(py, px) - math.Atan2(dy, dx)
+		if angle < 0 {
+			angle += 2 * math.Pi
+		}
+		return angle / (2 * math.Pi)
+	case GradientDiamond:
+		// Distances along the direction of end and across it
+		along := (px*dx + py*dy) / length
+		across := (py*dx - px*dy) / length
+		return (math.Abs(along) + math.Abs(across)) / length
+	default:
+		return (px*dx + py*dy) / (length * length)
+	}
+}
+
+func (gradient *Gradient) ColorAt(x, y int) color.RGBA {
+	stops := gradient.Stops
+	if len(stops) == 0 {
+		return color.RGBA{}
+	}
+	t := gradient.position(x, y)
+	if t <= stops[0].Offset {
+		return Premultiply(stops[0].Color)
+	}
+	for i := 1; i < len(stops); i++ {
+		if t > stops[i].Offset {
+			continue
+		}
+		// Mix premultiplied colors so fading into transparency doesn't darken
+		c0, c1 := Premultiply(stops[i-1].Color), Premultiply(stops[i].Color)
+		span := stops[i].Offset - stops[i-1].Offset
+		if span <= 0 {
+			return c1
+		}
+		f := (t - stops[i-1].Offset) / span
+		mix := func(a, b uint8) uint8 {
+			return uint8(float64(a) + (float64(b)-float64(a))*f + 0.5)
+		}
+		return color.RGBA{mix(c0.R, c1.R), mix(c0.G, c1.G), mix(c0.B, c1.B), mix(c0.A, c1.A)}
+	}
+	return Premultiply(stops[len(stops)-1].Color)
+}
+
+// Pattern repeats the image over the whole plane, its top left corner at Origin
+type Pattern struct {
+	Image  *BGRA
+	Origin image.Point
+}
+
+func (pattern *Pattern) ColorAt(x, y int) color.RGBA {
+	rect := pattern.Image.Rect
+	w, h := rect.Dx(), rect.Dy()
+	if w == 0 || h == 0 {
+		return color.RGBA{}
+	}
+	px := ((x-pattern.Origin.X)%w + w) % w
+	py := ((y-pattern.Origin.Y)%h + h) % h
+	return pattern.Image.RGBAAt(rect.Min.X+px, rect.Min.Y+py)
+}
+
+// PaintMask paints into dst through the mask. Fully covered pixels get replaced, partly
+// covered ones get a mix of both colors
+func PaintMask(dst *BGRA, mask *image.Alpha, paint Paint) {
+	rect := dst.Rect.Intersect(mask.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := dst.PixOffset(rect.Min.X, y)
+		mi := mask.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if coverage := uint32(mask.Pix[mi]); coverage > 0 {
+				c := paint.ColorAt(x, y)
+				if coverage == 255 {
+					dst.Pix[i+0] = c.B
+					dst.Pix[i+1] = c.G
+					dst.Pix[i+2] = c.R
+					dst.Pix[i+3] = c.A
+				} else {
+					for channel, value := range [4]uint8{c.B, c.G, c.R, c.A} {
+						dst.Pix[i+channel] = uint8((uint32(value)*coverage + uint32(dst.Pix[i+channel])*(255-coverage) + 127) / 255)
+					}
+				}
+			}
+			i += 4
+			mi++
+		}
+	}
+}
+
+// PaintAlpha replaces the colors inside rect with the paint, the alpha the pixels had
+// tells how much of the paint they get. This turns a shape drawn in any opaque color
+// into the same shape filled with the paint
+func PaintAlpha(p *BGRA, rect image.Rectangle, paint Paint) {
+	rect = rect.Intersect(p.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := p.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if coverage := uint32(p.Pix[i+3]); coverage > 0 {
+				c := paint.ColorAt(x, y)
+				p.Pix[i+0] = uint8(uint32(c.B) * coverage / 255)
+				p.Pix[i+1] = uint8(uint32(c.G) * coverage / 255)
+				p.Pix[i+2] = uint8(uint32(c.R) * coverage / 255)
+				p.Pix[i+3] = uint8(uint32(c.A) * coverage / 255)
+			}
+			i += 4
+		}
+	}
+}
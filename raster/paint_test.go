@@ -0,0 +1,85 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGradientEndpoints(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	stops := []GradientStop{{0.02, color.NRGBA{0, 0, 0, 255}}, {0.98, color.NRGBA{255, 255, 255, 255}}}
+	tests := []struct {
+		kind GradientKind
+		pt   image.Point
+		want color.RGBA
+	}{
+		{GradientLinear, image.Pt(0, 0), black},
+		{GradientLinear, image.Pt(-20, 7), black},
+		{GradientLinear, image.Pt(99, 0), white},
+		{GradientLinear, image.Pt(150, -7), white},
+		{GradientRadial, image.Pt(0, 0), black},
+		{GradientRadial, image.Pt(0, 99), white},
+		{GradientRadial, image.Pt(-150, 0), white},
+		{GradientAngular, image.Pt(50, 1), black},
+		{GradientAngular, image.Pt(50, -1), white},
+		{GradientDiamond, image.Pt(0, 0), black},
+		{GradientDiamond, image.Pt(0, 99), white},
+		{GradientDiamond, image.Pt(-99, 0), white},
+	}
+	for _, test := range tests {
+		gradient := &Gradient{Kind: test.kind, Start: image.Pt(0, 0), End: image.Pt(100, 0), Stops: stops}
+		if got := gradient.ColorAt(test.pt.X, test.pt.Y); got != test.want {
+			t.Errorf("%v gradient at %v is %v, want %v", test.kind, test.pt, got, test.want)
+		}
+	}
+}
+
+func TestGradientFadesPremultiplied(t *testing.T) {
+	gradient := &Gradient{Start: image.Pt(0, 0), End: image.Pt(10, 0), Stops: []GradientStop{
+		{0, color.NRGBA{255, 0, 0, 255}},
+		{1, color.NRGBA{255, 0, 0, 0}},
+	}}
+	// Halfway red is half transparent and not darker
+	got := gradient.ColorAt(4, 0)
+	if !near(got, color.RGBA{140, 0, 0, 140}) {
+		t.Errorf("halfway the gradient is %v", got)
+	}
+	if got := gradient.ColorAt(5, 0); got.R != got.A {
+		t.Errorf("%v has a different red than alpha", got)
+	}
+	if got := (&Gradient{Start: image.Pt(3, 3), End: image.Pt(3, 3)}).ColorAt(3, 3); got != (color.RGBA{}) {
+		t.Errorf("gradient without stops gives %v", got)
+	}
+}
+
+func TestPatternTiling(t *testing.T) {
+	// A 2x3 tile placed away from the origin
+	tile := NewBGRA(image.Rect(5, 5, 7, 8))
+	for y := 5; y < 8; y++ {
+		for x := 5; x < 7; x++ {
+			Fill(tile, image.Rect(x, y, x+1, y+1), color.NRGBA{uint8(x * 10), uint8(y * 10), 0, 255})
+		}
+	}
+	pattern := &Pattern{Image: tile, Origin: image.Pt(-3, -1)}
+	for y := -7; y < 7; y++ {
+		for x := -7; x < 7; x++ {
+			// The pixel of the tile that repeats at (x, y), counting from the origin
+			tx, ty := x+3, y+1
+			for tx < 0 {
+				tx += 2
+			}
+			for ty < 0 {
+				ty += 3
+			}
+			want := tile.RGBAAt(5+tx%2, 5+ty%3)
+			if got := pattern.ColorAt(x, y); got != want {
+				t.Fatalf("pattern at (%d, %d) is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	if got := pattern.ColorAt(-3, -1); got != tile.RGBAAt(5, 5) {
+		t.Errorf("the origin shows %v, not the top left pixel of the tile", got)
+	}
+}
@@ -0,0 +1,154 @@
+package raster
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+)
+
+// Premultiply converts a straight alpha color into the premultiplied form we store
+func Premultiply(c color.NRGBA) color.RGBA {
+	a := uint32(c.A)
+	return color.RGBA{
+		R: uint8(uint32(c.R) * a / 255),
+		G: uint8(uint32(c.G) * a / 255),
+		B: uint8(uint32(c.B) * a / 255),
+		A: c.A,
+	}
+}
+
+// Fill replaces the pixels of the rectangle with the (straight alpha) color
+func Fill(dst *BGRA, rect image.Rectangle, c color.NRGBA) {
+	rect = rect.Intersect(dst.Rect)
+	pc := Premultiply(c)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := dst.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			dst.Pix[i+0] = pc.B
+			dst.Pix[i+1] = pc.G
+			dst.Pix[i+2] = pc.R
+			dst.Pix[i+3] = pc.A
+			i += 4
+		}
+	}
+}
+
+// Checkerboard fills the rectangle with the usual gray and white pattern that
+// shows transparent areas
+func Checkerboard(dst *BGRA, rect image.Rectangle, cellSize int) {
+	rect = rect.Intersect(dst.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := dst.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			value := uint8(255)
+			if ((x/cellSize)+(y/cellSize))%2 == 1 {
+				value = 204
+			}
+			dst.Pix[i+0] = value
+			dst.Pix[i+1] = value
+			dst.Pix[i+2] = value
+			dst.Pix[i+3] = 255
+			i += 4
+		}
+	}
+}
+
+// CopyRect copies the rectangle from src into the same place of dst
+func CopyRect(dst, src *BGRA, rect image.Rectangle) {
+	rect = rect.Intersect(dst.Rect).Intersect(src.Rect)
+	rowLength := rect.Dx() * 4
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		di := dst.PixOffset(rect.Min.X, y)
+		si := src.PixOffset(rect.Min.X, y)
+		copy(dst.Pix[di:di+rowLength], src.Pix[si:si+rowLength])
+	}
+}
+
+// VisibleBounds returns the smallest rectangle holding all the pixels that aren't fully
+// transparent, it is empty if there are none
+func VisibleBounds(p *BGRA) image.Rectangle {
+	bounds := image.Rectangle{}
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		i := p.PixOffset(p.Rect.Min.X, y)
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			if p.Pix[i+3] != 0 {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+			i += 4
+		}
+	}
+	return bounds
+}
+
+// MaskBounds returns the smallest rectangle holding all the pixels the mask covers at
+// least partly, it is empty if there are none
+func MaskBounds(mask *image.Alpha) image.Rectangle {
+	bounds := image.Rectangle{}
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		i := mask.PixOffset(mask.Rect.Min.X, y)
+		found := false
+		x0, x1 := 0, 0
+		for x := mask.Rect.Min.X; x < mask.Rect.Max.X; x++ {
+			if mask.Pix[i] != 0 {
+				if !found {
+					x0, found = x, true
+				}
+				x1 = x + 1
+			}
+			i++
+		}
+		if found {
+			bounds = bounds.Union(image.Rect(x0, y, x1, y+1))
+		}
+	}
+	return bounds
+}
+
+// EqualRect tells whether both images have the same pixels inside the rectangle
+func EqualRect(p1, p2 *BGRA, rect image.Rectangle) bool {
+	rowLength := rect.Dx() * 4
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i1 := p1.PixOffset(rect.Min.X, y)
+		i2 := p2.PixOffset(rect.Min.X, y)
+		if !bytes.Equal(p1.Pix[i1:i1+rowLength], p2.Pix[i2:i2+rowLength]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadRect returns the pixels of the given rectangle packed row after row
+func ReadRect(p *BGRA, rect image.Rectangle) []uint8 {
+	rowLength := rect.Dx() * 4
+	pix := make([]uint8, rowLength*rect.Dy())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := p.PixOffset(rect.Min.X, y)
+		copy(pix[(y-rect.Min.Y)*rowLength:], p.Pix[i:i+rowLength])
+	}
+	return pix
+}
+
+// WriteRect is the reverse of ReadRect
+func WriteRect(p *BGRA, rect image.Rectangle, pix []uint8) {
+	rowLength := rect.Dx() * 4
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := p.PixOffset(rect.Min.X, y)
+		copy(p.Pix[i:i+rowLength], pix[(y-rect.Min.Y)*rowLength:])
+	}
+}
+
+// blendOver puts the premultiplied color over the pixel at offset i
+func blendOver(p *BGRA, i int, c color.RGBA) {
+	if c.A == 255 {
+		p.Pix[i+0] = c.B
+		p.Pix[i+1] = c.G
+		p.Pix[i+2] = c.R
+		p.Pix[i+3] = 255
+		return
+	}
+	inv := 255 - uint32(c.A)
+	p.Pix[i+0] = uint8(uint32(c.B) + uint32(p.Pix[i+0])*inv/255)
+	p.Pix[i+1] = uint8(uint32(c.G) + uint32(p.Pix[i+1])*inv/255)
+	p.Pix[i+2] = uint8(uint32(c.R) + uint32(p.Pix[i+2])*inv/255)
+	p.Pix[i+3] = uint8(uint32(c.A) + uint32(p.Pix[i+3])*inv/255)
+}
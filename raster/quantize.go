@@ -0,0 +1,253 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// Pixels with less alpha than this become transparent in a paletted image
+const transparentThreshold = 128
+
+// Colors are collected into a histogram with 5 bits per channel
+const histogramBits = 5
+
+type histogramEntry struct {
+	// Sum of the colors that fell into this bucket, used to get the average
+	r, g, b uint64
+	count   uint64
+}
+
+func (e *histogramEntry) average() [3]uint8 {
+	return [3]uint8{uint8(e.r / e.count), uint8(e.g / e.count), uint8(e.b / e.count)}
+}
+
+// colorBox is a group of histogram entries that ends up as a single palette color
+type colorBox struct {
+	entries []*histogramEntry
+	count   uint64
+}
+
+// widestChannel returns the channel with the biggest range of values and that range
+func (box *colorBox) widestChannel() (channel int, width int) {
+	for c := 0; c < 3; c++ {
+		min, max := 255, 0
+		for _, e := range box.entries {
+			v := int(e.average()[c])
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		if max-min > width {
+			channel, width = c, max-min
+		}
+	}
+	return
+}
+
+// split cuts the box in two at the weighted median of its widest channel
+func (box *colorBox) split() (*colorBox, *colorBox) {
+	channel, _ := box.widestChannel()
+	sort.Slice(box.entries, func(i, j int) bool {
+		return box.entries[i].average()[channel] < box.entries[j].average()[channel]
+	})
+	half := box.count / 2
+	var sum uint64
+	cut := 1
+	for i, e := range box.entries[:len(box.entries)-1] {
+		sum += e.count
+		cut = i + 1
+		if sum >= half {
+			break
+		}
+	}
+	a := &colorBox{entries: box.entries[:cut]}
+	b := &colorBox{entries: box.entries[cut:]}
+	for _, e := range a.entries {
+		a.count += e.count
+	}
+	b.count = box.count - a.count
+	return a, b
+}
+
+func (box *colorBox) color() color.RGBA {
+	var r, g, b, count uint64
+	for _, e := range box.entries {
+		r += e.r
+		g += e.g
+		b += e.b
+		count += e.count
+	}
+	return color.RGBA{R: uint8(r / count), G: uint8(g / count), B: uint8(b / count), A: 255}
+}
+
+// straightColor returns the non-premultiplied color at offset i
+func straightColor(p *BGRA, i int) (r, g, b, a uint8) {
+	a = p.Pix[i+3]
+	if a == 0 {
+		return 0, 0, 0, 0
+	}
+	if a == 255 {
+		return p.Pix[i+2], p.Pix[i+1], p.Pix[i+0], 255
+	}
+	unmul := func(v uint8) uint8 {
+		x := uint32(v) * 255 / uint32(a)
+		if x > 255 {
+			x = 255
+		}
+		return uint8(x)
+	}
+	return unmul(p.Pix[i+2]), unmul(p.Pix[i+1]), unmul(p.Pix[i+0]), a
+}
+
+// MedianCut builds a palette of at most maxColors opaque colors for the image
+// using the median cut algorithm. Transparent pixels are left out
+func MedianCut(img *BGRA, maxColors int) color.Palette {
+	const shift = 8 - histogramBits
+	histogram := make([]histogramEntry, 1<<(3*histogramBits))
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		i := img.PixOffset(img.Rect.Min.X, y)
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			r, g, b, a := straightColor(img, i)
+			i += 4
+			if a < transparentThreshold {
+				continue
+			}
+			index := (int(r>>shift) << (2 * histogramBits)) | (int(g>>shift) << histogramBits) | int(b>>shift)
+			e := &histogram[index]
+			e.r += uint64(r)
+			e.g += uint64(g)
+			e.b += uint64(b)
+			e.count++
+		}
+	}
+	all := &colorBox{}
+	for i := range histogram {
+		if histogram[i].count > 0 {
+			all.entries = append(all.entries, &histogram[i])
+			all.count += histogram[i].count
+		}
+	}
+	if len(all.entries) == 0 || maxColors < 1 {
+		return color.Palette{}
+	}
+	boxes := []*colorBox{all}
+	for len(boxes) < maxColors {
+		// Split the box that covers the most pixels over the widest range
+		best, bestScore := -1, uint64(0)
+		for i, box := range boxes {
+			if len(box.entries) < 2 {
+				continue
+			}
+			_, width := box.widestChannel()
+			score := uint64(width) * box.count
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		a, b := boxes[best].split()
+		boxes[best] = a
+		boxes = append(boxes, b)
+	}
+	palette := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		palette[i] = box.color()
+	}
+	return palette
+}
+
+// nearestColor returns the index of the palette color closest to (r, g, b), the
+// first skip entries are not considered
+func nearestColor(palette color.Palette, skip int, r, g, b int) int {
+	best, bestDistance := skip, -1
+	for i := skip; i < len(palette); i++ {
+		c := palette[i].(color.RGBA)
+		dr, dg, db := r-int(c.R), g-int(c.G), b-int(c.B)
+		distance := dr*dr + dg*dg + db*db
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = i, distance
+			if distance == 0 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// Palettize reduces the image to a paletted image with at most maxColors colors.
+// If the image has transparent pixels the first palette entry is reserved for them.
+// With dither the quantization error is spread using Floyd-Steinberg
+func Palettize(img *BGRA, maxColors int, dither bool) *image.Paletted {
+	if maxColors < 2 {
+		maxColors = 2
+	}
+	if maxColors > 256 {
+		maxColors = 256
+	}
+	transparent := !img.Opaque()
+	skip := 0
+	var palette color.Palette
+	if transparent {
+		palette = append(color.Palette{color.RGBA{}}, MedianCut(img, maxColors-1)...)
+		skip = 1
+	} else {
+		palette = MedianCut(img, maxColors)
+	}
+	if len(palette) == skip {
+		// Nothing visible at all, still we need at least one opaque color
+		palette = append(palette, color.RGBA{A: 255})
+	}
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	dst := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	cache := make(map[int]uint8)
+	// Errors of the current and the next row, 3 channels per pixel with a pixel of
+	// padding on both sides
+	errCurrent := make([]int, (width+2)*3)
+	errNext := make([]int, (width+2)*3)
+	for y := 0; y < height; y++ {
+		i := img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y)
+		for x := 0; x < width; x++ {
+			r8, g8, b8, a := straightColor(img, i)
+			i += 4
+			if transparent && a < transparentThreshold {
+				dst.Pix[y*dst.Stride+x] = 0
+				continue
+			}
+			r, g, b := int(r8), int(g8), int(b8)
+			e := (x + 1) * 3
+			if dither {
+				r = clampInt(r+errCurrent[e+0]/16, 0, 255)
+				g = clampInt(g+errCurrent[e+1]/16, 0, 255)
+				b = clampInt(b+errCurrent[e+2]/16, 0, 255)
+			}
+			key := r<<16 | g<<8 | b
+			index, found := cache[key]
+			if !found {
+				index = uint8(nearestColor(palette, skip, r, g, b))
+				cache[key] = index
+			}
+			dst.Pix[y*dst.Stride+x] = index
+			if dither {
+				c := palette[index].(color.RGBA)
+				diff := [3]int{r - int(c.R), g - int(c.G), b - int(c.B)}
+				for ch := 0; ch < 3; ch++ {
+					errCurrent[e+3+ch] += diff[ch] * 7
+					errNext[e-3+ch] += diff[ch] * 3
+					errNext[e+ch] += diff[ch] * 5
+					errNext[e+3+ch] += diff[ch] * 1
+				}
+			}
+		}
+		errCurrent, errNext = errNext, errCurrent
+		for j := range errNext {
+			errNext[j] = 0
+		}
+	}
+	return dst
+}
@@ -0,0 +1,88 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// rainbowImage returns an opaque image with thousands of different colors
+func rainbowImage() *BGRA {
+	p := NewBGRA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			Fill(p, image.Rect(x, y, x+1, y+1), color.NRGBA{uint8(x * 4), uint8(y * 4), uint8((x + y) * 2), 255})
+		}
+	}
+	return p
+}
+
+func TestMedianCutPaletteSize(t *testing.T) {
+	img := rainbowImage()
+	for _, maxColors := range []int{1, 2, 16, 255} {
+		if got := len(MedianCut(img, maxColors)); got != maxColors {
+			t.Errorf("%d colors asked, %d in the palette", maxColors, got)
+		}
+	}
+	// Fewer colors than asked for give one entry each
+	few := parseImage(
+		".#m",
+		"m#.",
+	)
+	if got := len(MedianCut(few, 16)); got != 3 {
+		t.Errorf("three colors give %d palette entries", got)
+	}
+	if got := len(MedianCut(NewBGRA(image.Rect(0, 0, 4, 4)), 16)); got != 0 {
+		t.Errorf("a transparent image gives %d palette entries", got)
+	}
+}
+
+func TestPalettizeExactColors(t *testing.T) {
+	img := parseImage(
+		".#mg",
+		"g.#m",
+	)
+	for _, dither := range []bool{false, true} {
+		paletted := Palettize(img, 16, dither)
+		if len(paletted.Palette) != 4 {
+			t.Fatalf("dither %v: %d palette entries, want 4", dither, len(paletted.Palette))
+		}
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 4; x++ {
+				want := color.RGBAModel.Convert(img.At(x, y))
+				if got := paletted.At(x, y); got != want {
+					t.Errorf("dither %v: pixel (%d, %d) is %v, want %v", dither, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestPalettizeTransparent(t *testing.T) {
+	img := parseImage(
+		" .#",
+		"#. ",
+	)
+	// Barely visible pixels count as transparent too
+	Fill(img, image.Rect(1, 1, 2, 2), color.NRGBA{255, 255, 255, 100})
+	paletted := Palettize(img, 4, false)
+	if c := paletted.Palette[0].(color.RGBA); c.A != 0 {
+		t.Fatalf("first palette entry is %v, want the transparent one", c)
+	}
+	for _, pt := range []image.Point{{0, 0}, {1, 1}, {2, 1}} {
+		if index := paletted.ColorIndexAt(pt.X, pt.Y); index != 0 {
+			t.Errorf("transparent pixel %v got palette entry %d", pt, index)
+		}
+	}
+	for _, pt := range []image.Point{{1, 0}, {2, 0}, {0, 1}} {
+		if _, _, _, a := paletted.At(pt.X, pt.Y).RGBA(); a != 0xffff {
+			t.Errorf("opaque pixel %v became transparent", pt)
+		}
+	}
+	// Opaque images don't spend an entry on transparency
+	for _, c := range Palettize(rainbowImage(), 4, true).Palette {
+		if c.(color.RGBA).A != 255 {
+			t.Errorf("opaque image has the palette entry %v", c)
+		}
+	}
+}
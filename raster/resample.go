@@ -0,0 +1,303 @@
+package raster
+
+import (
+	"image"
+	"math"
+)
+
+// Filter tells how the pixels get resampled when an image gets scaled or turned
+type Filter int
+
+const (
+	// Takes the closest pixel, keeps the hard edges of pixel art
+	FilterNearest Filter = iota
+	// Blends the 2x2 closest pixels
+	FilterBilinear
+	// Blends the 4x4 closest pixels with the Catmull-Rom spline, sharper than bilinear
+	FilterBicubic
+	// Blends the 6x6 closest pixels with a windowed sinc, the sharpest but can ring
+	// along hard edges
+	FilterLanczos
+)
+
+var filterNames = [...]string{"Nearest neighbour", "Bilinear", "Bicubic", "Lanczos-3"}
+
+func (filter Filter) String() string {
+	return filterNames[filter]
+}
+
+func GetFilterCount() int {
+	return len(filterNames)
+}
+
+// support returns how far from the sampled point the filter takes pixels
+func (filter Filter) support() float64 {
+	switch filter {
+	case FilterBilinear:
+		return 1
+	case FilterBicubic:
+		return 2
+	case FilterLanczos:
+		return 3
+	}
+	return 0.5
+}
+
+// weight returns how much a pixel at the distance t counts
+func (filter Filter) weight(t float64) float64 {
+	t = math.Abs(t)
+	switch filter {
+	case FilterBilinear:
+		if t < 1 {
+			return 1 - t
+		}
+	case FilterBicubic:
+		if t < 1 {
+			return 1.5*t*t*t - 2.5*t*t + 1
+		}
+		if t < 2 {
+			return -0.5*t*t*t + 2.5*t*t - 4*t + 2
+		}
+	case FilterLanczos:
+		if t < 3 {
+			return sinc(t) * sinc(t/3)
+		}
+	default:
+		if t < 0.5 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func sinc(t float64) float64 {
+	if t == 0 {
+		return 1
+	}
+	t *= math.Pi
+	return math.Sin(t) / t
+}
+
+// Affine maps the point (x, y) to (A*x + B*y + C, D*x + E*y + F)
+type Affine struct {
+	A, B, C float64
+	D, E, F float64
+}
+
+func Identity() Affine {
+	return Affine{A: 1, E: 1}
+}
+
+func Translate(dx, dy float64) Affine {
+	return Affine{A: 1, C: dx, E: 1, F: dy}
+}
+
+func Scale(sx, sy float64) Affine {
+	return Affine{A: sx, E: sy}
+}
+
+// Rotate turns clockwise on screen (y goes down) by the angle in radians
+func Rotate(angle float64) Affine {
+	sin, cos := math.Sincos(angle)
+	return Affine{A: cos, B: -sin, D: sin, E: cos}
+}
+
+// Skew slants the vertical lines by ax and the horizontal ones by ay, in radians
+func Skew(ax, ay float64) Affine {
+	return Affine{A: 1, B: math.Tan(ax), D: math.Tan(ay), E: 1}
+}
+
+// Then returns the transform doing m first and n after
+func (m Affine) Then(n Affine) Affine {
+	return Affine{
+		A: n.A*m.A + n.B*m.D, B: n.A*m.B + n.B*m.E, C: n.A*m.C + n.B*m.F + n.C,
+		D: n.D*m.A + n.E*m.D, E: n.D*m.B + n.E*m.E, F: n.D*m.C + n.E*m.F + n.F,
+	}
+}
+
+// Invert returns the transform undoing m, false if m flattens the plane
+func (m Affine) Invert() (Affine, bool) {
+	det := m.A*m.E - m.B*m.D
+	if math.Abs(det) < 1e-12 {
+		return Affine{}, false
+	}
+	return Affine{
+		A: m.E / det, B: -m.B / det, C: (m.B*m.F - m.E*m.C) / det,
+		D: -m.D / det, E: m.A / det, F: (m.D*m.C - m.A*m.F) / det,
+	}, true
+}
+
+func (m Affine) Apply(x, y float64) (float64, float64) {
+	return m.A*x + m.B*y + m.C, m.D*x + m.E*y + m.F
+}
+
+// ResizeTransform returns the transform scaling rect to width x height and skewing it by
+// ax and ay (radians), moved so the result starts at (0, 0)
+func ResizeTransform(rect image.Rectangle, width, height int, ax, ay float64) Affine {
+	m := Translate(float64(-rect.Min.X), float64(-rect.Min.Y)).
+		Then(Scale(float64(width)/float64(rect.Dx()), float64(height)/float64(rect.Dy()))).
+		Then(Skew(ax, ay))
+	bounds := m.Bounds(rect)
+	return m.Then(Translate(float64(-bounds.Min.X), float64(-bounds.Min.Y)))
+}
+
+// RotateTransform returns the transform turning rect around its center by the angle
+// (radians), moved so the result starts at (0, 0)
+func RotateTransform(rect image.Rectangle, angle float64) Affine {
+	cx, cy := float64(rect.Min.X+rect.Max.X)/2, float64(rect.Min.Y+rect.Max.Y)/2
+	m := Translate(-cx, -cy).Then(Rotate(angle))
+	bounds := m.Bounds(rect)
+	return m.Then(Translate(float64(-bounds.Min.X), float64(-bounds.Min.Y)))
+}
+
+// Bounds returns the pixels the transformed rectangle covers
+func (m Affine) Bounds(rect image.Rectangle) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, corner := range [4]image.Point{rect.Min, {rect.Max.X, rect.Min.Y}, rect.Max, {rect.Min.X, rect.Max.Y}} {
+		x, y := m.Apply(float64(corner.X), float64(corner.Y))
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	// Leave out the pixels only touched by rounding errors
+	const epsilon = 1e-6
+	return image.Rect(int(math.Floor(minX+epsilon)), int(math.Floor(minY+epsilon)),
+		int(math.Ceil(maxX-epsilon)), int(math.Ceil(maxY-epsilon)))
+}
+
+// sampler resamples planes of channels bytes per pixel. Points outside of the source
+// are zero (transparent), inside it the pixels along the edges repeat outwards so the
+// edges stay sharp
+type sampler struct {
+	pix      []uint8
+	stride   int
+	rect     image.Rectangle
+	channels int
+	filter   Filter
+	// How many source pixels one destination pixel spans, at least 1. The filter gets
+	// that much wider when shrinking so it doesn't skip pixels
+	scaleX, scaleY float64
+	weightsX       []float64
+	weightsY       []float64
+}
+
+func newSampler(pix []uint8, stride int, rect image.Rectangle, channels int, filter Filter, inverse Affine) *sampler {
+	s := &sampler{pix: pix, stride: stride, rect: rect, channels: channels, filter: filter}
+	s.scaleX = math.Max(1, math.Hypot(inverse.A, inverse.D))
+	s.scaleY = math.Max(1, math.Hypot(inverse.B, inverse.E))
+	return s
+}
+
+// taps returns the first source pixel and the weights of the pixels around c, the
+// center of the sampled point along one axis
+func (s *sampler) taps(c, scale float64, weights []float64) (int, []float64) {
+	radius := s.filter.support() * scale
+	first := int(math.Floor(c - radius + 0.5))
+	last := int(math.Floor(c + radius - 0.5))
+	weights = weights[:0]
+	for i := first; i <= last; i++ {
+		weights = append(weights, s.filter.weight((float64(i)+0.5-c)/scale))
+	}
+	return first, weights
+}
+
+// at samples the source around (x, y) into values
+func (s *sampler) at(x, y float64, values []float64) {
+	for c := range values {
+		values[c] = 0
+	}
+	px, py := int(math.Floor(x)), int(math.Floor(y))
+	if !(image.Point{px, py}).In(s.rect) {
+		return
+	}
+	if s.filter == FilterNearest {
+		i := (py-s.rect.Min.Y)*s.stride + (px-s.rect.Min.X)*s.channels
+		for c := range values {
+			values[c] = float64(s.pix[i+c])
+		}
+		return
+	}
+	var x0, y0 int
+	x0, s.weightsX = s.taps(x, s.scaleX, s.weightsX)
+	y0, s.weightsY = s.taps(y, s.scaleY, s.weightsY)
+	total := 0.0
+	for j, wy := range s.weightsY {
+		py := clampInt(y0+j, s.rect.Min.Y, s.rect.Max.Y-1)
+		for i, wx := range s.weightsX {
+			w := wx * wy
+			total += w
+			if w == 0 {
+				continue
+			}
+			px := clampInt(x0+i, s.rect.Min.X, s.rect.Max.X-1)
+			k := (py-s.rect.Min.Y)*s.stride + (px-s.rect.Min.X)*s.channels
+			for c := range values {
+				values[c] += w * float64(s.pix[k+c])
+			}
+		}
+	}
+	if total != 0 {
+		for c := range values {
+			values[c] /= total
+		}
+	}
+}
+
+func toByte(v float64) uint8 {
+	return uint8(ClampFloat(v+0.5, 0, 255))
+}
+
+// TransformImage maps the image through m, the result covers the transformed bounds
+func TransformImage(src *BGRA, m Affine, filter Filter) *BGRA {
+	dst := NewBGRA(m.Bounds(src.Rect))
+	inverse, ok := m.Invert()
+	if !ok {
+		return dst
+	}
+	s := newSampler(src.Pix, src.Stride, src.Rect, 4, filter, inverse)
+	values := make([]float64, 4)
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		i := dst.PixOffset(dst.Rect.Min.X, y)
+		for x := dst.Rect.Min.X; x < dst.Rect.Max.X; x++ {
+			sx, sy := inverse.Apply(float64(x)+0.5, float64(y)+0.5)
+			s.at(sx, sy, values)
+			alpha := toByte(values[3])
+			for c := 0; c < 3; c++ {
+				// Sharp filters overshoot, colors can't exceed the alpha they are
+				// premultiplied with
+				dst.Pix[i+c] = minUint8(toByte(values[c]), alpha)
+			}
+			dst.Pix[i+3] = alpha
+			i += 4
+		}
+	}
+	return dst
+}
+
+// TransformMask maps the mask through m like TransformImage does for images
+func TransformMask(src *image.Alpha, m Affine, filter Filter) *image.Alpha {
+	dst := image.NewAlpha(m.Bounds(src.Rect))
+	inverse, ok := m.Invert()
+	if !ok {
+		return dst
+	}
+	s := newSampler(src.Pix, src.Stride, src.Rect, 1, filter, inverse)
+	values := make([]float64, 1)
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		i := dst.PixOffset(dst.Rect.Min.X, y)
+		for x := dst.Rect.Min.X; x < dst.Rect.Max.X; x++ {
+			sx, sy := inverse.Apply(float64(x)+0.5, float64(y)+0.5)
+			s.at(sx, sy, values)
+			dst.Pix[i] = toByte(values[0])
+			i++
+		}
+	}
+	return dst
+}
+
+func minUint8(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
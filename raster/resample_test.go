@@ -0,0 +1,129 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestFilterWeights(t *testing.T) {
+	tests := []struct {
+		filter Filter
+		t      float64
+		want   float64
+	}{
+		{FilterNearest, 0, 1},
+		{FilterNearest, 0.4, 1},
+		{FilterNearest, 0.5, 0},
+		{FilterBilinear, 0, 1},
+		{FilterBilinear, 0.25, 0.75},
+		{FilterBilinear, -0.25, 0.75},
+		{FilterBilinear, 1, 0},
+		{FilterBicubic, 0, 1},
+		{FilterBicubic, 0.5, 0.5625},
+		{FilterBicubic, 1, 0},
+		{FilterBicubic, 1.5, -0.0625},
+		{FilterBicubic, 2, 0},
+		{FilterLanczos, 0, 1},
+		{FilterLanczos, 0.5, 0.6079271},
+		{FilterLanczos, 1, 0},
+		{FilterLanczos, 1.5, -0.1350949},
+		{FilterLanczos, 2, 0},
+		{FilterLanczos, 3, 0},
+	}
+	for _, test := range tests {
+		if got := test.filter.weight(test.t); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("%v: weight(%v) = %v, want %v", test.filter, test.t, got, test.want)
+		}
+	}
+}
+
+func TestFilterWeightsSumToOne(t *testing.T) {
+	// Interpolating a flat color keeps it flat
+	for _, filter := range []Filter{FilterBilinear, FilterBicubic} {
+		for _, offset := range []float64{0, 0.1, 0.25, 0.5, 0.9} {
+			sum := 0.0
+			for k := -3; k <= 3; k++ {
+				sum += filter.weight(float64(k) + offset)
+			}
+			if math.Abs(sum-1) > 1e-9 {
+				t.Errorf("%v: weights at offset %v sum to %v", filter, offset, sum)
+			}
+		}
+	}
+}
+
+// grayRow returns an opaque image one pixel tall with the given gray levels
+func grayRow(levels ...uint8) *BGRA {
+	p := NewBGRA(image.Rect(0, 0, len(levels), 1))
+	for x, v := range levels {
+		Fill(p, image.Rect(x, 0, x+1, 1), color.NRGBA{v, v, v, 255})
+	}
+	return p
+}
+
+func resizeRow(src *BGRA, width int, filter Filter) []uint8 {
+	dst := TransformImage(src, ResizeTransform(src.Rect, width, 1, 0, 0), filter)
+	levels := make([]uint8, dst.Rect.Dx())
+	for x := range levels {
+		levels[x] = dst.RGBAAt(x, 0).G
+	}
+	return levels
+}
+
+func TestResampleKernels(t *testing.T) {
+	step := grayRow(0, 255)
+	ramp := grayRow(0, 100, 200, 255)
+	bar := grayRow(0, 0, 255, 255, 0, 0)
+	tests := []struct {
+		filter Filter
+		src    *BGRA
+		width  int
+		want   []uint8
+	}{
+		{FilterNearest, step, 4, []uint8{0, 0, 255, 255}},
+		{FilterNearest, ramp, 2, []uint8{100, 255}},
+		{FilterBilinear, step, 4, []uint8{0, 64, 191, 255}},
+		{FilterBilinear, ramp, 2, []uint8{63, 215}},
+		{FilterBicubic, step, 4, []uint8{0, 52, 203, 255}},
+		{FilterBicubic, ramp, 2, []uint8{54, 226}},
+		{FilterBicubic, bar, 12, []uint8{0, 0, 0, 52, 203, 255, 255, 203, 52, 0, 0, 0}},
+		{FilterLanczos, step, 4, []uint8{0, 54, 201, 255}},
+		{FilterLanczos, ramp, 2, []uint8{51, 230}},
+		// The ringing of Lanczos shows up as the 8 next to the edges
+		{FilterLanczos, bar, 12, []uint8{8, 0, 0, 52, 194, 255, 255, 194, 52, 0, 0, 8}},
+	}
+	for _, test := range tests {
+		got := resizeRow(test.src, test.width, test.filter)
+		if string(got) != string(test.want) {
+			t.Errorf("%v: %d to %d pixels = %v, want %v", test.filter, test.src.Rect.Dx(), test.width, got, test.want)
+		}
+	}
+}
+
+func TestResampleIdentity(t *testing.T) {
+	// Every kernel is 1 at its center and 0 at the other pixel centers
+	src := grayRow(0, 30, 255, 7, 128)
+	for filter := Filter(0); int(filter) < GetFilterCount(); filter++ {
+		dst := TransformImage(src, Identity(), filter)
+		if string(dst.Pix) != string(src.Pix) {
+			t.Errorf("%v changes the image when nothing is transformed", filter)
+		}
+	}
+}
+
+func TestResamplePremultiplied(t *testing.T) {
+	// Transparent next to opaque white overshoots with the sharp kernels, colors still
+	// stay below their alpha
+	src := NewBGRA(image.Rect(0, 0, 4, 4))
+	Fill(src, image.Rect(2, 0, 4, 4), color.NRGBA{255, 255, 255, 255})
+	for filter := Filter(0); int(filter) < GetFilterCount(); filter++ {
+		dst := TransformImage(src, ResizeTransform(src.Rect, 13, 13, 0.3, 0), filter)
+		for i := 0; i < len(dst.Pix); i += 4 {
+			if a := dst.Pix[i+3]; dst.Pix[i] > a || dst.Pix[i+1] > a || dst.Pix[i+2] > a {
+				t.Fatalf("%v: pixel %v has colors above its alpha", filter, dst.Pix[i:i+4])
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package raster
+
+import (
+	"image"
+	"image/draw"
+)
+
+// FromImage converts any image into a new BGRA image with its origin at (0, 0)
+func FromImage(src image.Image) *BGRA {
+	bounds := src.Bounds()
+	dst := NewBGRA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Rect, src, bounds.Min, draw.Src)
+	return dst
+}
+
+// Crop returns a copy of the rectangle of the image, the result has its origin at (0, 0)
+func Crop(src *BGRA, rect image.Rectangle) *BGRA {
+	rect = rect.Intersect(src.Rect)
+	dst := NewBGRA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	WriteRect(dst, dst.Rect, ReadRect(src, rect))
+	return dst
+}
+
+// transform builds a new image of the given size where every pixel (x, y) is taken
+// from the source pixel returned by at
+func transform(src *BGRA, width, height int, at func(x, y int) (int, int)) *BGRA {
+	dst := NewBGRA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		di := dst.PixOffset(0, y)
+		for x := 0; x < width; x++ {
+			sx, sy := at(x, y)
+			si := src.PixOffset(src.Rect.Min.X+sx, src.Rect.Min.Y+sy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+			di += 4
+		}
+	}
+	return dst
+}
+
+// RotateRight turns the image 90 degrees clockwise
+func RotateRight(src *BGRA) *BGRA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	return transform(src, h, w, func(x, y int) (int, int) {
+		return y, h - 1 - x
+	})
+}
+
+// RotateLeft turns the image 90 degrees counterclockwise
+func RotateLeft(src *BGRA) *BGRA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	return transform(src, h, w, func(x, y int) (int, int) {
+		return w - 1 - y, x
+	})
+}
+
+func Rotate180(src *BGRA) *BGRA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	return transform(src, w, h, func(x, y int) (int, int) {
+		return w - 1 - x, h - 1 - y
+	})
+}
+
+// FlipHorizontal mirrors the image from left to right
+func FlipHorizontal(src *BGRA) *BGRA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	return transform(src, w, h, func(x, y int) (int, int) {
+		return w - 1 - x, y
+	})
+}
+
+// FlipVertical mirrors the image from top to bottom
+func FlipVertical(src *BGRA) *BGRA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	return transform(src, w, h, func(x, y int) (int, int) {
+		return x, h - 1 - y
+	})
+}
+
+// Invert inverts the colors inside the rectangle and leaves the alpha untouched
+func Invert(p *BGRA, rect image.Rectangle) {
+	rect = rect.Intersect(p.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := p.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			// Colors are premultiplied, so we invert against the alpha
+			a := p.Pix[i+3]
+			for c := 0; c < 3; c++ {
+				if p.Pix[i+c] > a {
+					p.Pix[i+c] = a
+				}
+				p.Pix[i+c] = a - p.Pix[i+c]
+			}
+			i += 4
+		}
+	}
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// ClampFloat limits v to the range from min to max
+func ClampFloat(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,59 @@
+package raster
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestLosslessTurnsRoundTrip(t *testing.T) {
+	img := newTestImage(5, 3)
+	tests := []struct {
+		name  string
+		turn  func(src *BGRA) *BGRA
+		times int
+	}{
+		{"right", RotateRight, 4},
+		{"left", RotateLeft, 4},
+		{"180", Rotate180, 2},
+		{"horizontal flip", FlipHorizontal, 2},
+		{"vertical flip", FlipVertical, 2},
+	}
+	for _, test := range tests {
+		got := img
+		for i := 0; i < test.times; i++ {
+			got = test.turn(got)
+		}
+		if got.Rect != img.Rect || !bytes.Equal(got.Pix, img.Pix) {
+			t.Errorf("%s %d times doesn't give the image back", test.name, test.times)
+		}
+		if once := test.turn(img); bytes.Equal(once.Pix, img.Pix) {
+			t.Errorf("%s once didn't change the image", test.name)
+		}
+	}
+	if got := RotateLeft(RotateRight(img)); !bytes.Equal(got.Pix, img.Pix) {
+		t.Error("turning left undoes no turn to the right")
+	}
+}
+
+func TestRotateSwapsSize(t *testing.T) {
+	img := newTestImage(5, 3)
+	for name, turn := range map[string]func(src *BGRA) *BGRA{"right": RotateRight, "left": RotateLeft} {
+		turned := turn(img)
+		if turned.Rect != image.Rect(0, 0, 3, 5) {
+			t.Fatalf("turned %s the bounds are %v, want 3x5", name, turned.Rect)
+		}
+	}
+	// The top left corner ends up top right when turning right and bottom left when
+	// turning left
+	corner := img.RGBAAt(0, 0)
+	if got := RotateRight(img).RGBAAt(2, 0); got != corner {
+		t.Errorf("turned right the top right pixel is %v, want %v", got, corner)
+	}
+	if got := RotateLeft(img).RGBAAt(0, 4); got != corner {
+		t.Errorf("turned left the bottom left pixel is %v, want %v", got, corner)
+	}
+	if got := Rotate180(img).Rect; got != img.Rect {
+		t.Errorf("turned around the bounds are %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+package raster
+
+import (
+	"image"
+)
+
+// TrimOptions controls which borders an auto-trim cuts off
+type TrimOptions struct {
+	// Cut the fully transparent borders instead of the ones of the top left corner color
+	Transparent bool
+	// Largest difference of any channel to the corner color that still counts as
+	// border, like FloodOptions.Tolerance
+	Tolerance int
+	// How many pixels of the border to keep around the content
+	Padding int
+}
+
+// TrimBounds returns the part of the image left once its uniform borders are cut off,
+// the whole image if there are none and an empty rectangle if it is all border
+func TrimBounds(p *BGRA, options TrimOptions) image.Rectangle {
+	if p.Rect.Empty() {
+		return image.Rectangle{}
+	}
+	corner := p.RGBAAt(p.Rect.Min.X, p.Rect.Min.Y)
+	border := func(i int) bool {
+		if options.Transparent {
+			return p.Pix[i+3] == 0
+		}
+		return colorDistance(p, i, corner) <= options.Tolerance
+	}
+	bounds := image.Rectangle{}
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		i := p.PixOffset(p.Rect.Min.X, y)
+		found := false
+		x0, x1 := 0, 0
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			if !border(i) {
+				if !found {
+					x0, found = x, true
+				}
+				x1 = x + 1
+			}
+			i += 4
+		}
+		if found {
+			bounds = bounds.Union(image.Rect(x0, y, x1, y+1))
+		}
+	}
+	if bounds.Empty() {
+		return bounds
+	}
+	return bounds.Inset(-options.Padding).Intersect(p.Rect)
+}
@@ -0,0 +1,90 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestTrimBounds(t *testing.T) {
+	transparent := TrimOptions{Transparent: true}
+	tests := []struct {
+		name    string
+		rows    []string
+		options TrimOptions
+		want    image.Rectangle
+	}{
+		{"all transparent", []string{
+			"    ",
+			"    ",
+		}, transparent, image.Rectangle{}},
+		{"all one color", []string{
+			"....",
+			"....",
+		}, TrimOptions{}, image.Rectangle{}},
+		{"single pixel", []string{
+			"    ",
+			"  # ",
+			"    ",
+		}, transparent, image.Rect(2, 1, 3, 2)},
+		{"single pixel with padding", []string{
+			"     ",
+			"  #  ",
+			"     ",
+			"     ",
+		}, TrimOptions{Transparent: true, Padding: 1}, image.Rect(1, 0, 4, 3)},
+		{"padding stops at the edges", []string{
+			"#   ",
+			"    ",
+		}, TrimOptions{Transparent: true, Padding: 3}, image.Rect(0, 0, 4, 2)},
+		{"touching the left", []string{
+			"    ",
+			"#   ",
+			"    ",
+		}, transparent, image.Rect(0, 1, 1, 2)},
+		{"touching the right", []string{
+			"    ",
+			"   #",
+			"    ",
+		}, transparent, image.Rect(3, 1, 4, 2)},
+		{"touching the top", []string{
+			" #  ",
+			"    ",
+		}, transparent, image.Rect(1, 0, 2, 1)},
+		{"touching the bottom", []string{
+			"    ",
+			" #  ",
+		}, transparent, image.Rect(1, 1, 2, 2)},
+		{"touching every edge", []string{
+			" #  ",
+			"#  #",
+			"  # ",
+		}, transparent, image.Rect(0, 0, 4, 3)},
+		{"corner color", []string{
+			"....",
+			".#m.",
+			"....",
+		}, TrimOptions{}, image.Rect(1, 1, 3, 2)},
+		{"within the tolerance", []string{
+			"..g.",
+			".#..",
+			"....",
+		}, TrimOptions{Tolerance: 20}, image.Rect(1, 1, 2, 2)},
+	}
+	for _, test := range tests {
+		if got := TrimBounds(parseImage(test.rows...), test.options); got != test.want {
+			t.Errorf("%s: trimmed to %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTrimBoundsOffsetAndEmpty(t *testing.T) {
+	p := NewBGRA(image.Rect(10, 20, 14, 23))
+	Fill(p, image.Rect(11, 22, 12, 23), color.NRGBA{0, 0, 0, 255})
+	if got := TrimBounds(p, TrimOptions{Transparent: true}); got != image.Rect(11, 22, 12, 23) {
+		t.Errorf("trimmed to %v, want the pixel in image coordinates", got)
+	}
+	if got := TrimBounds(NewBGRA(image.Rectangle{}), TrimOptions{}); !got.Empty() {
+		t.Errorf("an empty image trimmed to %v", got)
+	}
+}
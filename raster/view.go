@@ -0,0 +1,133 @@
+package raster
+
+import (
+	"image"
+	"strconv"
+)
+
+// Zoom is the scale the image is shown at, as the fraction Num/Den
+type Zoom struct {
+	Num, Den int
+}
+
+// ZoomActual shows the image pixel for pixel
+var ZoomActual = Zoom{1, 1}
+
+// ZoomLevels are the steps zooming in and out goes through, from 12.5% to 3200%
+var ZoomLevels = []Zoom{
+	{1, 8}, {1, 4}, {1, 2}, {1, 1}, {3, 2}, {2, 1}, {3, 1}, {4, 1},
+	{6, 1}, {8, 1}, {12, 1}, {16, 1}, {24, 1}, {32, 1},
+}
+
+// Percent returns the zoom in percent, 12.5 for 1/8
+func (zoom Zoom) Percent() float64 {
+	return float64(zoom.Num) * 100 / float64(zoom.Den)
+}
+
+func (zoom Zoom) String() string {
+	return strconv.FormatFloat(zoom.Percent(), 'f', -1, 64) + "%"
+}
+
+// Shrinks tells whether several image pixels share a screen pixel
+func (zoom Zoom) Shrinks() bool {
+	return zoom.Num < zoom.Den
+}
+
+// In returns the next bigger zoom level, or the biggest one
+func (zoom Zoom) In() Zoom {
+	for _, level := range ZoomLevels {
+		if level.Num*zoom.Den > zoom.Num*level.Den {
+			return level
+		}
+	}
+	return ZoomLevels[len(ZoomLevels)-1]
+}
+
+// Out returns the next smaller zoom level, or the smallest one
+func (zoom Zoom) Out() Zoom {
+	for i := len(ZoomLevels) - 1; i >= 0; i-- {
+		if level := ZoomLevels[i]; level.Num*zoom.Den < zoom.Num*level.Den {
+			return level
+		}
+	}
+	return ZoomLevels[0]
+}
+
+// floorDiv divides rounding towards minus infinity, so the pixels left of or above
+// the origin map the same way as the others
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func ceilDiv(a, b int) int {
+	return -floorDiv(-a, b)
+}
+
+// Scale returns the zoomed coordinate of the image coordinate v, that is where the
+// image pixel v starts on the screen. It rounds up so that Unscale is its exact inverse,
+// though only at 100% and above: zoomed out several pixels share a screen pixel
+func (zoom Zoom) Scale(v int) int {
+	return ceilDiv(v*zoom.Num, zoom.Den)
+}
+
+// Unscale returns the image pixel the zoomed coordinate v falls into
+func (zoom Zoom) Unscale(v int) int {
+	return floorDiv(v*zoom.Den, zoom.Num)
+}
+
+// Size returns the zoomed size of an image of the given size, at least one pixel
+// for anything not empty
+func (zoom Zoom) Size(size image.Point) image.Point {
+	scale := func(v int) int {
+		if v <= 0 {
+			return 0
+		}
+		return maxInt(zoom.Scale(v), 1)
+	}
+	return image.Pt(scale(size.X), scale(size.Y))
+}
+
+// View maps between the image and a window showing a part of the zoomed image, Origin
+// is the zoomed point shown at the top left corner of the window
+type View struct {
+	Zoom   Zoom
+	Origin image.Point
+}
+
+// ToImage returns the image pixel under the window point
+func (view View) ToImage(pt image.Point) image.Point {
+	pt = pt.Add(view.Origin)
+	return image.Pt(view.Zoom.Unscale(pt.X), view.Zoom.Unscale(pt.Y))
+}
+
+// ToWindow returns the window point where the image pixel starts
+func (view View) ToWindow(pt image.Point) image.Point {
+	return image.Pt(view.Zoom.Scale(pt.X), view.Zoom.Scale(pt.Y)).Sub(view.Origin)
+}
+
+// RectToImage returns the image pixels that the window rectangle touches, even partly
+func (view View) RectToImage(rect image.Rectangle) image.Rectangle {
+	if rect.Empty() {
+		return image.Rectangle{}
+	}
+	// From the pixel under the first window point to the one under the last
+	min := view.ToImage(rect.Min)
+	max := view.ToImage(rect.Max.Sub(image.Pt(1, 1))).Add(image.Pt(1, 1))
+	return image.Rectangle{Min: min, Max: max}
+}
+
+// RectToWindow returns where the image rectangle is shown in the window
+func (view View) RectToWindow(rect image.Rectangle) image.Rectangle {
+	return image.Rectangle{view.ToWindow(rect.Min), view.ToWindow(rect.Max)}
+}
+
+// Rescroll returns the scroll position that keeps the same image point under anchor
+// after changing the zoom, anchor is relative to the scrolled content
+func Rescroll(scroll, anchor int, from, to Zoom) int {
+	v := scroll + anchor
+	return floorDiv(v*to.Num*from.Den, to.Den*from.Num) - anchor
+}
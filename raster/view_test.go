@@ -0,0 +1,118 @@
+package raster
+
+import (
+	"image"
+	"testing"
+)
+
+func TestZoomScaleUnscale(t *testing.T) {
+	for _, zoom := range ZoomLevels {
+		for v := -40; v <= 40; v++ {
+			w := zoom.Scale(v)
+			// The screen pixel where an image pixel starts shows that pixel, when zoomed
+			// out it shows the last of the pixels sharing it
+			got := zoom.Unscale(w)
+			if zoom.Shrinks() {
+				if got < v || got >= v+zoom.Den/zoom.Num {
+					t.Errorf("%v: Unscale(Scale(%d)) = %d", zoom, v, got)
+				}
+			} else if got != v {
+				t.Errorf("%v: Unscale(Scale(%d)) = %d, want %d", zoom, v, got, v)
+			}
+			// Every screen pixel maps into the image pixel it is drawn with
+			if p := zoom.Unscale(w); zoom.Scale(p) > w || zoom.Scale(p+1) <= w {
+				t.Errorf("%v: screen pixel %d is outside of image pixel %d", zoom, w, p)
+			}
+		}
+	}
+}
+
+func TestZoomNegative(t *testing.T) {
+	zoom := Zoom{3, 2}
+	// Left of the origin the pixels map just like on the right
+	if got := zoom.Unscale(-1); got != -1 {
+		t.Errorf("Unscale(-1) = %d, want -1", got)
+	}
+	if got := zoom.Scale(-1); got != -1 {
+		t.Errorf("Scale(-1) = %d, want -1", got)
+	}
+	if got := (Zoom{1, 4}).Unscale(-1); got != -4 {
+		t.Errorf("25%%: Unscale(-1) = %d, want -4", got)
+	}
+}
+
+func TestZoomLevels(t *testing.T) {
+	zoom := ZoomActual
+	if got := zoom.In(); got != (Zoom{3, 2}) {
+		t.Errorf("In from 100%% = %v", got)
+	}
+	if got := zoom.Out(); got != (Zoom{1, 2}) {
+		t.Errorf("Out from 100%% = %v", got)
+	}
+	// Zoom levels in between snap to the next one
+	if got := (Zoom{5, 4}).In(); got != (Zoom{3, 2}) {
+		t.Errorf("In from 125%% = %v", got)
+	}
+	if got := (Zoom{5, 4}).Out(); got != ZoomActual {
+		t.Errorf("Out from 125%% = %v", got)
+	}
+	first, last := ZoomLevels[0], ZoomLevels[len(ZoomLevels)-1]
+	if first.Out() != first || last.In() != last {
+		t.Error("zooming past the first or the last level doesn't stop there")
+	}
+	if got := (Zoom{1, 8}).String(); got != "12.5%" {
+		t.Errorf("String() = %q, want 12.5%%", got)
+	}
+}
+
+func TestZoomSize(t *testing.T) {
+	tests := []struct {
+		zoom Zoom
+		size image.Point
+		want image.Point
+	}{
+		{ZoomActual, image.Pt(640, 480), image.Pt(640, 480)},
+		{Zoom{3, 2}, image.Pt(5, 3), image.Pt(8, 5)},
+		{Zoom{1, 8}, image.Pt(100, 4), image.Pt(13, 1)},
+		{Zoom{1, 8}, image.Pt(1, 0), image.Pt(1, 0)},
+	}
+	for _, test := range tests {
+		if got := test.zoom.Size(test.size); got != test.want {
+			t.Errorf("%v: Size(%v) = %v, want %v", test.zoom, test.size, got, test.want)
+		}
+	}
+}
+
+func TestViewMapping(t *testing.T) {
+	view := View{Zoom: Zoom{4, 1}, Origin: image.Pt(10, 20)}
+	if got := view.ToImage(image.Pt(0, 0)); got != image.Pt(2, 5) {
+		t.Errorf("ToImage(0, 0) = %v, want (2,5)", got)
+	}
+	if got := view.ToWindow(image.Pt(2, 5)); got != image.Pt(-2, 0) {
+		t.Errorf("ToWindow(2, 5) = %v, want (-2,0)", got)
+	}
+	// A window rectangle touching two pixels partly gets both of them
+	if got := view.RectToImage(image.Rect(0, 0, 4, 1)); got != image.Rect(2, 5, 4, 6) {
+		t.Errorf("RectToImage = %v, want (2,5)-(4,6)", got)
+	}
+	if got := view.RectToImage(image.Rectangle{}); !got.Empty() {
+		t.Errorf("RectToImage of nothing = %v", got)
+	}
+	if got := view.RectToWindow(image.Rect(2, 5, 4, 6)); got != image.Rect(-2, 0, 6, 4) {
+		t.Errorf("RectToWindow = %v, want (-2,0)-(6,4)", got)
+	}
+}
+
+func TestRescroll(t *testing.T) {
+	// The image point under the anchor stays under it
+	from, to := ZoomActual, Zoom{2, 1}
+	scroll, anchor := 100, 50
+	pt := from.Unscale(scroll + anchor)
+	after := Rescroll(scroll, anchor, from, to)
+	if got := to.Unscale(after + anchor); got != pt {
+		t.Errorf("image point under the anchor moved from %d to %d", pt, got)
+	}
+	if got := Rescroll(scroll, anchor, to, from); got != 25 {
+		t.Errorf("zooming back out scrolls to %d, want 25", got)
+	}
+}
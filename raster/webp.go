@@ -0,0 +1,404 @@
+package raster
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"math/bits"
+)
+
+// The lossless WebP format stores width and height in 14 bits
+const maxWebPSize = 1 << 14
+
+// Predictor modes are chosen for tiles of 1<<predictorBits pixels
+const predictorBits = 4
+
+// Alphabet sizes of the five prefix codes: green with the length prefixes, red, blue,
+// alpha and the distance prefixes
+const (
+	lengthPrefixCount   = 24
+	distancePrefixCount = 40
+)
+
+// LZ77 parameters, the window is far below the 1<<20 allowed by the format
+const (
+	lzMinLength = 3
+	lzMaxLength = 4096
+	lzWindow    = 1 << 16
+	lzMaxChain  = 32
+	lzHashBits  = 16
+)
+
+// Short distances are coded as (x, y) offsets to the neighbouring pixels using this
+// table, any other distance d is coded as d+120
+var webpDistanceTable = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// EncodeWebP writes the image as a lossless WebP (VP8L) file, alpha included
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > maxWebPSize || height > maxWebPSize {
+		return errors.New("webp: image size must be between 1 and 16384 pixels")
+	}
+	// Straight alpha RGBA bytes, like the decoder produces them
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	pix := nrgba.Pix
+
+	alphaUsed := uint32(0)
+	for i := 3; i < len(pix); i += 4 {
+		if pix[i] != 0xff {
+			alphaUsed = 1
+			break
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(alphaUsed, 1)
+	bw.write(0, 3)
+
+	// The decoder undoes the transforms in reverse order, so the subtract green
+	// transform has to be listed first
+	subtractGreen(pix)
+	bw.write(1, 1)
+	bw.write(2, 2)
+
+	modes, residuals := predict(pix, width, height)
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(predictorBits-2, 3)
+	writeWebPPixels(bw, modes, tileCount(width), false)
+
+	bw.write(0, 1)
+	writeWebPPixels(bw, residuals, width, true)
+	data := bw.flush()
+
+	size := len(data)
+	padding := size & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+size+padding))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(size))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if padding > 0 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func tileCount(size int) int {
+	return (size + 1<<predictorBits - 1) >> predictorBits
+}
+
+// subtractGreen removes the green channel from red and blue, which makes them
+// smaller numbers for most images
+func subtractGreen(pix []uint8) {
+	for i := 0; i < len(pix); i += 4 {
+		pix[i+0] -= pix[i+1]
+		pix[i+2] -= pix[i+1]
+	}
+}
+
+func average2(a, b uint8) uint8 {
+	return uint8((int(a) + int(b)) / 2)
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// predictPixel returns the prediction of the pixel at offset p for one of the 14
+// predictor modes, the caller handles the first row and column
+func predictPixel(pix []uint8, p, stride, mode int) (prediction [4]uint8) {
+	top := p - stride
+	for c := 0; c < 4; c++ {
+		left, t, topLeft, topRight := pix[p-4+c], pix[top+c], pix[top-4+c], pix[top+4+c]
+		switch mode {
+		case 0:
+			if c == 3 {
+				prediction[c] = 0xff
+			}
+		case 1:
+			prediction[c] = left
+		case 2:
+			prediction[c] = t
+		case 3:
+			prediction[c] = topRight
+		case 4:
+			prediction[c] = topLeft
+		case 5:
+			prediction[c] = average2(average2(left, topRight), t)
+		case 6:
+			prediction[c] = average2(left, topLeft)
+		case 7:
+			prediction[c] = average2(left, t)
+		case 8:
+			prediction[c] = average2(topLeft, t)
+		case 9:
+			prediction[c] = average2(t, topRight)
+		case 10:
+			prediction[c] = average2(average2(left, topLeft), average2(t, topRight))
+		case 11:
+			// Select: take whichever of left and top is closer to the gradient estimate
+			distanceLeft, distanceTop := 0, 0
+			for k := 0; k < 4; k++ {
+				distanceLeft += absInt(int(pix[top-4+k]) - int(pix[top+k]))
+				distanceTop += absInt(int(pix[top-4+k]) - int(pix[p-4+k]))
+			}
+			if distanceLeft < distanceTop {
+				prediction[c] = left
+			} else {
+				prediction[c] = t
+			}
+		case 12:
+			prediction[c] = uint8(clampInt(int(left)+int(t)-int(topLeft), 0, 255))
+		case 13:
+			a := int(average2(left, t))
+			prediction[c] = uint8(clampInt(a+(a-int(topLeft))/2, 0, 255))
+		}
+	}
+	return
+}
+
+// predict picks the predictor mode that leaves the smallest residuals for every tile.
+// It returns the tile modes as an image (the mode goes into green) and the residuals
+func predict(pix []uint8, width, height int) (modes []uint8, residuals []uint8) {
+	stride := 4 * width
+	tilesX, tilesY := tileCount(width), tileCount(height)
+	modes = make([]uint8, 4*tilesX*tilesY)
+	residuals = make([]uint8, len(pix))
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := maxInt(tx<<predictorBits, 1), maxInt(ty<<predictorBits, 1)
+			x1, y1 := minInt((tx+1)<<predictorBits, width), minInt((ty+1)<<predictorBits, height)
+			bestMode, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						p := y*stride + 4*x
+						prediction := predictPixel(pix, p, stride, mode)
+						for c := 0; c < 4; c++ {
+							cost += absInt(int(int8(pix[p+c] - prediction[c])))
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					bestMode, bestCost = mode, cost
+				}
+			}
+			i := 4 * (ty*tilesX + tx)
+			modes[i+1] = uint8(bestMode)
+			modes[i+3] = 0xff
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := y*stride + 4*x
+			var prediction [4]uint8
+			switch {
+			case x == 0 && y == 0:
+				prediction[3] = 0xff
+			case y == 0:
+				copy(prediction[:], pix[p-4:p])
+			case x == 0:
+				copy(prediction[:], pix[p-stride:p-stride+4])
+			default:
+				mode := modes[4*((y>>predictorBits)*tilesX+(x>>predictorBits))+1]
+				prediction = predictPixel(pix, p, stride, int(mode))
+			}
+			for c := 0; c < 4; c++ {
+				residuals[p+c] = pix[p+c] - prediction[c]
+			}
+		}
+	}
+	return
+}
+
+// prefixCode splits a length or distance value into its prefix symbol and the extra
+// bits following it
+func prefixCode(value int) (symbol int, extraBits uint, extra uint32) {
+	if value <= 4 {
+		return value - 1, 0, 0
+	}
+	d := value - 1
+	highest := bits.Len(uint(d)) - 1
+	second := (d >> (highest - 1)) & 1
+	extraBits = uint(highest - 1)
+	extra = uint32(d & (1<<extraBits - 1))
+	return 2*highest + second, extraBits, extra
+}
+
+// webpToken is either a literal pixel or a backward reference
+type webpToken struct {
+	// Offset of the literal pixel, or -1 for a backward reference
+	pixel    int
+	length   int
+	distance int
+}
+
+// distanceCodes maps the pixel distances that have a short code for this width
+func distanceCodes(width int) map[int]int {
+	codes := make(map[int]int)
+	for code := len(webpDistanceTable); code >= 1; code-- {
+		entry := int(webpDistanceTable[code-1])
+		d := (entry>>4)*width + 8 - entry&0xf
+		if d < 1 {
+			d = 1
+		}
+		codes[d] = code
+	}
+	return codes
+}
+
+// findMatches turns the pixels into literals and backward references using a hash
+// chain over runs of lzMinLength pixels
+func findMatches(pix []uint8, width int) []webpToken {
+	n := len(pix) / 4
+	argb := make([]uint32, n)
+	for i := range argb {
+		argb[i] = binary.LittleEndian.Uint32(pix[4*i:])
+	}
+	hash := func(i int) uint32 {
+		h := argb[i]*0x9E3779B1 ^ argb[i+1]*0x85EBCA77 ^ argb[i+2]*0xC2B2AE3D
+		return h >> (32 - lzHashBits)
+	}
+	head := make([]int32, 1<<lzHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	chain := make([]int32, n)
+	insert := func(i int) {
+		if i+lzMinLength <= n {
+			h := hash(i)
+			chain[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLength := func(i, j int) int {
+		limit := minInt(lzMaxLength, n-i)
+		length := 0
+		for length < limit && argb[i+length] == argb[j+length] {
+			length++
+		}
+		return length
+	}
+
+	tokens := make([]webpToken, 0, n/2)
+	for i := 0; i < n; {
+		bestLength, bestDistance := 0, 0
+		if i+lzMinLength <= n {
+			// The left and the top pixel are the cheapest distances, try them first
+			for _, d := range []int{1, width} {
+				if d <= i {
+					if length := matchLength(i, i-d); length > bestLength {
+						bestLength, bestDistance = length, d
+					}
+				}
+			}
+			j := int(head[hash(i)])
+			for steps := 0; j >= 0 && i-j <= lzWindow && steps < lzMaxChain; steps++ {
+				if length := matchLength(i, j); length > bestLength {
+					bestLength, bestDistance = length, i-j
+				}
+				j = int(chain[j])
+			}
+		}
+		if bestLength < lzMinLength {
+			tokens = append(tokens, webpToken{pixel: 4 * i})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, webpToken{pixel: -1, length: bestLength, distance: bestDistance})
+		for k := 0; k < bestLength; k++ {
+			insert(i + k)
+		}
+		i += bestLength
+	}
+	return tokens
+}
+
+// writeWebPPixels entropy codes an image made of (already transformed) pixels. The
+// main image can have a meta prefix code image, sub images can't
+func writeWebPPixels(bw *bitWriter, pix []uint8, width int, topLevel bool) {
+	// No color cache
+	bw.write(0, 1)
+	if topLevel {
+		// One set of prefix codes for the whole image
+		bw.write(0, 1)
+	}
+	tokens := findMatches(pix, width)
+	shortDistances := distanceCodes(width)
+	distanceValue := func(d int) int {
+		if code, found := shortDistances[d]; found {
+			return code
+		}
+		return d + len(webpDistanceTable)
+	}
+
+	green := make([]int, 256+lengthPrefixCount)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	distance := make([]int, distancePrefixCount)
+	for _, token := range tokens {
+		if token.pixel >= 0 {
+			red[pix[token.pixel+0]]++
+			green[pix[token.pixel+1]]++
+			blue[pix[token.pixel+2]]++
+			alpha[pix[token.pixel+3]]++
+			continue
+		}
+		symbol, _, _ := prefixCode(token.length)
+		green[256+symbol]++
+		symbol, _, _ = prefixCode(distanceValue(token.distance))
+		distance[symbol]++
+	}
+	greenCode := writeHuffmanCode(bw, green)
+	redCode := writeHuffmanCode(bw, red)
+	blueCode := writeHuffmanCode(bw, blue)
+	alphaCode := writeHuffmanCode(bw, alpha)
+	distanceCode := writeHuffmanCode(bw, distance)
+
+	for _, token := range tokens {
+		if token.pixel >= 0 {
+			greenCode.writeSymbol(bw, int(pix[token.pixel+1]))
+			redCode.writeSymbol(bw, int(pix[token.pixel+0]))
+			blueCode.writeSymbol(bw, int(pix[token.pixel+2]))
+			alphaCode.writeSymbol(bw, int(pix[token.pixel+3]))
+			continue
+		}
+		symbol, extraBits, extra := prefixCode(token.length)
+		greenCode.writeSymbol(bw, 256+symbol)
+		bw.write(extra, extraBits)
+		symbol, extraBits, extra = prefixCode(distanceValue(token.distance))
+		distanceCode.writeSymbol(bw, symbol)
+		bw.write(extra, extraBits)
+	}
+}
@@ -0,0 +1,119 @@
+package raster
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// roundTripWebP encodes the image and decodes it back with the reference decoder
+func roundTripWebP(t *testing.T, img *image.NRGBA) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	decoded, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.Bounds() != img.Rect {
+		t.Fatalf("decoded bounds %v, want %v", decoded.Bounds(), img.Rect)
+	}
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			want := img.NRGBAAt(x, y)
+			got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+			if got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func newNRGBA(width, height int, pixel func(x, y int) color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, pixel(x, y))
+		}
+	}
+	return img
+}
+
+func TestWebPRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"single pixel", newNRGBA(1, 1, func(x, y int) color.NRGBA {
+			return color.NRGBA{12, 34, 56, 255}
+		})},
+		{"single color", newNRGBA(37, 23, func(x, y int) color.NRGBA {
+			return color.NRGBA{200, 100, 50, 255}
+		})},
+		{"single transparent color", newNRGBA(20, 20, func(x, y int) color.NRGBA {
+			return color.NRGBA{10, 20, 30, 128}
+		})},
+		{"gradient", newNRGBA(129, 65, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 2), uint8(y * 4), uint8(x + y), 255}
+		})},
+		{"alpha gradient", newNRGBA(64, 48, func(x, y int) color.NRGBA {
+			a := uint8(x * 4)
+			if a == 0 {
+				return color.NRGBA{}
+			}
+			return color.NRGBA{uint8(y * 5), 90, uint8(x), a}
+		})},
+		{"repeated pattern", newNRGBA(300, 40, func(x, y int) color.NRGBA {
+			if (x/3+y/2)%4 == 0 {
+				return color.NRGBA{255, 255, 255, 255}
+			}
+			return color.NRGBA{0, 0, 128, 255}
+		})},
+		{"noise", newNRGBA(97, 61, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(1 + random.Intn(255))}
+		})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roundTripWebP(t, test.img)
+		})
+	}
+}
+
+func TestWebPOffsetBounds(t *testing.T) {
+	// Images not starting at the origin get written from their top left corner
+	img := newNRGBA(30, 30, func(x, y int) color.NRGBA {
+		return color.NRGBA{uint8(x * 8), uint8(y * 8), 0, 255}
+	})
+	sub := img.SubImage(image.Rect(10, 5, 25, 20))
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, sub); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decoded.Bounds(), image.Rect(0, 0, 15, 15); got != want {
+		t.Fatalf("bounds %v, want %v", got, want)
+	}
+	got := color.NRGBAModel.Convert(decoded.At(0, 0)).(color.NRGBA)
+	if want := img.NRGBAAt(10, 5); got != want {
+		t.Errorf("top left pixel %v, want %v", got, want)
+	}
+}
+
+func TestWebPSizeLimits(t *testing.T) {
+	for _, size := range []image.Rectangle{image.Rect(0, 0, 0, 10), image.Rect(0, 0, maxWebPSize+1, 1)} {
+		if err := EncodeWebP(&bytes.Buffer{}, image.NewNRGBA(size)); err == nil {
+			t.Errorf("encoding a %v image succeeded", size.Size())
+		}
+	}
+}
@@ -26,6 +26,8 @@ type Button interface {
 	Window
 	// Public
 	SetClickEventHandler(f func(sender Button))
+	IsChecked() bool
+	SetChecked(checked bool)
 }
 
 type buttonData struct {
@@ -45,6 +47,19 @@ func (btn *buttonData) SetClickEventHandler(f func(sender Button)) {
 	btn.clickEventHandler = f
 }
 
+// IsChecked tells whether a check or radio button is checked
+func (btn *buttonData) IsChecked() bool {
+	return win.SendMessage(btn.GetHandle(), win.BM_GETCHECK, 0, 0) == win.BST_CHECKED
+}
+
+func (btn *buttonData) SetChecked(checked bool) {
+	state := uintptr(win.BST_UNCHECKED)
+	if checked {
+		state = win.BST_CHECKED
+	}
+	win.SendMessage(btn.GetHandle(), win.BM_SETCHECK, state, 0)
+}
+
 // Override and handle WM_COMMAND msg for the click event
 func (button *buttonData) ReflectedMsg(reflectedFrom Window, msg uint32, wParam, lParam uintptr) {
 	switch msg {
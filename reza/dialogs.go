@@ -12,6 +12,7 @@ type Dialog interface {
 	Window
 	Initialize(parent Window, caption string, width, height int)
 	Show(modal bool, fOnAccept func())
+	ShowChecked(modal bool, fOnAccept func() bool)
 	AddWidgets(widgets []Widget)
 }
 
@@ -21,7 +22,7 @@ type dialogData struct {
 	modal     bool
 	btnOK     Button
 	btnCancel Button
-	fOnAccept func()
+	fOnAccept func() bool
 }
 
 func NewDialog() Dialog {
@@ -49,8 +50,8 @@ func (dlg *dialogData) Initialize(parent Window, caption string, width, height i
 	dlg.btnCancel.SetMargin(10, 10, 10, 10)
 	dlg.btnOK.SetMargin(10, 10, 10, 10)
 	dlg.btnOK.SetClickEventHandler(func(sender Button) {
-		if dlg.fOnAccept != nil {
-			dlg.fOnAccept()
+		if dlg.fOnAccept != nil && !dlg.fOnAccept() {
+			return
 		}
 		dlg.Hide()
 	})
@@ -75,6 +76,17 @@ func (dlg *dialogData) Hide() {
 }
 
 func (dlg *dialogData) Show(modal bool, fOnAccept func()) {
+	dlg.ShowChecked(modal, func() bool {
+		if fOnAccept != nil {
+			fOnAccept()
+		}
+		return true
+	})
+}
+
+// ShowChecked shows the dialog like Show, but it stays open when fOnAccept returns false
+// so the user can correct what was entered
+func (dlg *dialogData) ShowChecked(modal bool, fOnAccept func() bool) {
 	logInfo("Show dialog")
 	if modal && dlg.HasParent() {
 		win.EnableWindow(dlg.GetParent().GetHandle(), false)
@@ -156,5 +168,25 @@ func ChoseColorDialog(owner Window, color Color, customColors [16]Color) (result
 		}
 		return rgba, newCustomColors
 	}
-	return color, newCustomColors
+	return color, customColors
+}
+
+func messageBox(owner Window, caption, text string, flags uint32) int32 {
+	captionUTF16, _ := syscall.UTF16PtrFromString(caption)
+	textUTF16, _ := syscall.UTF16PtrFromString(text)
+	var hWnd win.HWND
+	if owner != nil {
+		hWnd = owner.GetHandle()
+	}
+	return win.MessageBox(hWnd, textUTF16, captionUTF16, flags)
+}
+
+// ShowWarning tells about something that went wrong without stopping the user
+func ShowWarning(owner Window, caption, text string) {
+	messageBox(owner, caption, text, win.MB_OK|win.MB_ICONWARNING)
+}
+
+// ShowError tells the user why something could not be done
+func ShowError(owner Window, caption, text string) {
+	messageBox(owner, caption, text, win.MB_OK|win.MB_ICONERROR)
 }
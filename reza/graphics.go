@@ -85,6 +85,11 @@ func (c *Color) AsRGBA() color.RGBA {
 }
 
 // AsString returns
+// AsNRGBA returns the color as a straight (non-premultiplied) alpha color
+func (c *Color) AsNRGBA() color.NRGBA {
+	return color.NRGBA(c.RGBA)
+}
+
 func (c *Color) AsString() string {
 	return "(" + strconv.Itoa(int(c.R)) + ", " + strconv.Itoa(int(c.G)) + ",  " + strconv.Itoa(int(c.B)) + ")"
 }
@@ -113,6 +118,11 @@ func (rc *Rect) AsRECT() win.RECT {
 	return win.RECT{Left: int32(rc.Left), Top: int32(rc.Top), Right: int32(rc.Right), Bottom: int32(rc.Bottom)}
 }
 
+// AsImageRect returns the rect as type 'image.Rectangle'
+func (rc *Rect) AsImageRect() image.Rectangle {
+	return image.Rect(rc.Left, rc.Top, rc.Right, rc.Bottom)
+}
+
 func (rc *Rect) AsPoints() (leftTop, rightBottom Point) {
 	return Point{X: rc.Left, Y: rc.Top}, Point{X: rc.Right, Y: rc.Bottom}
 }
@@ -193,6 +203,11 @@ func (pt *Point) XY(from *Point) (x, y int) {
 	return pt.X, pt.Y
 }
 
+// AsImagePoint returns the point as type 'image.Point'
+func (pt *Point) AsImagePoint() image.Point {
+	return image.Pt(pt.X, pt.Y)
+}
+
 func (pt *Point) Distance(from *Point) Point {
 	return Point{pt.X - from.X, pt.Y - from.Y}
 }
@@ -665,6 +680,18 @@ func (g *Graphics) DrawLineEx(x, y, x2, y2 int, pen *Pen) {
 	}
 }
 
+// DrawPolyline draws the open path through the points with the pen
+func (g *Graphics) DrawPolyline(points []Point, pen *Pen) {
+	if len(points) < 2 {
+		return
+	}
+	g.SelectBrushAndPen(pen, nil)
+	win.MoveToEx(g.hdc, points[0].X, points[0].Y, nil)
+	for _, pt := range points[1:] {
+		win.LineTo(g.hdc, int32(pt.X), int32(pt.Y))
+	}
+}
+
 func (g *Graphics) DrawLineOnly(x, y, x2, y2 int) {
 	win.MoveToEx(g.hdc, x, y, nil)
 	win.LineTo(g.hdc, int32(x2), int32(y2))
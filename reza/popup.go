@@ -12,6 +12,7 @@ type PopupWindow interface {
 	Init(parent Window)
 	Popup(x, y int)
 	AddItem(item PopupItem)
+	ClearItems()
 	GetItems() []PopupItem
 	SetMeasureContentSize(f func(g *Graphics) (width int, height int))
 }
@@ -105,6 +106,11 @@ func (popup *popupWindowData) AddItem(item PopupItem) {
 	popup.items = append(popup.items, item)
 }
 
+// ClearItems removes all the items
+func (popup *popupWindowData) ClearItems() {
+	popup.items = make([]PopupItem, 0)
+}
+
 func (popup *popupWindowData) SetMeasureContentSize(f func(g *Graphics) (width int, height int)) {
 	popup.MeasureContentSize = f
 }
@@ -9,6 +9,7 @@ type PopupMenu interface {
 	// embed the popup window type
 	PopupWindow
 	SetLargeItem(large bool)
+	AddItems(newItems []MenuItemInfo) PopupMenu
 }
 
 type popupMenuData struct {
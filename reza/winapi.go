@@ -276,6 +276,7 @@ var (
 	extTextOutW        *windows.LazyProc
 	createRectRgn      *windows.LazyProc
 	selectClipRgn      *windows.LazyProc
+	getClipBox         *windows.LazyProc
 )
 
 func loadApiFunctions() {
@@ -296,6 +297,7 @@ func loadApiFunctions() {
 	extTextOutW = libgdi32.NewProc("ExtTextOutW")
 	createRectRgn = libgdi32.NewProc("CreateRectRgn")
 	selectClipRgn = libgdi32.NewProc("SelectClipRgn")
+	getClipBox = libgdi32.NewProc("GetClipBox")
 	// User32 Functions
 	fillRect = libuser32.NewProc("FillRect")
 	getCapture = libuser32.NewProc("GetCapture")
@@ -332,6 +334,13 @@ func SelectClipRgn(hdc win.HDC, hrgn win.HRGN) int32 {
 	return int32(ret)
 }
 
+func GetClipBox(hdc win.HDC, rect *win.RECT) int32 {
+	ret, _, _ := getClipBox.Call(
+		uintptr(hdc),
+		uintptr(unsafe.Pointer(rect)))
+	return int32(ret)
+}
+
 func ExtTextOutW(hdc win.HDC, x, y int32, options uint32, rect *Rect, text *uint16, textCount uint32, lpDx *int32) int32 {
 	ret, _, _ := extTextOutW.Call(
 		uintptr(hdc),
@@ -71,6 +71,8 @@ type Window interface {
 	RequestLayout()
 	InvalidateRect(rect *Rect, eraseBackground bool)
 	Update()
+	StartTimer(id uintptr, milliseconds int)
+	StopTimer(id uintptr)
 	// Overridables
 	ReflectedMsg(reflectedFrom Window, msg uint32, wParam, lParam uintptr)
 	// Event Handlers
@@ -92,6 +94,7 @@ type Window interface {
 	SetSetCursorEventHandler(func() bool)
 	SetHScrollEventHandler(func(stype, position int))
 	SetVScrollEventHandler(func(stype, position int))
+	SetTimerEventHandler(func(id uintptr))
 	// only for internal use
 	asWindowData() *windowData
 }
@@ -130,6 +133,7 @@ type windowData struct {
 	SetCursorEvent       func() bool
 	HScrollEvent         func(stype, position int)
 	VScrollEvent         func(stype, position int)
+	TimerEvent           func(id uintptr)
 }
 
 func NewWindow() Window {
@@ -341,6 +345,11 @@ func appWindowProc(window *windowData, hWnd win.HWND, msg uint32, wParam, lParam
 			}
 			return 0
 		}
+	case win.WM_TIMER:
+		if window.TimerEvent != nil {
+			window.TimerEvent(wParam)
+			return 0
+		}
 	case win.WM_KILLFOCUS:
 		if window.KillFocusEvent != nil {
 			window.KillFocusEvent()
@@ -637,6 +646,9 @@ func (window *windowData) SetHScrollEventHandler(f func(stype, position int)) {
 func (window *windowData) SetVScrollEventHandler(f func(stype, position int)) {
 	window.VScrollEvent = f
 }
+func (window *windowData) SetTimerEventHandler(f func(id uintptr)) {
+	window.TimerEvent = f
+}
 
 func (window *windowData) SetFont(font win.HFONT) {
 	window.font = font
@@ -752,6 +764,16 @@ func (window *windowData) InvalidateRect(rect *Rect, eraseBackground bool) {
 	}
 }
 
+// StartTimer calls the timer event handler with the id every few milliseconds until
+// StopTimer. Starting a running timer again restarts it with the new interval
+func (window *windowData) StartTimer(id uintptr, milliseconds int) {
+	win.SetTimer(window.handle, id, uint32(milliseconds), 0)
+}
+
+func (window *windowData) StopTimer(id uintptr) {
+	win.KillTimer(window.handle, id)
+}
+
 func (window *windowData) Update() {
 	win.UpdateWindow(window.handle)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	. "gopaint/reza"
+	"image"
 )
 
 type ToolBrush struct {
@@ -46,6 +47,10 @@ func (tool *ToolBrush) changeSize(size int) {
 	tool.size = size
 }
 
+func (tool *ToolBrush) getSize() int {
+	return tool.size
+}
+
 func (tool *ToolBrush) draw(e *ToolDrawEvent) {
 	pt := e.mouse
 	g := e.gdi32
@@ -114,6 +119,10 @@ func (tool *ToolBrush) mouseMoveEvent(e *ToolMouseEvent) {
 	}
 }
 
+func (tool *ToolBrush) strokeBounds(e *ToolMouseEvent) image.Rectangle {
+	return segmentBounds(e, tool.size)
+}
+
 func (tool *ToolBrush) mouseUpEvent(e *ToolMouseEvent) {
 	mbutton := e.mbutton
 	//gc := e.context
@@ -1,12 +1,31 @@
 package main
 
 import (
+	"gopaint/raster"
 	. "gopaint/reza"
-	"image/color"
+	"image"
 )
 
+// Tolerances offered by the bucket menu, the largest channel difference on 0-255
+var bucketTolerances = [4]int{0, 26, 64, 128}
+
+// Widest outline breaks the bucket menu offers to close, in pixels
+var bucketGapSizes = [4]int{0, 2, 4, 8}
+
 type ToolBucket struct {
 	ToolBasic
+	options raster.FloodOptions
+	// Find the area on the image as it is seen instead of only on the active layer
+	sampleAllLayers bool
+	// What to fill with, the gradient and pattern settings are in mainWindow.fillStyle
+	fillKind FillKind
+	// A gradient fill follows the mouse until the button goes up, we keep the area
+	// and its pixels from before the fill to paint it again
+	region     *image.Alpha
+	bounds     image.Rectangle
+	backup     []uint8
+	startPoint Point
+	mbutton    int
 }
 
 func (tool *ToolBucket) initialize() {
@@ -18,110 +37,16 @@ func (tool *ToolBucket) Dispose() {
 }
 
 func (tool *ToolBucket) prepare() {
-
-}
-
-func (tool *ToolBucket) draw(e *ToolDrawEvent) {
-
-}
-
-type PointStack struct {
-	top  *PointElement
-	size int
-}
-
-type PointElement struct {
-	value Point
-	next  *PointElement
-}
-
-func (s *PointStack) IsEmpty() bool {
-	return s.size == 0
-}
-
-func (s *PointStack) Push(value Point) {
-	s.top = &PointElement{value, s.top}
-	s.size++
-}
-
-func (s *PointStack) Pop() (value Point) {
-	if s.size > 0 {
-		value = s.top.value
-		s.top = s.top.next
-		s.size--
-		return
-	}
-	return Point{}
-}
-
-// BGRA
-func fastSet(p *DrawingImage, i int, c *color.RGBA) {
-	p.Pix[i+0] = c.B
-	p.Pix[i+1] = c.G
-	p.Pix[i+2] = c.R
-	p.Pix[i+3] = c.A
+	tool.region = nil
 }
 
-// BGRA
-func hasSimilarColor(p *DrawingImage, i int, c *Color, tolerance int) bool {
-	/*
-		c1 := int(math.Abs(float64(c.R-p.Pix[i+2]))) <= tolerance
-		c2 := int(math.Abs(float64(c.G-p.Pix[i+1]))) <= tolerance
-		c3 := int(math.Abs(float64(c.B-p.Pix[i+0]))) <= tolerance
-		c4 := int(math.Abs(float64(c.A-p.Pix[i+3]))) <= tolerance
-		return c1 && c2 && c3 && c4*/
-	return (c.R == p.Pix[i+2] && c.G == p.Pix[i+1] && c.B == p.Pix[i+0] && c.A == p.Pix[i+3])
+func (tool *ToolBucket) leave() {
+	tool.region = nil
+	tool.backup = nil
 }
 
-func fastPixOffset(p *DrawingImage, x, y int) int {
-	return y*p.Stride + x*4
-}
+func (tool *ToolBucket) draw(e *ToolDrawEvent) {
 
-func floodFillScanline(image *DrawingImage, q Point, oldColor, newColor Color) {
-	var x1 int
-	var spanAbove, spanBelow bool
-	w, h := image.Width(), image.Height()
-	stack := new(PointStack)
-	stack.Push(q)
-	newColorRgba := newColor.AsRGBA()
-	tolerance := 50
-	for !stack.IsEmpty() {
-		p := stack.Pop()
-		y := p.Y
-		x1 = p.X
-		for {
-			pixelIndex := fastPixOffset(image, x1, y)
-			if !(x1 >= 0 && hasSimilarColor(image, pixelIndex, &oldColor, tolerance)) {
-				break
-			}
-			x1--
-		}
-		x1++
-		spanAbove, spanBelow = false, false
-		for {
-			pixelIndex := fastPixOffset(image, x1, y)
-			if !(x1 < w && hasSimilarColor(image, pixelIndex, &oldColor, tolerance)) {
-				break
-			}
-			fastSet(image, pixelIndex, &newColorRgba)
-			pixelIndex = fastPixOffset(image, x1, (y - 1))
-			if !spanAbove && y > 0 && hasSimilarColor(image, pixelIndex, &oldColor, tolerance) {
-				stack.Push(Point{X: x1, Y: y - 1})
-				spanAbove = true
-			} else if spanAbove && y > 0 && !hasSimilarColor(image, pixelIndex, &oldColor, tolerance) {
-				spanAbove = false
-			}
-			pixelIndex = fastPixOffset(image, x1, (y + 1))
-			if !spanBelow && y < h-1 && hasSimilarColor(image, pixelIndex, &oldColor, tolerance) {
-				stack.Push(Point{X: x1, Y: y + 1})
-				spanBelow = true
-			} else if spanBelow && y < h-1 && !hasSimilarColor(image, pixelIndex, &oldColor, tolerance) {
-				spanBelow = false
-			}
-			x1++
-		}
-	}
-	stack = nil
 }
 
 func (tool *ToolBucket) mouseDownEvent(e *ToolMouseEvent) {
@@ -129,16 +54,46 @@ func (tool *ToolBucket) mouseDownEvent(e *ToolMouseEvent) {
 	image := e.image
 	x := e.pt.X
 	y := e.pt.Y
-	clickedPixel := image.GetColorAt(x, y)
-	c := GetColorForeBack(mbutton)
-	floodWith := Rgba(c.GetR(), c.GetG(), c.GetB(), c.GetA())
-	floodFillScanline(image, Point{X: x, Y: y}, clickedPixel, floodWith)
+	sample := &image.BGRA
+	if tool.sampleAllLayers {
+		sample = e.canvas.FlattenImage()
+	}
+	region := raster.FloodRegion(sample, x, y, tool.options)
+	if tool.fillKind != FillGradient {
+		paint := mainWindow.fillStyle.NewPaint(tool.fillKind, mbutton, e.pt.AsImagePoint(), e.pt.AsImagePoint())
+		raster.PaintMask(&image.BGRA, region, paint)
+		return
+	}
+	tool.region = region
+	tool.bounds = raster.MaskBounds(region)
+	tool.backup = raster.ReadRect(&image.BGRA, tool.bounds)
+	tool.startPoint = e.pt
+	tool.mbutton = mbutton
+	tool.paintGradient(image, e.pt)
+}
+
+// paintGradient fills the area with the gradient dragged from the start point to end,
+// without a drag the gradient spreads over the whole area
+func (tool *ToolBucket) paintGradient(image *DrawingImage, end Point) {
+	raster.WriteRect(&image.BGRA, tool.bounds, tool.backup)
+	style := &mainWindow.fillStyle
+	start, stop := tool.startPoint.AsImagePoint(), end.AsImagePoint()
+	if start == stop {
+		start, stop = gradientLine(style.Gradient, tool.bounds)
+	}
+	raster.PaintMask(&image.BGRA, tool.region, style.NewPaint(FillGradient, tool.mbutton, start, stop))
 }
 
 func (tool *ToolBucket) mouseMoveEvent(e *ToolMouseEvent) {
-
+	if tool.region != nil {
+		tool.paintGradient(e.image, e.pt)
+	}
 }
 
 func (tool *ToolBucket) mouseUpEvent(e *ToolMouseEvent) {
-
+	if tool.region != nil {
+		tool.paintGradient(e.image, e.pt)
+		tool.region = nil
+		tool.backup = nil
+	}
 }
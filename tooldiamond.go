@@ -1,6 +1,9 @@
 package main
 
 import (
+	"gopaint/raster"
+	"image"
+
 	"github.com/shahfarhadreza/go-gdiplus"
 )
 
@@ -9,17 +12,19 @@ type DiamondDrawer struct {
 	points [4]gdiplus.Point
 }
 
-func (tool *DiamondDrawer) draw(args *ToolDrawShapeArgs) {
-	g := args.context
-	pen := args.pen
-	brush := args.brush
-	startPoint := args.startPoint
-	endPoint := args.endPoint
+func (tool *DiamondDrawer) setPoints(startPoint, endPoint gdiplus.Point) {
 	halfWidth, halfHeight := ((endPoint.X - startPoint.X) / 2), ((endPoint.Y - startPoint.Y) / 2)
 	tool.points[0] = gdiplus.Point{X: startPoint.X + halfWidth, Y: startPoint.Y}
 	tool.points[1] = gdiplus.Point{X: startPoint.X, Y: startPoint.Y + halfHeight}
 	tool.points[2] = gdiplus.Point{X: startPoint.X + halfWidth, Y: endPoint.Y}
 	tool.points[3] = gdiplus.Point{X: endPoint.X, Y: startPoint.Y + halfHeight}
+}
+
+func (tool *DiamondDrawer) draw(args *ToolDrawShapeArgs) {
+	g := args.context
+	pen := args.pen
+	brush := args.brush
+	tool.setPoints(args.startPoint, args.endPoint)
 	if brush != nil {
 		g.FillPolygonI(brush, tool.points[:], gdiplus.FillModeAlternate)
 	}
@@ -27,3 +32,12 @@ func (tool *DiamondDrawer) draw(args *ToolDrawShapeArgs) {
 		g.DrawPolygonI(pen, tool.points[:])
 	}
 }
+
+func (tool *DiamondDrawer) fill(dst *raster.BGRA, args *ToolDrawShapeArgs) {
+	tool.setPoints(args.startPoint, args.endPoint)
+	points := make([]image.Point, len(tool.points))
+	for i, pt := range tool.points {
+		points[i] = image.Pt(int(pt.X), int(pt.Y))
+	}
+	raster.FillPolygon(dst, points, shapeFillColor)
+}
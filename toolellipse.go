@@ -1,5 +1,7 @@
 package main
 
+import "gopaint/raster"
+
 type EllipseDrawer struct {
 	ShapeDrawer
 }
@@ -16,3 +18,7 @@ func (tool *EllipseDrawer) draw(args *ToolDrawShapeArgs) {
 		g.DrawEllipseI(pen, int32(rect.X), int32(rect.Y), int32(rect.Width), int32(rect.Height))
 	}
 }
+
+func (tool *EllipseDrawer) fill(dst *raster.BGRA, args *ToolDrawShapeArgs) {
+	raster.FillEllipse(dst, shapeBounds(args.rect), shapeFillColor)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	. "gopaint/reza"
+	"image"
 )
 
 type ToolEraser struct {
@@ -46,6 +47,10 @@ func (tool *ToolEraser) changeSize(size int) {
 	tool.size = size
 }
 
+func (tool *ToolEraser) getSize() int {
+	return tool.size
+}
+
 func (tool *ToolEraser) draw(e *ToolDrawEvent) {
 
 }
@@ -80,6 +85,10 @@ func (tool *ToolEraser) mouseMoveEvent(e *ToolMouseEvent) {
 	}
 }
 
+func (tool *ToolEraser) strokeBounds(e *ToolMouseEvent) image.Rectangle {
+	return segmentBounds(e, tool.size)
+}
+
 func (tool *ToolEraser) mouseUpEvent(e *ToolMouseEvent) {
 	mbutton := e.mbutton
 	//gc := e.context
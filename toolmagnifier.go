@@ -0,0 +1,62 @@
+package main
+
+import (
+	. "gopaint/reza"
+)
+
+// ToolMagnifier zooms in with the left button and out with the right one, around the
+// clicked point
+type ToolMagnifier struct {
+	ToolBasic
+	penBorder *Pen
+}
+
+func (tool *ToolMagnifier) initialize() {
+	tool.penBorder = NewUserStylePen(1, NewRgb(0, 0, 0), []uint32{3, 4})
+}
+
+func (tool *ToolMagnifier) Dispose() {
+	if tool.penBorder != nil {
+		tool.penBorder.Dispose()
+	}
+}
+
+func (tool *ToolMagnifier) prepare() {
+
+}
+
+// draw frames the part of the image that zooming in on the mouse would show
+func (tool *ToolMagnifier) draw(e *ToolDrawEvent) {
+	work := mainWindow.workspace
+	zoom := work.canvas.view.Zoom
+	next := zoom.In()
+	if next == zoom {
+		return
+	}
+	client := work.GetClientRect()
+	width := next.Unscale(client.Width())
+	height := next.Unscale(client.Height())
+	rect := Rect{Left: e.mouse.X - width/2, Top: e.mouse.Y - height/2}
+	rect.Right = rect.Left + width
+	rect.Bottom = rect.Top + height
+	e.gdi32.DrawRectangleEx(&rect, tool.penBorder, nil)
+}
+
+func (tool *ToolMagnifier) mouseDownEvent(e *ToolMouseEvent) {
+
+}
+
+func (tool *ToolMagnifier) mouseMoveEvent(e *ToolMouseEvent) {
+
+}
+
+func (tool *ToolMagnifier) mouseUpEvent(e *ToolMouseEvent) {
+	work := mainWindow.workspace
+	zoom := work.canvas.view.Zoom
+	if e.mbutton == MouseButtonLeft {
+		zoom = zoom.In()
+	} else if e.mbutton == MouseButtonRight {
+		zoom = zoom.Out()
+	}
+	work.SetZoom(zoom, work.cursorPos())
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	. "gopaint/reza"
+	"image"
 
 	"github.com/lxn/win"
 )
@@ -55,6 +56,10 @@ func (tool *ToolPencil) changeSize(size int) {
 	tool.size = size
 }
 
+func (tool *ToolPencil) getSize() int {
+	return tool.size
+}
+
 func (tool *ToolPencil) draw(e *ToolDrawEvent) {
 
 }
@@ -93,6 +98,10 @@ func (tool *ToolPencil) mouseDownEvent(e *ToolMouseEvent) {
 	}
 }
 
+func (tool *ToolPencil) strokeBounds(e *ToolMouseEvent) image.Rectangle {
+	return segmentBounds(e, tool.size)
+}
+
 func (tool *ToolPencil) mouseUpEvent(e *ToolMouseEvent) {
 
 }
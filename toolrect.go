@@ -1,5 +1,7 @@
 package main
 
+import "gopaint/raster"
+
 type RectangleDrawer struct {
 	ShapeDrawer
 }
@@ -16,3 +18,7 @@ func (tool *RectangleDrawer) draw(args *ToolDrawShapeArgs) {
 		g.DrawRectangleI(pen, int32(rect.X), int32(rect.Y), int32(rect.Width), int32(rect.Height))
 	}
 }
+
+func (tool *RectangleDrawer) fill(dst *raster.BGRA, args *ToolDrawShapeArgs) {
+	raster.Fill(dst, shapeBounds(args.rect), shapeFillColor)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"gopaint/raster"
+
 	"github.com/shahfarhadreza/go-gdiplus"
 )
 
@@ -27,11 +29,7 @@ func NewRoundedRectPath(bound *gdiplus.Rect, radius int32) *gdiplus.GraphicsPath
 	return path
 }
 
-func (tool *RoundRectDrawer) draw(args *ToolDrawShapeArgs) {
-	g := args.context
-	pen := args.pen
-	brush := args.brush
-	rect := args.rect
+func roundRectRadius(rect *gdiplus.Rect) int32 {
 	radius := int32(10)
 	// oh god this hardcoded fix.....
 	if rect.Width < 40 || rect.Height < 40 {
@@ -43,7 +41,15 @@ func (tool *RoundRectDrawer) draw(args *ToolDrawShapeArgs) {
 	if rect.Width < 10 || rect.Height < 10 {
 		radius = 1
 	}
-	round := NewRoundedRectPath(&rect, radius)
+	return radius
+}
+
+func (tool *RoundRectDrawer) draw(args *ToolDrawShapeArgs) {
+	g := args.context
+	pen := args.pen
+	brush := args.brush
+	rect := args.rect
+	round := NewRoundedRectPath(&rect, roundRectRadius(&rect))
 	if brush != nil {
 		g.FillPath(brush, round)
 	}
@@ -52,3 +58,7 @@ func (tool *RoundRectDrawer) draw(args *ToolDrawShapeArgs) {
 	}
 	round.Dispose()
 }
+
+func (tool *RoundRectDrawer) fill(dst *raster.BGRA, args *ToolDrawShapeArgs) {
+	raster.FillRoundRect(dst, shapeBounds(args.rect), int(roundRectRadius(&args.rect)), shapeFillColor)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	. "gopaint/reza"
+	"image"
 
 	"github.com/shahfarhadreza/go-gdiplus"
 
@@ -37,6 +38,7 @@ type Tool interface {
 	prepare()            // gets called everytime user chooses this tool
 	leave()              // gets called everytime user switches from this to another tool
 	changeSize(size int) // gets called when user changes size in the size dropdown button from the ribbon
+	getSize() int        // the size chosen for the tool, 0 if the tool has no size
 	draw(e *ToolDrawEvent)
 	getCursor(ptMouse *Point) win.HCURSOR
 	mouseMoveEvent(e *ToolMouseEvent)
@@ -45,6 +47,19 @@ type Tool interface {
 	keyPressEvent(e *ToolKeyEvent)
 }
 
+// strokeTool is a tool painting along the path of the mouse, it tells which pixels a
+// mouse event may have touched
+type strokeTool interface {
+	strokeBounds(e *ToolMouseEvent) image.Rectangle
+}
+
+// segmentBounds covers a line from the last mouse position to the current one drawn
+// with a pen of the given size, with a pixel to spare for the anti-aliasing
+func segmentBounds(e *ToolMouseEvent, size int) image.Rectangle {
+	margin := size/2 + 2
+	return image.Rectangle{Min: e.lastPt.AsImagePoint(), Max: e.pt.AsImagePoint()}.Canon().Inset(-margin)
+}
+
 type ToolBasic struct {
 }
 
@@ -56,6 +71,10 @@ func (tool *ToolBasic) changeSize(size int) {
 
 }
 
+func (tool *ToolBasic) getSize() int {
+	return 0
+}
+
 func (tool *ToolBasic) leave() {
 
 }
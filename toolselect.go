@@ -1,11 +1,13 @@
 package main
 
 import (
+	"gopaint/raster"
 	. "gopaint/reza"
+	"image"
+	"image/color"
+	"math"
 	"strconv"
 
-	"github.com/shahfarhadreza/go-gdiplus"
-
 	win "github.com/lxn/win"
 )
 
@@ -14,21 +16,76 @@ const (
 	SelectActionSelecting
 	SelectActionMoving
 	SelectActionResizing
+	SelectActionRotating
+)
+
+// How far outside of a floating selection dragging turns it instead of starting a new one
+const selectRotateDistance = 24
+
+// How close to a resize handle, in screen pixels, the mouse grabs it
+const selectHandleDistance = 6
+
+const (
+	SelectModeRectangle = iota
+	SelectModeFreeForm
+	SelectModeMagicWand
+)
+
+// The marching ants: dashes of the outline, in image pixels, and how often they move on
+const (
+	antDashLength = 4
+	antInterval   = 150
 )
 
 type ToolSelect struct {
 	ToolBasic
 	penBorder     *Pen
+	penWhite      *Pen
+	penAnts       *Pen
 	selection     *SelectionRect
 	startPoint    Point
 	currentAction int
 	selected      bool
-	bitmap        *BitmapGraphics
+	floating      *raster.Floating
+	mode          int
+	// How much of each pixel is selected, nil when nothing is. The selection rect
+	// holds its bounds
+	mask *image.Alpha
+	// Outline of the mask to draw and how far its dashes have moved
+	edges     []raster.MaskEdge
+	antOffset int
+	// Whether the mask is a plain rectangle which gets the resize handles
+	rectangular bool
+	// While selecting, the points the mouse went along for a free-form selection and how
+	// the new selection joins the current one
+	path []Point
+	op   raster.MaskOp
+	// How the magic wand finds the pixels of the clicked color
+	wandOptions raster.FloodOptions
+	// Leave out the pixels of the background color and the transparent ones when the
+	// floating pixels get shown and pasted
+	transparent bool
+	// The floating pixels before they got scaled, turned or skewed, nil until they are.
+	// Every change maps them again so they don't blur more and more. box is where the
+	// unturned pixels get scaled to, the angles are in degrees
+	source       *raster.Clip
+	box          image.Rectangle
+	angle        float64
+	skewX, skewY float64
+	// How the transformed pixels get resampled when they are pasted, the preview
+	// always takes the nearest ones
+	filter raster.Filter
+	// The handle being dragged and where the box and the angle were when it started
+	handle     int
+	startBox   image.Rectangle
+	startAngle float64
 }
 
 func (tool *ToolSelect) initialize() {
 	tool.selection = NewSelectionRect()
 	tool.penBorder = NewUserStylePen(1, NewRgb(0, 0, 0), []uint32{3, 4})
+	tool.penWhite = NewSolidPen(1, NewRgb(255, 255, 255))
+	tool.penAnts = NewSolidPen(1, NewRgb(0, 0, 0))
 	tool.currentAction = SelectActionNone
 }
 
@@ -36,41 +93,395 @@ func (tool *ToolSelect) Dispose() {
 	if tool.penBorder != nil {
 		tool.penBorder.Dispose()
 	}
+	if tool.penWhite != nil {
+		tool.penWhite.Dispose()
+	}
+	if tool.penAnts != nil {
+		tool.penAnts.Dispose()
+	}
 	if tool.selection != nil {
 		tool.selection.Dispose()
 	}
-	if tool.bitmap != nil {
-		tool.bitmap.Dispose()
-	}
 }
 
 func (tool *ToolSelect) prepare() {
 	tool.currentAction = SelectActionNone
-	tool.selected = false
-	tool.selection.Clear()
-	if tool.bitmap != nil {
-		tool.bitmap.Dispose()
-		tool.bitmap = nil
-	}
+	tool.floating = nil
+	tool.source = nil
 	//tool.SelectAll()
 }
 
+// leave pastes the floating pixels back, the selection stays so the other tools paint
+// inside it
 func (tool *ToolSelect) leave() {
 	tool.finalizeSelection()
-	tool.selected = false
 	tool.currentAction = SelectActionNone
+	tool.updateStatus()
+}
+
+// clearSelection forgets the selected area
+func (tool *ToolSelect) clearSelection() {
+	tool.selected = false
 	tool.selection.Clear()
+	tool.mask = nil
+	tool.edges = nil
+	tool.rectangular = false
+	tool.path = nil
+	tool.source = nil
+}
+
+// setBounds makes the rectangle the bounds of the selection
+func (tool *ToolSelect) setBounds(bounds image.Rectangle) {
+	tool.selection.SetRect(&Rect{Left: bounds.Min.X, Top: bounds.Min.Y, Right: bounds.Max.X, Bottom: bounds.Max.Y})
+}
+
+// setMask makes the mask the selection, an empty mask selects nothing
+func (tool *ToolSelect) setMask(mask *image.Alpha, rectangular bool) {
+	tool.clearSelection()
+	mask = raster.TrimMask(mask)
+	if mask.Rect.Empty() {
+		return
+	}
+	tool.selected = true
+	tool.mask = mask
+	tool.edges = raster.MaskOutline(mask)
+	tool.rectangular = rectangular
+	tool.setBounds(mask.Rect)
+}
+
+// isPointSelected tells whether the point is inside the selected area
+func (tool *ToolSelect) isPointSelected(pt *Point) bool {
+	return tool.mask != nil && tool.mask.AlphaAt(pt.X, pt.Y).A > 0
+}
+
+// floatingImage returns the floating pixels, placed where the selection is
+func (tool *ToolSelect) floatingImage() *BGRA {
+	return tool.floating.Image
+}
+
+// floatingMask returns the mask the floating pixels get shown and pasted through
+func (tool *ToolSelect) floatingMask() *image.Alpha {
+	return tool.keyedMask(tool.floatingImage())
+}
+
+// keyedMask returns the selection mask over p, without the pixels of the background
+// color in transparent mode
+func (tool *ToolSelect) keyedMask(p *BGRA) *image.Alpha {
+	if !tool.transparent {
+		return tool.mask
+	}
+	gcolor := GetColorBackground()
+	background := FromGdiplusColor(&gcolor)
+	return raster.KeyOutColor(p, tool.mask, background.AsNRGBA())
+}
+
+// handleDistance returns selectHandleDistance in image pixels at the current zoom
+func handleDistance() int {
+	distance := mainWindow.workspace.canvas.view.Zoom.Unscale(selectHandleDistance)
+	if distance < 1 {
+		return 1
+	}
+	return distance
+}
+
+// hasHandles tells whether the selection can be scaled by dragging its handles
+func (tool *ToolSelect) hasHandles() bool {
+	return tool.selected && (tool.rectangular || tool.floating != nil)
+}
+
+// inRotateZone tells whether the point is in the band around a floating selection
+// where dragging turns it
+func (tool *ToolSelect) inRotateZone(pt *Point) bool {
+	if tool.floating == nil || tool.isPointSelected(pt) {
+		return false
+	}
+	rect := tool.selection.GetRect()
+	rect.Inflate(selectRotateDistance, selectRotateDistance)
+	return rect.IsPointInside(pt)
+}
+
+// lift cuts the selected pixels of the active layer out into the floating ones, the
+// area left behind gets the background color (or transparency)
+func (tool *ToolSelect) lift() {
+	if tool.floating != nil || tool.selection.IsEmpty() || tool.mask == nil {
+		return
+	}
+	canvas := mainWindow.workspace.canvas
+	gcolor := GetColorBackground()
+	hole := canvas.ActiveLayer().ClearColor(FromGdiplusColor(&gcolor))
+	tool.floating = raster.LiftFloating(&canvas.ActiveImage().BGRA, tool.mask, hole)
+}
+
+// beginTransform lifts the selection and keeps its pixels to transform from, false if
+// nothing is selected
+func (tool *ToolSelect) beginTransform() bool {
+	if tool.selection.IsEmpty() || tool.mask == nil {
+		return false
+	}
+	tool.lift()
+	if tool.source == nil {
+		tool.source = raster.NewClip(tool.floatingImage(), tool.mask)
+		rect := tool.selection.GetRect()
+		tool.box = image.Rectangle{Min: rect.AsImageRect().Min}
+		tool.box.Max = tool.box.Min.Add(tool.source.Image.Rect.Size())
+		tool.angle, tool.skewX, tool.skewY = 0, 0, 0
+	}
+	return true
+}
+
+func degreesToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// transform returns how the source pixels get mapped onto the canvas: scaled into the
+// box, skewed and turned around its center
+func (tool *ToolSelect) transform() raster.Affine {
+	size := tool.source.Image.Rect.Size()
+	w, h := float64(size.X), float64(size.Y)
+	box := tool.box
+	cx, cy := float64(box.Min.X+box.Max.X)/2, float64(box.Min.Y+box.Max.Y)/2
+	return raster.Translate(-w/2, -h/2).
+		Then(raster.Scale(float64(box.Dx())/w, float64(box.Dy())/h)).
+		Then(raster.Skew(degreesToRadians(tool.skewX), degreesToRadians(tool.skewY))).
+		Then(raster.Rotate(degreesToRadians(tool.angle))).
+		Then(raster.Translate(cx, cy))
+}
+
+// applyTransform maps the source pixels into the floating ones with the filter
+func (tool *ToolSelect) applyTransform(filter raster.Filter) {
+	m := tool.transform()
+	pixels := raster.TransformImage(tool.source.Image, m, filter)
+	if pixels.Rect.Empty() {
+		return
+	}
+	tool.mask = raster.TransformMask(tool.source.Mask, m, filter)
+	tool.edges = raster.MaskOutline(tool.mask)
+	if tool.angle != 0 || tool.skewX != 0 || tool.skewY != 0 {
+		tool.rectangular = false
+	}
+	tool.setBounds(pixels.Rect)
+	tool.floating.Image = pixels
 	tool.updateStatus()
-	if tool.bitmap != nil {
-		tool.bitmap.Dispose()
-		tool.bitmap = nil
+}
+
+// resizeBox returns the box with the handle moved by (dx, dy). With keepAspect the box
+// keeps its proportions, a dragged corner follows the larger change and a dragged side
+// stays centered on the other axis
+func resizeBox(box image.Rectangle, handle, dx, dy int, keepAspect bool) image.Rectangle {
+	ratio := float64(box.Dx()) / float64(box.Dy())
+	resized := box
+	switch handle {
+	case RectPointTopLeft, RectPointLeft, RectPointBottomLeft:
+		resized.Min.X += dx
+	case RectPointTopRight, RectPointRight, RectPointBottomRight:
+		resized.Max.X += dx
+	}
+	switch handle {
+	case RectPointTopLeft, RectPointTop, RectPointTopRight:
+		resized.Min.Y += dy
+	case RectPointBottomLeft, RectPointBottom, RectPointBottomRight:
+		resized.Max.Y += dy
+	}
+	if keepAspect && box.Dy() > 0 {
+		w, h := float64(resized.Dx()), float64(resized.Dy())
+		switch handle {
+		case RectPointTop, RectPointBottom:
+			w = h * ratio
+		case RectPointLeft, RectPointRight:
+			h = w / ratio
+		default:
+			if math.Abs(w) >= math.Abs(h*ratio) {
+				h = w / ratio
+			} else {
+				w = h * ratio
+			}
+		}
+		width, height := int(math.Round(w)), int(math.Round(h))
+		switch handle {
+		case RectPointTopLeft, RectPointLeft, RectPointBottomLeft:
+			resized.Min.X = resized.Max.X - width
+		case RectPointTopRight, RectPointRight, RectPointBottomRight:
+			resized.Max.X = resized.Min.X + width
+		default:
+			resized.Min.X = (box.Min.X + box.Max.X - width) / 2
+			resized.Max.X = resized.Min.X + width
+		}
+		switch handle {
+		case RectPointTopLeft, RectPointTop, RectPointTopRight:
+			resized.Min.Y = resized.Max.Y - height
+		case RectPointBottomLeft, RectPointBottom, RectPointBottomRight:
+			resized.Max.Y = resized.Min.Y + height
+		default:
+			resized.Min.Y = (box.Min.Y + box.Max.Y - height) / 2
+			resized.Max.Y = resized.Min.Y + height
+		}
+	}
+	resized = resized.Canon()
+	if resized.Dx() < 1 {
+		resized.Max.X = resized.Min.X + 1
+	}
+	if resized.Dy() < 1 {
+		resized.Max.Y = resized.Min.Y + 1
+	}
+	return resized
+}
+
+// moveSelection moves the selected area by the given distance
+func (tool *ToolSelect) moveSelection(dx, dy int) {
+	rect := tool.selection.GetRect()
+	rect = Rect{
+		Left:   rect.Left + dx,
+		Top:    rect.Top + dy,
+		Right:  rect.Right + dx,
+		Bottom: rect.Bottom + dy,
+	}
+	tool.selection.SetRect(&rect)
+	tool.box = tool.box.Add(image.Pt(dx, dy))
+	if tool.floating != nil {
+		tool.floating.Move(image.Pt(dx, dy))
+	}
+	if tool.mask != nil {
+		offset := image.Pt(dx, dy)
+		tool.mask.Rect = tool.mask.Rect.Add(offset)
+		for i := range tool.edges {
+			tool.edges[i].From = tool.edges[i].From.Add(offset)
+			tool.edges[i].To = tool.edges[i].To.Add(offset)
+		}
+	}
+}
+
+// selectionOp tells from the modifier keys how a new selection joins the current one,
+// shift adds to it, alt subtracts from it and both keep what they have in common
+func selectionOp() raster.MaskOp {
+	shift := win.GetKeyState(win.VK_SHIFT) < 0
+	alt := win.GetKeyState(win.VK_MENU) < 0
+	switch {
+	case shift && alt:
+		return raster.MaskIntersect
+	case shift:
+		return raster.MaskUnion
+	case alt:
+		return raster.MaskSubtract
+	}
+	return raster.MaskReplace
+}
+
+// beginSelecting starts a new selection at the point, joined to the current one with op
+func (tool *ToolSelect) beginSelecting(pt Point, op raster.MaskOp) {
+	tool.finalizeSelection()
+	if op == raster.MaskReplace || tool.mask == nil {
+		tool.clearSelection()
+		op = raster.MaskReplace
+	}
+	tool.op = op
+	tool.currentAction = SelectActionSelecting
+	// The selection rect holds the dragged rectangle from now on
+	tool.selection.Clear()
+	tool.path = []Point{pt}
+}
+
+// selectByWand selects the pixels of the active layer with about the color of the one
+// at the point, joined to the current selection with op
+func (tool *ToolSelect) selectByWand(pt Point, op raster.MaskOp) {
+	tool.finalizeSelection()
+	image := mainWindow.workspace.canvas.ActiveImage()
+	if !pt.AsImagePoint().In(image.Rect) {
+		if op == raster.MaskReplace {
+			tool.clearSelection()
+		}
+		return
 	}
+	region := raster.FloodRegion(&image.BGRA, pt.X, pt.Y, tool.wandOptions)
+	if op != raster.MaskReplace && tool.mask != nil {
+		region = raster.CombineMasks(tool.mask, region, op)
+	}
+	tool.setMask(region, false)
+}
+
+// endSelecting turns the rectangle or the path the mouse went along into the selection
+func (tool *ToolSelect) endSelecting() {
+	bounds := mainWindow.workspace.canvas.ActiveImage().Rect
+	var shape *image.Alpha
+	if tool.mode == SelectModeFreeForm {
+		points := make([]image.Point, len(tool.path))
+		for i := range tool.path {
+			points[i] = tool.path[i].AsImagePoint()
+		}
+		shape = raster.PolygonMask(points, bounds)
+	} else {
+		rect := tool.selection.GetRect()
+		shape = raster.RectMask(rect.AsImageRect().Intersect(bounds))
+	}
+	if tool.op != raster.MaskReplace {
+		tool.setMask(raster.CombineMasks(tool.mask, shape, tool.op), false)
+		return
+	}
+	tool.setMask(shape, tool.mode == SelectModeRectangle)
+}
+
+// drawOutline draws the edges of the selected area in dashed black over white. The
+// dashes follow the diagonals so they run on around the corners
+func (tool *ToolSelect) drawOutline(g *Graphics) {
+	g.SelectObject(tool.penWhite)
+	for _, edge := range tool.edges {
+		g.DrawLineOnly(edge.From.X, edge.From.Y, edge.To.X, edge.To.Y)
+	}
+	g.SelectObject(tool.penAnts)
+	period := 2 * antDashLength
+	for _, edge := range tool.edges {
+		// Edges run right or down one pixel at a time
+		step := image.Pt(1, 0)
+		length := edge.To.X - edge.From.X
+		if edge.From.X == edge.To.X {
+			step, length = image.Pt(0, 1), edge.To.Y-edge.From.Y
+		}
+		start := -1
+		for i := 0; i <= length; i++ {
+			phase := ((edge.From.X+edge.From.Y+i-tool.antOffset)%period + period) % period
+			black := i < length && phase < antDashLength
+			if black && start < 0 {
+				start = i
+			} else if !black && start >= 0 {
+				from, to := edge.From.Add(step.Mul(start)), edge.From.Add(step.Mul(i))
+				g.DrawLineOnly(from.X, from.Y, to.X, to.Y)
+				start = -1
+			}
+		}
+	}
+}
+
+// showsOutline tells whether the outline gets drawn, rectangular selections show their
+// handles instead while the select tool is used
+func (tool *ToolSelect) showsOutline() bool {
+	if len(tool.edges) == 0 {
+		return false
+	}
+	if mainWindow.tools.GetCurrentTool() != tool {
+		return true
+	}
+	return !tool.rectangular || tool.currentAction == SelectActionSelecting || tool.currentAction == SelectActionMoving
+}
+
+// marchAnts moves the dashes of the outline on, only the area around the outline
+// gets repainted
+func (tool *ToolSelect) marchAnts() {
+	if !tool.showsOutline() {
+		return
+	}
+	tool.antOffset = (tool.antOffset + 1) % (2 * antDashLength)
+	var bounds image.Rectangle
+	for _, edge := range tool.edges {
+		// The lines are drawn on the pixels right of and below the borders
+		bounds = bounds.Union(image.Rectangle{Min: edge.From, Max: edge.To.Add(image.Pt(1, 1))})
+	}
+	canvas := mainWindow.workspace.canvas
+	rect := canvas.view.RectToWindow(bounds)
+	canvas.InvalidateRect(&Rect{Left: rect.Min.X, Top: rect.Min.Y, Right: rect.Max.X, Bottom: rect.Max.Y}, false)
 }
 
 func (tool *ToolSelect) getCursor(ptMouse *Point) win.HCURSOR {
 	if tool.selected {
-		rect := tool.selection.GetRect()
-		if onpoint, point := tool.selection.GetClosestRectPoint(ptMouse, 6); onpoint {
+		if onpoint, point := tool.selection.GetClosestRectPoint(ptMouse, handleDistance()); onpoint && tool.hasHandles() {
 			switch point {
 			case RectPointTop, RectPointBottom:
 				return mainWindow.hCursorSizeNS
@@ -81,10 +492,10 @@ func (tool *ToolSelect) getCursor(ptMouse *Point) win.HCURSOR {
 			case RectPointTopRight, RectPointBottomLeft:
 				return mainWindow.hCursorSizeNESW
 			}
-		} else {
-			if rect.IsPointInside(ptMouse) {
-				return mainWindow.hCursorMove
-			}
+		} else if tool.isPointSelected(ptMouse) {
+			return mainWindow.hCursorMove
+		} else if tool.inRotateZone(ptMouse) {
+			return mainWindow.hCursorRotate
 		}
 	}
 	return mainWindow.hCursorArrow
@@ -92,10 +503,21 @@ func (tool *ToolSelect) getCursor(ptMouse *Point) win.HCURSOR {
 
 func (tool *ToolSelect) draw(e *ToolDrawEvent) {
 	g := e.gdi32
+	if tool.currentAction == SelectActionSelecting {
+		// The selection we add to (or subtract from) and the new one
+		tool.drawOutline(g)
+		if tool.mode == SelectModeFreeForm {
+			g.DrawPolyline(tool.path, tool.penBorder)
+		} else if !tool.selection.IsEmpty() {
+			rect := tool.selection.GetRect()
+			g.DrawRectangleEx(&rect, tool.penBorder, nil)
+		}
+		return
+	}
 	if tool.selection != nil {
 		rect := tool.selection.GetRect()
 		if !tool.selection.IsEmpty() {
-			if tool.bitmap != nil {
+			if tool.floating != nil {
 				canvas := mainWindow.workspace.canvas
 				visibleRect := canvas.GetVisibleRect()
 				newRect := rect
@@ -105,13 +527,19 @@ func (tool *ToolSelect) draw(e *ToolDrawEvent) {
 				if newRect.Right > visibleRect.Right {
 					newRect.Right = visibleRect.Right
 				}
-				g.BitBlt(newRect.Left, newRect.Top,
-					newRect.Width(), newRect.Height(), tool.bitmap.Hdc,
-					0, 0, win.SRCCOPY)
+				// The floating pixels are whole, they get shown through the mask
+				bitmap := NewBitmapGraphics(rect.Width(), rect.Height())
+				defer bitmap.Dispose()
+				shown := &BGRA{Pix: bitmap.Data, Stride: 4 * rect.Width(), Rect: rect.AsImageRect()}
+				raster.CopyRect(shown, tool.floating.Shown(tool.floatingMask()), shown.Rect)
+				g.AlphaBlend(newRect.Left, newRect.Top,
+					newRect.Width(), newRect.Height(), bitmap.Hdc,
+					0, 0, newRect.Width(), newRect.Height(), 255)
 			}
-			if tool.currentAction == SelectActionSelecting || tool.currentAction == SelectActionMoving {
-				g.DrawRectangleEx(&rect, tool.penBorder, nil)
-			} else {
+			if !tool.rectangular || tool.currentAction == SelectActionMoving {
+				tool.drawOutline(g)
+			}
+			if tool.hasHandles() && tool.currentAction != SelectActionMoving {
 				tool.selection.Draw(g)
 			}
 		}
@@ -120,103 +548,247 @@ func (tool *ToolSelect) draw(e *ToolDrawEvent) {
 
 func (tool *ToolSelect) SelectAll() {
 	image := mainWindow.workspace.canvas.image
-	tool.selected = true
 	tool.currentAction = SelectActionNone
-	tool.selection.SetRect(&Rect{
-		Left:   0,
-		Top:    0,
-		Right:  image.Width(),
-		Bottom: image.Height(),
-	})
+	tool.setMask(raster.RectMask(image.Rect), true)
 }
 
 func (tool *ToolSelect) Deselect() {
+	canvas := mainWindow.workspace.canvas
+	canvas.BeginEdit()
 	tool.finalizeSelection()
-	tool.selected = false
+	canvas.EndEdit()
 	tool.currentAction = SelectActionNone
-	tool.selection.Clear()
+	tool.clearSelection()
+}
+
+// InvertSelection selects what isn't selected, everything if nothing is
+func (tool *ToolSelect) InvertSelection() {
+	canvas := mainWindow.workspace.canvas
+	canvas.BeginEdit()
+	tool.finalizeSelection()
+	canvas.EndEdit()
+	mask := tool.mask
+	if mask == nil {
+		mask = &image.Alpha{}
+	}
+	tool.currentAction = SelectActionNone
+	tool.setMask(raster.InvertMask(mask, canvas.ActiveImage().Rect), false)
+	tool.updateStatus()
+}
+
+// SelectColor selects every pixel of the active layer within the magic wand tolerance
+// of the (straight alpha) color
+func (tool *ToolSelect) SelectColor(c color.NRGBA) {
+	canvas := mainWindow.workspace.canvas
+	canvas.BeginEdit()
+	tool.finalizeSelection()
+	canvas.EndEdit()
+	tool.currentAction = SelectActionNone
+	tool.setMask(raster.ColorRegion(&canvas.ActiveImage().BGRA, c, tool.wandOptions.Tolerance), false)
+	tool.updateStatus()
+}
+
+// Copy puts the selected pixels of the active layer, or the floating ones, on the
+// clipboard. In transparent mode the background color is left out, like when pasting
+// and moving. False if nothing is selected
+func (tool *ToolSelect) Copy() bool {
+	if tool.mask == nil {
+		return false
+	}
+	pixels := &mainWindow.workspace.canvas.ActiveImage().BGRA
+	if tool.floating != nil {
+		pixels = tool.floatingImage()
+	}
+	mainWindow.clipboard = raster.NewClip(pixels, tool.keyedMask(pixels))
+	return true
+}
+
+// Cut copies the selected pixels and erases them
+func (tool *ToolSelect) Cut() {
+	if tool.Copy() {
+		tool.DeleteSelection()
+	}
+}
+
+// PasteClip makes the clip a floating selection at the top left corner of the visible
+// part of the canvas, it only becomes part of the image once it gets finalized. Until
+// then undo just drops it
+func (tool *ToolSelect) PasteClip(clip *raster.Clip) {
+	if clip.Empty() {
+		return
+	}
+	canvas := mainWindow.workspace.canvas
+	canvas.BeginEdit()
+	tool.finalizeSelection()
+	canvas.EndEdit()
+	visibleRect := canvas.GetVisibleRect()
+	floating, mask := raster.PasteFloating(clip, image.Pt(visibleRect.Left, visibleRect.Top))
+	tool.currentAction = SelectActionNone
+	tool.setMask(mask, false)
+	if !tool.selected {
+		return
+	}
+	tool.floating = floating
+	tool.updateStatus()
+}
+
+// CropToSelection cuts the document down to the bounds of the selection, what isn't
+// selected inside them gets erased
+func (tool *ToolSelect) CropToSelection() {
+	if tool.mask == nil {
+		return
+	}
+	mask := tool.mask
+	if tool.rectangular {
+		mask = nil
+	}
+	bounds := tool.mask.Rect
+	tool.Deselect()
+	mainWindow.workspace.canvas.Crop(bounds, mask)
+	mainWindow.workspace.RequestLayout()
+	tool.updateStatus()
 }
 
 func (tool *ToolSelect) finalizeSelection() {
-	image := mainWindow.workspace.canvas.image
-	if tool.bitmap != nil {
-		rect := tool.selection.GetRect()
-		image.context3.BitBlt(rect.Left, rect.Top, rect.Width(), rect.Height(), tool.bitmap.Hdc, 0, 0, win.SRCCOPY)
-		tool.bitmap.Dispose()
-		tool.bitmap = nil
+	image := mainWindow.workspace.canvas.ActiveImage()
+	if tool.floating != nil {
+		if tool.source != nil && tool.filter != raster.FilterNearest {
+			tool.applyTransform(tool.filter)
+		}
+		tool.floating.Drop(&image.BGRA, tool.floatingMask())
+		tool.floating = nil
+	}
+	tool.source = nil
+}
+
+// TransformSize returns the size the selection gets scaled to, zero if nothing is selected
+func (tool *ToolSelect) TransformSize() image.Point {
+	if tool.source != nil {
+		return tool.box.Size()
 	}
+	if tool.selection.IsEmpty() {
+		return image.Point{}
+	}
+	rect := tool.selection.GetRect()
+	return image.Pt(rect.Width(), rect.Height())
+}
+
+// Transform scales the selection to width x height and slants it by the angles in
+// degrees, replacing the skew it had. The selection gets lifted if it isn't floating yet
+func (tool *ToolSelect) Transform(width, height int, skewX, skewY float64) {
+	canvas := mainWindow.workspace.canvas
+	canvas.BeginEdit()
+	ok := tool.beginTransform()
+	canvas.EndEdit()
+	if !ok || width < 1 || height < 1 {
+		return
+	}
+	tool.box.Max = tool.box.Min.Add(image.Pt(width, height))
+	tool.skewX, tool.skewY = skewX, skewY
+	tool.applyTransform(raster.FilterNearest)
+	canvas.Repaint()
+}
+
+// IsFloating tells whether the selection is lifted out of the image
+func (tool *ToolSelect) IsFloating() bool {
+	return tool.floating != nil
+}
+
+// Reorient turns or flips the selection with one of the lossless transforms like
+// raster.RotateRight. quarter tells whether the turn swaps the sides and mirrored
+// whether it flips, the angle and the skew get adjusted so the selection turns as
+// it is shown
+func (tool *ToolSelect) Reorient(turn func(src *BGRA) *BGRA, quarter, mirrored bool) {
+	canvas := mainWindow.workspace.canvas
+	canvas.BeginEdit()
+	ok := tool.beginTransform()
+	canvas.EndEdit()
+	if !ok {
+		return
+	}
+	tool.source = tool.source.Turned(turn)
+	if quarter {
+		size := tool.box.Size()
+		center := tool.box.Min.Add(tool.box.Max)
+		min := image.Pt((center.X-size.Y)/2, (center.Y-size.X)/2)
+		tool.box = image.Rectangle{Min: min, Max: min.Add(image.Pt(size.Y, size.X))}
+		tool.skewX, tool.skewY = -tool.skewY, -tool.skewX
+	}
+	if mirrored {
+		tool.angle = -tool.angle
+		tool.skewX, tool.skewY = -tool.skewX, -tool.skewY
+	}
+	tool.applyTransform(raster.FilterNearest)
+	canvas.Repaint()
+}
+
+// Rotate turns the selection clockwise by the angle in degrees
+func (tool *ToolSelect) Rotate(degrees float64) {
+	canvas := mainWindow.workspace.canvas
+	canvas.BeginEdit()
+	ok := tool.beginTransform()
+	canvas.EndEdit()
+	if !ok {
+		return
+	}
+	tool.angle += degrees
+	tool.applyTransform(raster.FilterNearest)
+	canvas.Repaint()
+}
+
+// discardSelection drops the floating pixels (if any) without pasting them back into the image
+func (tool *ToolSelect) discardSelection() {
+	tool.floating = nil
+	tool.currentAction = SelectActionNone
+	tool.clearSelection()
+	tool.updateStatus()
 }
 
 func (tool *ToolSelect) DeleteSelection() {
 	if tool.selection.IsEmpty() {
 		return
 	}
-	image := mainWindow.workspace.canvas.image
-	if tool.bitmap == nil {
-		// replace the area with background color
-		context := image.context
-		color := GetColorBackground()
-		brush := gdiplus.NewSolidBrush(&color)
-		rect := tool.selection.GetRect()
-		w, h := rect.Width(), rect.Height()
-		context.FillRectangleI(brush.AsBrush(), int32(rect.Left), int32(rect.Top), int32(w), int32(h))
-		brush.Dispose()
+	canvas := mainWindow.workspace.canvas
+	canvas.BeginEdit()
+	defer canvas.EndEdit()
+	if tool.floating == nil {
+		// replace the area with background color (or transparency)
+		gcolor := GetColorBackground()
+		canvas.ActiveLayer().ClearMask(tool.mask, FromGdiplusColor(&gcolor))
 	} else {
-		tool.bitmap.Dispose()
-		tool.bitmap = nil
+		tool.floating = nil
 	}
-	tool.selected = false
 	tool.currentAction = SelectActionNone
-	tool.selection.Clear()
+	tool.clearSelection()
 }
 
 func (tool *ToolSelect) mouseDownEvent(e *ToolMouseEvent) {
 	mbutton := e.mbutton
 	if mbutton == MouseButtonLeft || mbutton == MouseButtonRight {
 		tool.startPoint = e.pt
-		rect := tool.selection.GetRect()
-		if tool.selected {
-			if onpoint, point := tool.selection.GetClosestRectPoint(&e.pt, 6); onpoint {
-				switch point {
-				case RectPointTop, RectPointBottom:
-					tool.currentAction = SelectActionResizing
-				case RectPointLeft, RectPointRight:
-					tool.currentAction = SelectActionResizing
-				case RectPointTopLeft, RectPointBottomRight:
-					tool.currentAction = SelectActionResizing
-				case RectPointTopRight, RectPointBottomLeft:
-					tool.currentAction = SelectActionResizing
-				}
-			} else if rect.IsPointInside(&e.pt) {
+		op := selectionOp()
+		if tool.selected && op == raster.MaskReplace {
+			if onpoint, point := tool.selection.GetClosestRectPoint(&e.pt, handleDistance()); onpoint && tool.hasHandles() {
+				tool.beginTransform()
+				tool.currentAction = SelectActionResizing
+				tool.handle = point
+				tool.startBox = tool.box
+			} else if tool.isPointSelected(&e.pt) {
 				tool.currentAction = SelectActionMoving
-				if !tool.selection.IsEmpty() {
-					w, h := rect.Width(), rect.Height()
-					if tool.bitmap == nil {
-						//log.Printf("w %d, h %d, x %d y %d\n", tool.rect.Width(), tool.rect.Height(), tool.rect.Left, tool.rect.Top)
-						tool.bitmap = NewBitmapGraphics(w, h)
-						bitmapContext := tool.bitmap.Graphics
-						bitmapContext.BitBlt(0, 0, w, h, e.image.context3.GetHDC(), rect.Left, rect.Top, win.SRCCOPY)
-						// replace the area with background color
-						context := e.image.context3
-						gcolor := GetColorBackground()
-						color := FromGdiplusColor(&gcolor)
-						brush := NewSolidBrush(&color)
-						pen := NewSolidPen(1, &color)
-						context.FillRectangleEx(&rect, pen, brush)
-						pen.Dispose()
-						brush.Dispose()
-					}
-				}
+				tool.lift()
+			} else if tool.inRotateZone(&e.pt) {
+				tool.beginTransform()
+				tool.currentAction = SelectActionRotating
+				tool.startAngle = tool.angle
+			} else if tool.mode == SelectModeMagicWand {
+				tool.selectByWand(e.pt, op)
 			} else {
-				tool.finalizeSelection()
-				tool.selected = false
-				tool.currentAction = SelectActionSelecting
-				tool.selection.Clear()
+				tool.beginSelecting(e.pt, op)
 			}
+		} else if tool.mode == SelectModeMagicWand {
+			tool.selectByWand(e.pt, op)
 		} else {
-			tool.selected = false
-			tool.currentAction = SelectActionSelecting
-			tool.selection.Clear()
+			tool.beginSelecting(e.pt, op)
 		}
 		tool.updateStatus()
 	}
@@ -225,7 +797,11 @@ func (tool *ToolSelect) mouseDownEvent(e *ToolMouseEvent) {
 func (tool *ToolSelect) mouseMoveEvent(e *ToolMouseEvent) {
 	mbutton := e.mbutton
 	if mbutton == MouseButtonLeft || mbutton == MouseButtonRight {
-		if tool.currentAction == SelectActionSelecting {
+		if tool.currentAction == SelectActionSelecting && tool.mode == SelectModeFreeForm {
+			if last := tool.path[len(tool.path)-1]; last != e.pt {
+				tool.path = append(tool.path, e.pt)
+			}
+		} else if tool.currentAction == SelectActionSelecting {
 			startPoint, endPoint := GetStartAndEnd(tool.startPoint, e.pt)
 			rect := Rect{
 				Left:   int(startPoint.X),
@@ -236,23 +812,24 @@ func (tool *ToolSelect) mouseMoveEvent(e *ToolMouseEvent) {
 			tool.selection.SetRect(&rect)
 			tool.updateStatus()
 		} else if tool.currentAction == SelectActionMoving {
-			rect := tool.selection.GetRect()
-			rectOrigin := Point{
-				X: rect.Left,
-				Y: rect.Top,
-			}
 			ptDist := e.pt.Distance(&e.lastPt)
-			newPos := Point{
-				X: rectOrigin.X + ptDist.X,
-				Y: rectOrigin.Y + ptDist.Y,
-			}
-			rect = Rect{
-				Left:   newPos.X,
-				Top:    newPos.Y,
-				Right:  newPos.X + rect.Width(),
-				Bottom: newPos.Y + rect.Height(),
+			tool.moveSelection(ptDist.X, ptDist.Y)
+		} else if tool.currentAction == SelectActionResizing {
+			keepAspect := win.GetKeyState(win.VK_SHIFT) < 0
+			tool.box = resizeBox(tool.startBox, tool.handle, e.pt.X-tool.startPoint.X, e.pt.Y-tool.startPoint.Y, keepAspect)
+			tool.applyTransform(raster.FilterNearest)
+		} else if tool.currentAction == SelectActionRotating {
+			// Turn by the angle the mouse went around the center of the box, shift snaps
+			// to steps of 15 degrees
+			cx, cy := float64(tool.box.Min.X+tool.box.Max.X)/2, float64(tool.box.Min.Y+tool.box.Max.Y)/2
+			start := math.Atan2(float64(tool.startPoint.Y)-cy, float64(tool.startPoint.X)-cx)
+			current := math.Atan2(float64(e.pt.Y)-cy, float64(e.pt.X)-cx)
+			angle := tool.startAngle + (current-start)*180/math.Pi
+			if win.GetKeyState(win.VK_SHIFT) < 0 {
+				angle = math.Round(angle/15) * 15
 			}
-			tool.selection.SetRect(&rect)
+			tool.angle = angle
+			tool.applyTransform(raster.FilterNearest)
 		}
 	}
 }
@@ -262,12 +839,8 @@ func (tool *ToolSelect) mouseUpEvent(e *ToolMouseEvent) {
 	//image := e.image
 	if mbutton == MouseButtonLeft || mbutton == MouseButtonRight {
 		if tool.currentAction == SelectActionSelecting {
-			// if we have at least 1x1 selected
-			if !tool.selection.IsEmpty() {
-				tool.selected = true
-			} else {
-				tool.selected = false
-			}
+			tool.endSelecting()
+			tool.updateStatus()
 		}
 		tool.currentAction = SelectActionNone
 	}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"gopaint/raster"
 	. "gopaint/reza"
+	"image"
+	"image/color"
 
 	"github.com/shahfarhadreza/go-gdiplus"
 )
@@ -10,6 +13,33 @@ type ShapeDrawer interface {
 	draw(args *ToolDrawShapeArgs)
 }
 
+// ShapeFiller is implemented by the shapes that can be filled with a gradient or a
+// pattern, fill paints the inside of the shape in an opaque color into dst
+type ShapeFiller interface {
+	fill(dst *BGRA, args *ToolDrawShapeArgs)
+}
+
+// Color the shape fillers paint with, the gradient or pattern replaces it afterwards
+var shapeFillColor = color.NRGBA{255, 255, 255, 255}
+
+// shapeFillKind tells how the shapes get filled, false if they don't
+func shapeFillKind() (FillKind, bool) {
+	switch {
+	case mainWindow.menuGradientFill.IsToggled():
+		return FillGradient, true
+	case mainWindow.menuPatternFill.IsToggled():
+		return FillPattern, true
+	case mainWindow.menuSolidFill.IsToggled():
+		return FillSolid, true
+	}
+	return FillSolid, false
+}
+
+// shapeBounds returns the pixels the shape drawn into rect can cover
+func shapeBounds(rect gdiplus.Rect) image.Rectangle {
+	return image.Rect(int(rect.X), int(rect.Y), int(rect.X+rect.Width)+1, int(rect.Y+rect.Height)+1)
+}
+
 type ToolShape struct {
 	ToolBasic
 	ShapeDrawer
@@ -18,6 +48,8 @@ type ToolShape struct {
 	endPoint    Point
 	isDrawing   bool
 	mbutton     int
+	// The shape filled with a gradient or pattern, painted under the outline
+	fillSurface *BGRA
 }
 
 type ToolDrawShapeArgs struct {
@@ -71,6 +103,10 @@ func (tool *ToolShape) changeSize(size int) {
 	tool.strokeWidth = size
 }
 
+func (tool *ToolShape) getSize() int {
+	return tool.strokeWidth
+}
+
 func (tool *ToolShape) draw(e *ToolDrawEvent) {
 	g := e.graphics
 	mbutton := tool.mbutton
@@ -88,9 +124,6 @@ func (tool *ToolShape) draw(e *ToolDrawEvent) {
 			Height: endPoint.Y - startPoint.Y,
 		}
 		pen, brush := GetPenAndBrush(mbutton, float32(tool.strokeWidth))
-		if pen == nil && brush == nil {
-			return
-		}
 		args := &ToolDrawShapeArgs{
 			gdi32:         e.gdi32,
 			context:       g,
@@ -102,6 +135,17 @@ func (tool *ToolShape) draw(e *ToolDrawEvent) {
 			startPointOrg: startPointOrg,
 			endPointOrg:   endPointOrg,
 		}
+		if tool.paintFill(args, mbutton) {
+			surface := tool.fillSurface
+			bounds := surface.Rect
+			bitmap := gdiplus.NewBitmapEx(int32(bounds.Dx()), int32(bounds.Dy()), int32(surface.Stride),
+				gdiplus.PixelFormat32bppPARGB, &surface.Pix[0])
+			g.DrawImageI(&bitmap.Image, int32(bounds.Min.X), int32(bounds.Min.Y))
+			bitmap.Dispose()
+		}
+		if pen == nil && brush == nil {
+			return
+		}
 		tool.ShapeDrawer.draw(args)
 		if pen != nil {
 			pen.Dispose()
@@ -112,6 +156,28 @@ func (tool *ToolShape) draw(e *ToolDrawEvent) {
 	}
 }
 
+// paintFill fills the shape with the gradient or pattern into the fill surface, false if
+// the shape doesn't get filled that way. The gradient spreads over the whole shape
+func (tool *ToolShape) paintFill(args *ToolDrawShapeArgs, mbutton int) bool {
+	tool.fillSurface = nil
+	kind, filled := shapeFillKind()
+	filler, canFill := tool.ShapeDrawer.(ShapeFiller)
+	if !filled || kind == FillSolid || !canFill {
+		return false
+	}
+	bounds := shapeBounds(args.rect)
+	if bounds.Empty() {
+		return false
+	}
+	surface := NewBGRA(bounds)
+	filler.fill(surface, args)
+	style := &mainWindow.fillStyle
+	start, end := gradientLine(style.Gradient, bounds)
+	raster.PaintAlpha(surface, bounds, style.NewPaint(kind, mbutton, start, end))
+	tool.fillSurface = surface
+	return true
+}
+
 func (tool *ToolShape) mouseDownEvent(e *ToolMouseEvent) {
 	mbutton := e.mbutton
 	if mbutton == MouseButtonLeft || mbutton == MouseButtonRight {
@@ -149,9 +215,6 @@ func (tool *ToolShape) mouseUpEvent(e *ToolMouseEvent) {
 				Height: endPoint.Y - startPoint.Y,
 			}
 			pen, brush := GetPenAndBrush(mbutton, float32(tool.strokeWidth))
-			if pen == nil && brush == nil {
-				return
-			}
 			args := &ToolDrawShapeArgs{
 				gdi32:         e.image.context3,
 				context:       g,
@@ -163,6 +226,14 @@ func (tool *ToolShape) mouseUpEvent(e *ToolMouseEvent) {
 				startPointOrg: startPointOrg,
 				endPointOrg:   endPointOrg,
 			}
+			if tool.paintFill(args, mbutton) {
+				surface := tool.fillSurface
+				raster.Composite(&e.image.BGRA, surface, surface.Rect, 255, raster.BlendNormal, false)
+				tool.fillSurface = nil
+			}
+			if pen == nil && brush == nil {
+				return
+			}
 			tool.ShapeDrawer.draw(args)
 			if pen != nil {
 				pen.Dispose()
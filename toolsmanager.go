@@ -10,6 +10,7 @@ type ToolsManager struct {
 	toolEraser    *ToolEraser
 	toolPickColor *ToolPickColor
 	toolBrush     *ToolBrush
+	toolMagnifier *ToolMagnifier
 	// Shape tools
 	toolShapeLine      *ToolShape
 	toolShapeRect      *ToolShape
@@ -41,6 +42,8 @@ func (tools *ToolsManager) init() {
 	tools.toolText.initialize()
 	tools.toolSelect = &ToolSelect{}
 	tools.toolSelect.initialize()
+	tools.toolMagnifier = &ToolMagnifier{}
+	tools.toolMagnifier.initialize()
 	// Shape tools
 	tools.toolShapeLine = &ToolShape{ShapeDrawer: &LineDrawer{}}
 	tools.toolShapeLine.initialize()
@@ -65,6 +68,7 @@ func (tools *ToolsManager) Dispose() {
 	tools.toolBucket.Dispose()
 	tools.toolText.Dispose()
 	tools.toolSelect.Dispose()
+	tools.toolMagnifier.Dispose()
 	// Shape tools
 	tools.toolShapeLine.Dispose()
 	tools.toolShapeRect.Dispose()
@@ -82,7 +86,11 @@ func (tools *ToolsManager) SetCurrentTool(tool Tool) {
 		return
 	}
 	if tools.currentTool != nil {
+		// Leaving a tool may commit pending work (floating selection, text) into the image
+		canvas := mainWindow.workspace.canvas
+		canvas.BeginEdit()
 		tools.currentTool.leave()
+		canvas.EndEdit()
 	}
 	tools.currentTool = tool
 	tool.prepare()
@@ -91,3 +99,37 @@ func (tools *ToolsManager) SetCurrentTool(tool Tool) {
 func (tools *ToolsManager) GetCurrentTool() Tool {
 	return tools.currentTool
 }
+
+// namedTools lists the tools by the names they are stored with in project files
+func (tools *ToolsManager) namedTools() map[string]Tool {
+	return map[string]Tool{
+		"select":         tools.toolSelect,
+		"pencil":         tools.toolPencil,
+		"bucket":         tools.toolBucket,
+		"text":           tools.toolText,
+		"eraser":         tools.toolEraser,
+		"pickcolor":      tools.toolPickColor,
+		"brush":          tools.toolBrush,
+		"magnifier":      tools.toolMagnifier,
+		"line":           tools.toolShapeLine,
+		"rectangle":      tools.toolShapeRect,
+		"roundrectangle": tools.toolShapeRoundRect,
+		"ellipse":        tools.toolShapeEllipse,
+		"triangle":       tools.toolShapeTriangle,
+		"diamond":        tools.toolShapeDiamond,
+	}
+}
+
+func (tools *ToolsManager) GetToolName(tool Tool) string {
+	for name, t := range tools.namedTools() {
+		if t == tool {
+			return name
+		}
+	}
+	return ""
+}
+
+// FindTool returns the tool with the given name or nil
+func (tools *ToolsManager) FindTool(name string) Tool {
+	return tools.namedTools()[name]
+}
@@ -134,7 +134,7 @@ func (tool *ToolText) leave() {
 }
 
 func (tool *ToolText) finalizeText() {
-	g := mainWindow.workspace.canvas.image.context
+	g := mainWindow.workspace.canvas.ActiveImage().context
 	textEdit := tool.textEdit
 	if !textEdit.IsEmpty() {
 		gdicolor := GetColorForeground()
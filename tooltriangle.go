@@ -1,6 +1,9 @@
 package main
 
 import (
+	"gopaint/raster"
+	"image"
+
 	"github.com/shahfarhadreza/go-gdiplus"
 )
 
@@ -9,15 +12,17 @@ type TriangleDrawer struct {
 	points [3]gdiplus.Point
 }
 
+func (tool *TriangleDrawer) setPoints(startPoint, endPoint gdiplus.Point) {
+	tool.points[0] = gdiplus.Point{X: startPoint.X, Y: endPoint.Y}
+	tool.points[1] = gdiplus.Point{X: endPoint.X, Y: endPoint.Y}
+	tool.points[2] = gdiplus.Point{X: startPoint.X + ((endPoint.X - startPoint.X) / 2), Y: startPoint.Y}
+}
+
 func (tool *TriangleDrawer) draw(args *ToolDrawShapeArgs) {
 	g := args.context
 	pen := args.pen
 	brush := args.brush
-	startPoint := args.startPoint
-	endPoint := args.endPoint
-	tool.points[0] = gdiplus.Point{X: startPoint.X, Y: endPoint.Y}
-	tool.points[1] = gdiplus.Point{X: endPoint.X, Y: endPoint.Y}
-	tool.points[2] = gdiplus.Point{X: startPoint.X + ((endPoint.X - startPoint.X) / 2), Y: startPoint.Y}
+	tool.setPoints(args.startPoint, args.endPoint)
 	if brush != nil {
 		g.FillPolygonI(brush, tool.points[:], gdiplus.FillModeAlternate)
 	}
@@ -25,3 +30,12 @@ func (tool *TriangleDrawer) draw(args *ToolDrawShapeArgs) {
 		g.DrawPolygonI(pen, tool.points[:])
 	}
 }
+
+func (tool *TriangleDrawer) fill(dst *raster.BGRA, args *ToolDrawShapeArgs) {
+	tool.setPoints(args.startPoint, args.endPoint)
+	points := make([]image.Point, len(tool.points))
+	for i, pt := range tool.points {
+		points[i] = image.Pt(int(pt.X), int(pt.Y))
+	}
+	raster.FillPolygon(dst, points, shapeFillColor)
+}
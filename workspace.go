@@ -1,6 +1,8 @@
 package main
 
 import (
+	"gopaint/raster"
+	"image"
 	"unsafe"
 
 	. "gopaint/reza"
@@ -43,11 +45,16 @@ func NewWorkspace(parent Window) *Workspace {
 	return workspace
 }
 
-func (work *Workspace) IsMouseOnResize() (resizeType int) {
+// cursorPos returns the mouse position in the workspace client coordinates
+func (work *Workspace) cursorPos() Point {
 	var winpt win.POINT
 	win.GetCursorPos(&winpt)
 	win.ScreenToClient(work.GetHandle(), &winpt)
-	pt := Point{X: int(winpt.X), Y: int(winpt.Y)}
+	return Point{X: int(winpt.X), Y: int(winpt.Y)}
+}
+
+func (work *Workspace) IsMouseOnResize() (resizeType int) {
+	pt := work.cursorPos()
 	if work.rcBoxBottom.IsPointInside(&pt) {
 		return ResizeTypeHeight
 	} else if work.rcBoxRight.IsPointInside(&pt) {
@@ -70,7 +77,9 @@ func (work *Workspace) Init(parent Window) {
 	work.SetHScrollEventHandler(work.HScroll)
 	work.SetVScrollEventHandler(work.VScroll)
 	work.SetMouseWheelEventHandler(func(e *MouseWheelEvent) {
-		if e.WheelDelta > 0 {
+		if e.VirtualKey&win.MK_CONTROL != 0 {
+			work.ZoomWheel(e.WheelDelta)
+		} else if e.WheelDelta > 0 {
 			work.ScrollUp()
 		} else {
 			work.ScrollDown()
@@ -116,6 +125,70 @@ func (work *Workspace) ScrollDown() {
 	work.UpdateVScroll(yNewPos)
 }
 
+// SetZoom zooms the canvas keeping the image point under anchor (in the workspace client
+// coordinates) in place
+func (work *Workspace) SetZoom(zoom raster.Zoom, anchor Point) {
+	canvas := work.canvas
+	from := canvas.view.Zoom
+	if zoom == from {
+		return
+	}
+	canvas.view.Zoom = zoom
+	// The scroll ranges get clamped again when laying out
+	work.xCurrentScroll = Max(raster.Rescroll(work.xCurrentScroll, anchor.X-canvasMargin, from, zoom), 0)
+	work.yCurrentScroll = Max(raster.Rescroll(work.yCurrentScroll, anchor.Y-canvasMargin, from, zoom), 0)
+	canvas.UpdateStatus()
+	work.RequestLayout()
+	work.InvalidateRect(nil, false)
+	canvas.RepaintVisible()
+}
+
+// ZoomCentered zooms around the middle of the workspace, for the ribbon buttons
+func (work *Workspace) ZoomCentered(zoom raster.Zoom) {
+	client := work.GetClientRect()
+	work.SetZoom(zoom, Point{X: client.CenterX(), Y: client.CenterY()})
+}
+
+// ZoomWheel zooms one level in or out around the mouse
+func (work *Workspace) ZoomWheel(wheelDelta int) {
+	zoom := work.canvas.view.Zoom
+	if wheelDelta > 0 {
+		zoom = zoom.In()
+	} else {
+		zoom = zoom.Out()
+	}
+	work.SetZoom(zoom, work.cursorPos())
+}
+
+// placeCanvas puts the canvas window over the part of the zoomed image inside the
+// workspace, a window as big as the whole zoomed image could get too big for Windows
+func (work *Workspace) placeCanvas() {
+	canvas := work.canvas
+	work.canvasPos = Point{X: -(work.xCurrentScroll - canvasMargin), Y: -(work.yCurrentScroll - canvasMargin)}
+	size := canvas.ViewSize()
+	content := image.Rect(0, 0, size.Width, size.Height).Add(image.Pt(work.canvasPos.X, work.canvasPos.Y))
+	client := work.GetClientRect()
+	shown := content.Intersect(client.AsImageRect())
+	if shown.Empty() {
+		// Happens only while the workspace is tiny, keep a pixel so there is a buffer
+		shown = image.Rectangle{Min: content.Min, Max: content.Min.Add(image.Pt(1, 1))}
+	}
+	canvas.view.Origin = shown.Min.Sub(content.Min)
+	win.SetWindowPos(canvas.GetHandle(), 0,
+		int32(shown.Min.X), int32(shown.Min.Y), int32(shown.Dx()), int32(shown.Dy()),
+		win.SWP_NOZORDER|win.SWP_NOREDRAW)
+}
+
+// contentRect returns the whole zoomed image in screen coordinates, the canvas window
+// only covers the visible part of it
+func (work *Workspace) contentRect() Rect {
+	size := work.canvas.ViewSize()
+	wrect := work.GetWindowRect()
+	left := wrect.Left + work.canvasPos.X
+	top := wrect.Top + work.canvasPos.Y
+	return Rect{Left: left, Top: top, Right: left + size.Width, Bottom: top + size.Height}
+}
+
 func (work *Workspace) updateCursor() bool {
 	resizeType := work.IsMouseOnResize()
 	if resizeType == ResizeTypeHeight {
@@ -152,10 +225,7 @@ func (work *Workspace) UpdateVScroll(newValue int) {
 	canvas := work.canvas
 
 	if canvas != nil {
-		work.canvasPos = Point{X: -(work.xCurrentScroll - canvasMargin), Y: -(work.yCurrentScroll - canvasMargin)}
-		win.SetWindowPos(canvas.GetHandle(), 0,
-			int32(work.canvasPos.X), int32(work.canvasPos.Y),
-			0, 0, win.SWP_NOZORDER|win.SWP_NOSIZE|win.SWP_NOREDRAW)
+		work.placeCanvas()
 		canvas.RepaintVisible()
 		canvas.Update()
 	}
@@ -186,10 +256,7 @@ func (work *Workspace) UpdateHScroll(newValue int) {
 	canvas := work.canvas
 
 	if canvas != nil {
-		work.canvasPos = Point{X: -(work.xCurrentScroll - canvasMargin), Y: -(work.yCurrentScroll - canvasMargin)}
-		win.SetWindowPos(canvas.GetHandle(), 0,
-			int32(work.canvasPos.X), int32(work.canvasPos.Y),
-			0, 0, win.SWP_NOZORDER|win.SWP_NOSIZE|win.SWP_NOREDRAW)
+		work.placeCanvas()
 		canvas.RepaintVisible()
 		canvas.Update()
 	}
@@ -246,7 +313,7 @@ func (work *Workspace) OnResize(clientNotused *Rect) {
 	}
 	work.doubleBuffer = NewDoubleBuffer(work, &client, &mainWindow.workspaceColor)
 
-	canvasSize := work.canvas.GetSize()
+	canvasSize := work.canvas.ViewSize()
 
 	contentWidth := canvasSize.Width + (canvasMargin * 2)   // mul by 2 for both side margins
 	contentHeight := canvasSize.Height + (canvasMargin * 2) // mul by 2 for both sides
@@ -279,8 +346,8 @@ func (work *Workspace) OnResize(clientNotused *Rect) {
 	win.SetScrollInfo(work.GetHandle(), win.SB_VERT, &si, true)
 
 	if work.canvas != nil {
-		work.canvasPos = Point{X: -(work.xCurrentScroll - canvasMargin), Y: -(work.yCurrentScroll - canvasMargin)}
-		work.canvas.SetPosition(work.canvasPos.X, work.canvasPos.Y)
+		work.placeCanvas()
+		work.canvas.RepaintVisible()
 	}
 }
 
@@ -291,10 +358,9 @@ func (work *Workspace) MouseDown(pt *Point, mbutton int) {
 
 	if work.resizeType != ResizeTypeNone {
 		logInfo("Resize!!!")
-		canvas := work.canvas
 		preview := work.resizePreview
 		wrect := work.GetWindowRect()
-		crect := canvas.GetWindowRect()
+		crect := work.contentRect()
 		previewLeft := crect.Left
 		diffLeft := 0
 		previewWidth := crect.Width()
@@ -323,10 +389,9 @@ func (work *Workspace) MouseDown(pt *Point, mbutton int) {
 
 func (work *Workspace) MouseMove(pt *Point, mbutton int) {
 	if mbutton == MouseButtonLeft {
-		canvas := work.canvas
 		preview := work.resizePreview
 		wrect := work.GetWindowRect()
-		crect := canvas.GetWindowRect()
+		crect := work.contentRect()
 		ptMouse := app.GetCursorPos()
 		ptMouseDiff := ptMouse.Distance(&work.ptMouseDown)
 		newHeight := crect.Height() + ptMouseDiff.Y
@@ -376,7 +441,7 @@ func (work *Workspace) MouseUp(pt *Point, mbutton int) {
 	if mbutton == MouseButtonLeft {
 		if work.resizeType != ResizeTypeNone {
 			canvas := work.canvas
-			crect := canvas.GetWindowRect()
+			crect := work.contentRect()
 			ptMouse := app.GetCursorPos()
 			ptMouseDiff := ptMouse.Distance(&work.ptMouseDown)
 			newHeight := crect.Height() + ptMouseDiff.Y
@@ -387,10 +452,14 @@ func (work *Workspace) MouseUp(pt *Point, mbutton int) {
 			if newWidth < 1 {
 				newWidth = 1
 			}
+			// The handles are dragged on the zoomed image
+			zoom := canvas.view.Zoom
+			newWidth = Max(zoom.Unscale(newWidth), 1)
+			newHeight = Max(zoom.Unscale(newHeight), 1)
 			if work.resizeType == ResizeTypeHeight {
-				canvas.Resize(crect.Width(), newHeight)
+				canvas.Resize(canvas.image.Width(), newHeight)
 			} else if work.resizeType == ResizeTypeWidth {
-				canvas.Resize(newWidth, crect.Height())
+				canvas.Resize(newWidth, canvas.image.Height())
 			} else {
 				canvas.Resize(newWidth, newHeight)
 			}
@@ -428,7 +497,7 @@ func (work *Workspace) Paint(gOrg *Graphics, rect *Rect) {
 	defer db.BitBlt(gOrg.GetHDC())
 
 	g := db.GetGraphics()
-	canvasSize := work.canvas.GetSize()
+	canvasSize := work.canvas.ViewSize()
 	rectCanvas := Rect{
 		Left:   work.canvasPos.X,
 		Top:    work.canvasPos.Y,